@@ -0,0 +1,370 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// RequestInfo describes where an incoming message comes from.
+type RequestInfo struct {
+	// Peer is the address of the manager. nil when unknown.
+	Peer net.Addr
+	// Credentials identifies the local process of the manager, over Unix sockets. nil when unknown.
+	Credentials *PeerCredentials
+	// TLS is the session of the manager, over TLS listeners. nil otherwise.
+	TLS *tls.ConnectionState
+}
+
+// credentials returns the credentials of the manager or nil
+func (r *RequestInfo) credentials() *PeerCredentials {
+	if r == nil {
+		return nil
+	}
+	return r.Credentials
+}
+
+// peerIP returns the ip address of Peer or nil
+func (r *RequestInfo) peerIP() net.IP {
+	if r == nil || r.Peer == nil {
+		return nil
+	}
+	switch addr := r.Peer.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	}
+	host, _, err := net.SplitHostPort(r.Peer.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// OIDView is a list of OID subtrees. An OID is in view when it equals
+// or is under any of the subtrees.
+//
+//	An empty view contains every OID.
+type OIDView []string
+
+// parse returns the parsed subtrees of v, nil for an empty view
+func (v OIDView) parse() ([]OID, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	ret := make([]OID, 0, len(v))
+	for _, each := range v {
+		if err := VerifyOid(each); err != nil {
+			return nil, errors.WithMessagef(err, "view %v", v)
+		}
+		subtree, err := ParseOID(each)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "view %v", v)
+		}
+		ret = append(ret, subtree)
+	}
+	return ret, nil
+}
+
+// Contains reports if oid is in view
+func (v OIDView) Contains(oid string) bool {
+	if len(v) == 0 {
+		return true
+	}
+	parsed, err := ParseOID(oid)
+	if err != nil {
+		return false
+	}
+	return subtreesContain(v.subtrees(), parsed)
+}
+
+// subtrees returns the parsed subtrees of v. invalid ones are skipped
+func (v OIDView) subtrees() []OID {
+	ret := make([]OID, 0, len(v))
+	for _, each := range v {
+		if subtree, err := ParseOID(each); err == nil {
+			ret = append(ret, subtree)
+		}
+	}
+	return ret
+}
+
+// subtreesContain reports if oid equals or is under any of subtrees
+func subtreesContain(subtrees []OID, oid OID) bool {
+	for _, each := range subtrees {
+		if oid.HasPrefix(each) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommunityACL restricts who may use a v1/v2c community, in the style of
+// snmpd.conf rocommunity / rwcommunity:
+//
+//	rocommunity public 10.0.0.0/8 .1.3.6.1.2.1.1
+//
+// is
+//
+//	CommunityACL{Community: "public", Sources: []string{"10.0.0.0/8"}, View: OIDView{"1.3.6.1.2.1.1"}}
+type CommunityACL struct {
+	Community string
+	// Sources lists the networks (CIDR or single address) allowed to use the community.
+	//     empty for any source.
+	Sources []string
+	// UIDs lists the local users allowed to use the community, through a Unix socket listener.
+	//     empty for any user. Requests shall match both Sources and UIDs when both are set.
+	UIDs []uint32
+	// ReadWrite allows SetRequest (rwcommunity). Otherwise the community is read only.
+	ReadWrite bool
+	// View limits the OIDs reachable with the community. empty for all OIDs.
+	View OIDView
+
+	sources []*net.IPNet
+	view    []OID
+}
+
+func (acl *CommunityACL) syncConfig() error {
+	acl.sources = nil
+	for _, each := range acl.Sources {
+		_, network, err := net.ParseCIDR(each)
+		if err != nil {
+			ip := net.ParseIP(each)
+			if ip == nil {
+				return errors.Errorf("community %v: not valid source %v", acl.Community, each)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		acl.sources = append(acl.sources, network)
+	}
+	view, err := acl.View.parse()
+	if err != nil {
+		return errors.WithMessagef(err, "community %v", acl.Community)
+	}
+	acl.view = view
+	return nil
+}
+
+func (acl *CommunityACL) allows(community string, info *RequestInfo) bool {
+	if acl.Community != community {
+		return false
+	}
+	return acl.allowsSource(info.peerIP()) && acl.allowsUser(info.credentials())
+}
+
+func (acl *CommunityACL) allowsSource(ip net.IP) bool {
+	if len(acl.sources) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, network := range acl.sources {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (acl *CommunityACL) allowsUser(credentials *PeerCredentials) bool {
+	if len(acl.UIDs) == 0 {
+		return true
+	}
+	if credentials == nil {
+		return false
+	}
+	for _, uid := range acl.UIDs {
+		if uid == credentials.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// CommunityEntry maps a SNMPV1/V2c community to a security name and a context,
+// as a snmpCommunityEntry of SNMP-COMMUNITY-MIB (RFC3584) does.
+//
+//	With the mapping a v1/v2c request meets the same SubAgent and AccessPolicy
+//	as a v3 request of user SecurityName for ContextName.
+type CommunityEntry struct {
+	// Name is the community string (snmpCommunityName)
+	Name string
+	// SecurityName is the security name requests of this community get (snmpCommunitySecurityName)
+	SecurityName string
+	// ContextEngineID is the engine serving the context (snmpCommunityContextEngineID)
+	//     empty for the local engine
+	ContextEngineID string
+	// ContextName is the context requests of this community are served in (snmpCommunityContextName)
+	ContextName string
+}
+
+// AccessPolicy grants a security name (a v3 UserName or a CommunityEntry.SecurityName) its access.
+type AccessPolicy struct {
+	SecurityName string
+	// ReadWrite allows SetRequest. Otherwise the security name is read only.
+	ReadWrite bool
+	// View limits the OIDs reachable. empty for all OIDs.
+	View OIDView
+
+	view []OID
+}
+
+func (p *AccessPolicy) syncConfig() error {
+	view, err := p.View.parse()
+	if err != nil {
+		return errors.WithMessagef(err, "SecurityConfig: access policy %v", p.SecurityName)
+	}
+	p.view = view
+	return nil
+}
+
+func (v *SecurityConfig) FindForCommunity(name string) *CommunityEntry {
+	for item := range v.Communities {
+		if v.Communities[item].Name == name {
+			return &v.Communities[item]
+		}
+	}
+	return nil
+}
+
+func (v *SecurityConfig) FindForAccessPolicy(securityName string) *AccessPolicy {
+	for item := range v.AccessPolicies {
+		if v.AccessPolicies[item].SecurityName == securityName {
+			return &v.AccessPolicies[item]
+		}
+	}
+	return nil
+}
+
+// requestScope is what a request resolves to: who is asking, for which
+// context, and what it may access. nil grants everything.
+type requestScope struct {
+	securityName    string
+	contextEngineID string
+	contextName     string
+	// byCommunity tells contextName is the community, mapped by no CommunityEntry
+	byCommunity bool
+	views       [][]OID // parsed subtrees of each OIDView applied
+	readOnly    bool
+	// skipCounter64 hides Counter64 objects from walks, as SNMPv1 could not carry them
+	skipCounter64 bool
+	// maxVarbindBytes is the room left for varbinds in the response. 0 for no limit
+	maxVarbindBytes int
+	// logger carries the attributes of the request. nil for the logger of the SubAgent
+	logger *slog.Logger
+	// ctx carries the span of the request to tracer. nil tracer for no tracing
+	ctx    context.Context
+	tracer Tracer
+	// info describes where the request comes from. nil when unknown
+	info *RequestInfo
+	// audit receives the records of SET requests. nil for no audit
+	audit AuditSink
+	// requestBytes is the size of the request message. 0 when unknown
+	requestBytes int
+}
+
+// loggerOr returns the logger of the request, or fallback
+func (s *requestScope) loggerOr(fallback *slog.Logger) *slog.Logger {
+	if s == nil || s.logger == nil {
+		return fallback
+	}
+	return s.logger
+}
+
+// fits reports if varbinds of size bytes fits in the response
+func (s *requestScope) fits(size int) bool {
+	return s == nil || s.maxVarbindBytes <= 0 || size <= s.maxVarbindBytes
+}
+
+// restrict limits s to view, parsed by syncConfig. nil view for all OIDs
+func (s *requestScope) restrict(view []OID, readOnly bool) {
+	if view != nil {
+		s.views = append(s.views, view)
+	}
+	s.readOnly = s.readOnly || readOnly
+}
+
+func (s *requestScope) inView(oid OID) bool {
+	if s == nil {
+		return true
+	}
+	for _, view := range s.views {
+		if !subtreesContain(view, oid) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *requestScope) writable() bool {
+	return s == nil || !s.readOnly
+}
+
+// scopeForCommunity resolves a v1/v2c request through SecurityConfig.CommunityACLs
+// and SecurityConfig.Communities.
+//
+//	returns ErrNoPermission if the community could not be used.
+func (t *MasterAgent) scopeForCommunity(request *gosnmp.SnmpPacket, info *RequestInfo) (*requestScope, error) {
+	scope := &requestScope{securityName: request.Community, contextName: request.Community, byCommunity: true}
+	if len(t.SecurityConfig.CommunityACLs) != 0 {
+		var found *CommunityACL
+		for id := range t.SecurityConfig.CommunityACLs {
+			if acl := &t.SecurityConfig.CommunityACLs[id]; acl.allows(request.Community, info) {
+				found = acl
+				break
+			}
+		}
+		if found == nil {
+			return nil, errors.WithMessagef(ErrNoPermission, "community %q from %v", request.Community, info.peerIP())
+		}
+		scope.restrict(found.view, !found.ReadWrite)
+	}
+	if len(t.SecurityConfig.Communities) != 0 {
+		entry := t.SecurityConfig.FindForCommunity(request.Community)
+		if entry == nil {
+			return nil, errors.WithMessagef(ErrNoPermission, "community %q not in community table", request.Community)
+		}
+		scope.securityName = entry.SecurityName
+		scope.contextEngineID = entry.ContextEngineID
+		scope.contextName = entry.ContextName
+		scope.byCommunity = false
+	}
+	return scope, nil
+}
+
+// scopeForUser resolves a v3 request of user
+func (t *MasterAgent) scopeForUser(request *gosnmp.SnmpPacket, username string) *requestScope {
+	return &requestScope{securityName: username, contextName: request.ContextName}
+}
+
+// checkAccess applies SecurityConfig.AccessPolicies for the security name of scope
+func (t *MasterAgent) checkAccess(scope *requestScope) error {
+	if scope.contextEngineID != "" &&
+		scope.contextEngineID != string(t.SecurityConfig.AuthoritativeEngineID.Marshal()) {
+		// the context of the community entry is on another engine
+		t.priv.mpdStats.unavailableContexts.Add(1)
+		return errors.WithMessagef(ErrNoSNMPInstance, "contextEngineID %x", scope.contextEngineID)
+	}
+	if len(t.SecurityConfig.AccessPolicies) == 0 {
+		return nil
+	}
+	policy := t.SecurityConfig.FindForAccessPolicy(scope.securityName)
+	if policy == nil {
+		return errors.WithMessagef(ErrNoPermission, "no access policy for %q", scope.securityName)
+	}
+	scope.restrict(policy.view, !policy.ReadWrite)
+	return nil
+}
@@ -0,0 +1,172 @@
+package GoSNMPServer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+var aclTestOIDs = []string{
+	"1.3.6.1.2.1.1.1.0",
+	"1.3.6.1.2.1.1.2.0",
+	"1.3.6.1.2.1.2.1.0",
+	"1.3.6.1.2.1.2.2.1.1.1",
+	"1.3.6.1.2.1.2.2.1.1.2",
+}
+
+// communityClient returns a connected client of community
+func communityClient(t *testing.T, port uint16, version gosnmp.SnmpVersion, community string) *gosnmp.GoSNMP {
+	client := udpClient(t, port, version)
+	client.Community = community
+	client.Timeout = 200 * time.Millisecond
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func aclTestMaster() MasterAgent {
+	return MasterAgent{
+		AllowedVersion: SNMPV1 | SNMPV2c,
+		SecurityConfig: SecurityConfig{CommunityACLs: []CommunityACL{
+			{Community: "public", Sources: []string{"127.0.0.0/8"}, View: OIDView{"1.3.6.1.2.1.2"}},
+			{Community: "private", Sources: []string{"127.0.0.1"}, ReadWrite: true},
+			{Community: "remote", Sources: []string{"10.0.0.0/8"}, ReadWrite: true},
+		}},
+		SubAgents: []*SubAgent{{OIDs: stringOIDs(aclTestOIDs...)}},
+	}
+}
+
+func TestCommunityACLView(t *testing.T) {
+	_, port := serveUDP(t, aclTestMaster())
+	public := communityClient(t, port, gosnmp.Version2c, "public")
+
+	res, err := public.Get([]string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != gosnmp.NoError || res.Variables[0].Type != gosnmp.NoSuchObject || res.Variables[1].Type != gosnmp.OctetString {
+		t.Errorf("unexpected response %v %+v", res.Error, res.Variables)
+	}
+
+	walked, err := public.WalkAll("1.3.6.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 3 || walked[0].Name != ".1.3.6.1.2.1.2.1.0" {
+		t.Errorf("walk out of view: %+v", walked)
+	}
+
+	res, err = public.Set([]gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.2.1.0", Type: gosnmp.OctetString, Value: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != gosnmp.NoAccess {
+		t.Errorf("read only community set: %v", res.Error)
+	}
+
+	private := communityClient(t, port, gosnmp.Version2c, "private")
+	res, err = private.Set([]gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.2.1.0", Type: gosnmp.OctetString, Value: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != gosnmp.NoError {
+		t.Errorf("read write community set: %v", res.Error)
+	}
+	if walked, err := private.BulkWalkAll("1.3.6.1"); err != nil || len(walked) != len(aclTestOIDs) {
+		t.Errorf("bulk walk: %v %d", err, len(walked))
+	}
+}
+
+func TestCommunityACLSources(t *testing.T) {
+	_, port := serveUDP(t, aclTestMaster())
+	for _, community := range []string{"remote", "other"} {
+		if _, err := communityClient(t, port, gosnmp.Version2c, community).Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+			t.Errorf("community %v answered", community)
+		}
+	}
+}
+
+func TestCommunityACLInvalidView(t *testing.T) {
+	master := aclTestMaster()
+	master.SecurityConfig.CommunityACLs[0].View = OIDView{"1.3.x"}
+	if err := master.ReadyForWork(); err == nil {
+		t.Error("invalid view accepted")
+	}
+	master = aclTestMaster()
+	master.SecurityConfig.AccessPolicies = []AccessPolicy{{SecurityName: "public", View: OIDView{"1..3"}}}
+	if err := master.ReadyForWork(); err == nil {
+		t.Error("invalid access policy view accepted")
+	}
+}
+
+func TestGetNoSuchByVersion(t *testing.T) {
+	_, port := serveUDP(t, aclTestMaster())
+	names := []string{"1.3.6.1.2.1.2.1.0", "1.3.6.1.2.1.2.2.1.1.3", "1.3.6.1.2.1.9.1.0"}
+
+	res, err := communityClient(t, port, gosnmp.Version2c, "private").Get(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != gosnmp.NoError || res.ErrorIndex != 0 {
+		t.Errorf("v2c error %v index %d", res.Error, res.ErrorIndex)
+	}
+	for id, expected := range []gosnmp.Asn1BER{gosnmp.OctetString, gosnmp.NoSuchInstance, gosnmp.NoSuchObject} {
+		if res.Variables[id].Type != expected {
+			t.Errorf("v2c %v: %v, expected %v", names[id], res.Variables[id].Type, expected)
+		}
+	}
+
+	res, err = communityClient(t, port, gosnmp.Version1, "private").Get(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != gosnmp.NoSuchName || res.ErrorIndex != 2 {
+		t.Errorf("v1 error %v index %d, expected noSuchName at 2", res.Error, res.ErrorIndex)
+	}
+}
+
+// bareReplyer only implements IReplyer
+type bareReplyer struct{ IReplyer }
+
+func TestRequestInfoOf(t *testing.T) {
+	replyer := &UDPReplyer{target: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 161}}
+	if info := requestInfoOf(replyer); info.Peer == nil || info.Peer.String() != "127.0.0.1:161" || info.Credentials != nil {
+		t.Errorf("info %+v", info)
+	}
+	if info := requestInfoOf(bareReplyer{replyer}); info.Peer != nil {
+		t.Errorf("peer %v of a replyer without RemoteAddr", info.Peer)
+	}
+	unix := &UnixgramReplyer{credentials: &PeerCredentials{PID: 1, UID: 1000, GID: 1000}}
+	if info := requestInfoOf(unix); info.Credentials != unix.credentials {
+		t.Errorf("credentials %+v", info.Credentials)
+	}
+	if info := requestInfoOf(bareReplyer{unix}); info.Credentials != nil {
+		t.Errorf("credentials %+v of a replyer without PeerCredentials", info.Credentials)
+	}
+}
+
+func TestCheckPermissionGetsCommunity(t *testing.T) {
+	got := make(chan string, 1)
+	items := stringOIDs("1.3.6.1.2.1.1.1.0")
+	items[0].OnCheckPermission = func(_ gosnmp.SnmpVersion, _ gosnmp.PDUType, contextName string) PermissionAllowance {
+		got <- contextName
+		return PermissionAllowanceAllowed
+	}
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		SecurityConfig: SecurityConfig{Communities: []CommunityEntry{
+			{Name: "public", SecurityName: "monitor", ContextName: "device"},
+		}},
+		SubAgents: []*SubAgent{{ContextNames: []string{"device"}, OIDs: items}},
+	}
+	_, port := serveUDP(t, master)
+	if _, err := communityClient(t, port, gosnmp.Version2c, "public").Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if contextName := <-got; contextName != "public" {
+		t.Errorf("OnCheckPermission got %q, expected the community", contextName)
+	}
+}
@@ -1,11 +1,12 @@
 package GoSNMPServer
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
-	"io"
 	"log"
+	"log/slog"
 	"reflect"
 	"time"
 
@@ -31,15 +32,50 @@ type MasterAgent struct {
 
 	SubAgents []*SubAgent
 
+	// Logger receives every record as a text line, secrets redacted. See NewLoggerFromLog
+	//      if sets to nil, nothing is logged. Ignored when StructuredLogger is set.
 	Logger *log.Logger
 
+	// StructuredLogger receives structured records, secrets redacted. See NewDefaultLogger
+	//      if sets to nil, records go to Logger
+	StructuredLogger *slog.Logger
+
 	AllowedVersion EnabledVersion
 
 	CreateTime time.Time
 
+	// MaxMessageSize is the largest message sent or received (snmpEngineMaxMessageSize).
+	//      if sets to 0, DefaultMaxMessageSize will be used
+	MaxMessageSize int
+
+	// Metrics counts messages received and sent. See NewMetrics
+	//      if sets to nil, nothing is counted but what SNMPv3 reports need.
+	Metrics *Metrics
+
+	// Tracer receives spans around request handling. See Tracer / InMemoryTracer
+	//      if sets to nil, nothing is traced
+	Tracer Tracer
+
+	// Interceptors see each request decoded before the SubAgents, the first being the outermost. See Interceptor
+	Interceptors []Interceptor
+
+	// AuditSink receives a record for each varbind of SET requests. See NewJSONLinesAuditSink
+	//      if sets to nil, SET requests are not audited
+	AuditSink AuditSink
+
+	// RateLimits drops requests of managers sending too much, and caps SNMPv1/v2c responses.
+	//      if left zero, nothing is limited
+	RateLimits RateLimits
+
 	priv struct {
 		communityToSubAgent map[string]*SubAgent
+		contextToSubAgent   map[string]*SubAgent
 		defaultSubAgent     *SubAgent
+		usmStats            *usmStats
+		tsmStats            *tsmStats
+		mpdStats            *mpdStats
+		rateLimiters        *rateLimiters
+		logger              *slog.Logger
 	}
 }
 
@@ -55,6 +91,27 @@ type SecurityConfig struct {
 	OnGetAuthoritativeEngineTime FuncGetAuthoritativeEngineTime
 
 	Users []gosnmp.UsmSecurityParameters
+
+	// CommunityACLs restricts SNMPV1/V2c communities by source network, write access and view.
+	//      if sets to nil, any community from anywhere is served.
+	CommunityACLs []CommunityACL
+
+	// Communities maps SNMPV1/V2c communities to security names and contexts. (snmpCommunityTable)
+	//      if sets to nil, the community is both the security name and the context name.
+	//      Otherwise communities not listed are refused.
+	Communities []CommunityEntry
+
+	// AccessPolicies grants security names their access.
+	//      if sets to nil, every security name has full access.
+	//      Otherwise security names not listed are refused.
+	AccessPolicies []AccessPolicy
+
+	// CertToNames maps the client certificates of TLS sessions to security names,
+	// for the SNMPV3 Transport Security Model. (snmpTlstmCertToTSNTable) See NewTLSListener and NewDTLSListener
+	//      if sets to nil, no TLS session is served.
+	CertToNames []CertToNameEntry
+	// TSMUsePrefix prefixes the security names of TLS sessions with "tls:", DTLS ones with "dtls:". (snmpTsmConfigurationUsePrefix)
+	TSMUsePrefix bool
 }
 
 func (v *SecurityConfig) FindForUser(name string) *gosnmp.UsmSecurityParameters {
@@ -116,9 +173,56 @@ func (t *MasterAgent) syncAndCheck() error {
 		return errors.WithStack(errors.Errorf("NoSecurity MasterAgent shell have one one SubAgent"))
 	}
 
-	if t.Logger == nil {
-		//Set New NIL Logger
-		t.Logger = log.New(io.Discard, "", 0)
+	for id := range t.SecurityConfig.Users {
+		user := &t.SecurityConfig.Users[id]
+		if err := VerifyUsmUser(user); err != nil {
+			return err
+		}
+		if t.SecurityConfig.FindForUser(user.UserName) != user {
+			return errors.Errorf("SecurityConfig: duplicate user %v", user.UserName)
+		}
+	}
+
+	for id := range t.SecurityConfig.CommunityACLs {
+		if err := t.SecurityConfig.CommunityACLs[id].syncConfig(); err != nil {
+			return err
+		}
+	}
+	for id, entry := range t.SecurityConfig.Communities {
+		if t.SecurityConfig.FindForCommunity(entry.Name) != &t.SecurityConfig.Communities[id] {
+			return errors.Errorf("SecurityConfig: duplicate community %v", entry.Name)
+		}
+	}
+	for id := range t.SecurityConfig.CertToNames {
+		if err := t.SecurityConfig.CertToNames[id].syncConfig(); err != nil {
+			return err
+		}
+	}
+	for id := range t.SecurityConfig.AccessPolicies {
+		if err := t.SecurityConfig.AccessPolicies[id].syncConfig(); err != nil {
+			return err
+		}
+	}
+
+	if t.priv.usmStats == nil {
+		t.priv.usmStats = new(usmStats)
+	}
+	if t.priv.tsmStats == nil {
+		t.priv.tsmStats = new(tsmStats)
+	}
+	if t.Metrics != nil {
+		t.Metrics.usm = t.priv.usmStats
+		t.Metrics.tsm = t.priv.tsmStats
+		// MPDStatsOIDs may be served before, so the counters of Metrics are kept
+		t.priv.mpdStats = t.Metrics.mpd
+	} else if t.priv.mpdStats == nil {
+		t.priv.mpdStats = new(mpdStats)
+	}
+	t.priv.rateLimiters = newRateLimiters(t.RateLimits)
+	if t.MaxMessageSize == 0 {
+		t.MaxMessageSize = DefaultMaxMessageSize
+	} else if t.MaxMessageSize < minMaxMessageSize {
+		return errors.Errorf("MaxMessageSize shell be at least %d", minMaxMessageSize)
 	}
 	if t.CreateTime.IsZero() {
 		t.CreateTime = time.Now()
@@ -141,105 +245,268 @@ func (t *MasterAgent) ReadyForWork() error {
 	return t.SyncConfig()
 }
 
-func (t *MasterAgent) getUserNameFromRequest(request *gosnmp.SnmpPacket) string {
-	var username string
-	if val, ok := request.SecurityParameters.(*gosnmp.UsmSecurityParameters); !ok {
-		panic(errors.WithMessagef(ErrUnsupportedPacketData, "GoSNMP .Unknown Type:%v", reflect.TypeOf(request.SecurityParameters)))
-	} else {
-		username = val.UserName
+// getUsmFromRequest returns the USM security parameters of a SNMPv3 request
+func (t *MasterAgent) getUsmFromRequest(request *gosnmp.SnmpPacket) (*gosnmp.UsmSecurityParameters, error) {
+	val, ok := request.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok || val == nil {
+		return nil, errors.WithMessagef(ErrUnsupportedPacketData, "GoSNMP .Unknown Type:%v", reflect.TypeOf(request.SecurityParameters))
 	}
-	return username
+	return val, nil
 }
 
 func (t *MasterAgent) ResponseForBuffer(i []byte) ([]byte, error) {
+	return t.ResponseForBufferFrom(i, nil)
+}
+
+// ResponseForBufferFrom works as ResponseForBuffer, with info describing where the buffer comes from.
+func (t *MasterAgent) ResponseForBufferFrom(i []byte, info *RequestInfo) (out []byte, err error) {
+	start := time.Now()
+	if t.Metrics != nil {
+		t.Metrics.inPkts.Add(1)
+	}
+	if !t.priv.rateLimiters.allowPeer(info) {
+		return t.dropRequest("source address")
+	}
+	ctx, span := startSpan(context.Background(), t.Tracer, "snmp.request", Attr("snmp.request_bytes", len(i)))
+	if info != nil && info.Peer != nil {
+		span.SetAttributes(Attr("net.peer", info.Peer.String()))
+	}
 	// Decode
 	vhandle := gosnmp.GoSNMP{}
-	vhandle.Logger = gosnmp.NewLogger(t.Logger)
+	vhandle.Logger = newGosnmpLogger(t.priv.logger)
 	mb, _ := t.getUsmSecurityParametersFromUser("")
 	vhandle.SecurityParameters = mb
+	_, decodeSpan := startSpan(ctx, t.Tracer, "snmp.decode", Attr("snmp.decode.pass", 1))
 	request, decodeError := vhandle.SnmpDecodePacket(i)
+	if request.Version != gosnmp.Version3 {
+		// SNMPv3 is decoded again with the keys of the user
+		decodeSpan.RecordError(decodeError)
+	}
+	decodeSpan.End()
+	logger := requestLogger(t.priv.logger, request, info)
+	defer func() {
+		t.Metrics.observeRequest(request, time.Since(start))
+		if len(out) != 0 {
+			if t.Metrics != nil {
+				t.Metrics.outPkts.Add(1)
+			}
+		}
+		span.SetAttributes(
+			Attr("snmp.version", request.Version.String()),
+			Attr("snmp.pdu_type", request.PDUType.String()),
+			Attr("snmp.response_bytes", len(out)))
+		span.RecordError(err)
+		span.End()
+	}()
+	if decodeError != nil && request.Version != gosnmp.Version3 {
+		logger.Debug("decode failed", "err", decodeError)
+		if t.Metrics != nil {
+			t.Metrics.inASNParseErrs.Add(1)
+		}
+		return nil, errors.WithMessagef(ErrUnsupportedPacketData, "GoSNMP Returns %v", decodeError)
+	}
 
-	if (request.Version == gosnmp.Version1) && (t.AllowedVersion&SNMPV1 != 0) {
-		return t.marshalPkt(t.ResponseForPkt(request))
-	} else if (request.Version == gosnmp.Version2c) && (t.AllowedVersion&SNMPV2c != 0) {
-		return t.marshalPkt(t.ResponseForPkt(request))
+	if (request.Version == gosnmp.Version1 && t.AllowedVersion&SNMPV1 != 0) ||
+		(request.Version == gosnmp.Version2c && t.AllowedVersion&SNMPV2c != 0) {
+		logger = withPDU(logger, request)
+		scope, err := t.scopeForCommunity(request, info)
+		if err != nil {
+			logger.Debug("community refused", "err", err)
+			if t.Metrics != nil {
+				t.Metrics.inBadCommunityNames.Add(1)
+			}
+			return nil, err
+		}
+		if !t.priv.rateLimiters.allowCommunity(request.Community) {
+			logger.Debug("community over rate limit")
+			return t.dropRequest("community")
+		}
+		scope.logger = logger
+		scope.ctx, scope.tracer, scope.info, scope.audit = ctx, t.Tracer, info, t.AuditSink
+		scope.requestBytes = len(i)
+		if request.Version == gosnmp.Version1 {
+			if request.PDUType == gosnmp.GetBulkRequest {
+				return nil, errors.WithMessagef(ErrUnsupportedPacketData, "GetBulkRequest in SNMPv1")
+			}
+			scope.skipCounter64 = true
+			val, err := t.responseForPkt(request, scope)
+			val, err = t.responseForV1(request, val, err)
+			return t.marshalResponse(request, val, err, scope)
+		}
+		val, err := t.responseForPkt(request, scope)
+		return t.marshalResponse(request, val, err, scope)
 	} else if (request.Version == gosnmp.Version3) && (t.AllowedVersion&SNMPV3 != 0) {
-		// check for initial - discover response / non Privacy Items
-		if decodeError == nil && len(request.Variables) == 0 {
-			val, err := t.ResponseForPkt(request)
-
-			if val == nil {
-				return t.marshalPkt(request, err)
-			} else {
-				return t.marshalPkt(val, err)
+		if request.SecurityModel == tsmSecurityModel {
+			var decoded *gosnmp.SnmpPacket
+			decoded, out, err = t.responseForTSM(ctx, i, info, logger)
+			if decoded != nil {
+				request = decoded
 			}
+			return out, err
+		}
+		if request.SecurityModel != gosnmp.UserSecurityModel {
+			t.priv.mpdStats.unknownSecurityModels.Add(1)
+			return nil, errors.WithMessagef(ErrUnsupportedPacketData, "msgSecurityModel %d", request.SecurityModel)
+		}
+		if request.MsgFlags&gosnmp.AuthPriv != 0 && request.MsgFlags&gosnmp.AuthNoPriv == 0 {
+			// privacy without authentication. See RFC3412 section 7.2 step 5
+			t.priv.mpdStats.invalidMsgs.Add(1)
+			return nil, errors.WithMessagef(ErrUnsupportedPacketData, "msgFlags %#x", byte(request.MsgFlags))
 		}
 		//v3 might want for Privacy
 		if request.SecurityParameters == nil {
+			if t.Metrics != nil {
+				t.Metrics.inASNParseErrs.Add(1)
+			}
 			return nil, errors.WithMessagef(ErrUnsupportedPacketData, "GoSNMP Returns %v", decodeError)
 		}
-		username := t.getUserNameFromRequest(request)
+		received, err := t.getUsmFromRequest(request)
+		if err != nil {
+			if t.Metrics != nil {
+				t.Metrics.inASNParseErrs.Add(1)
+			}
+			return nil, err
+		}
+		// check for initial - discover response
+		if received.AuthoritativeEngineID != mb.AuthoritativeEngineID {
+			return t.usmReport(request, oidUsmStatsUnknownEngineIDs, &t.priv.usmStats.unknownEngineIDs, nil)
+		}
+		username := received.UserName
+		logger = logger.With("user", username)
+		if t.SecurityConfig.FindForUser(username) == nil {
+			return t.usmReport(request, oidUsmStatsUnknownUserNames, &t.priv.usmStats.unknownUserNames, nil)
+		}
+		if !t.priv.rateLimiters.allowUser(username) {
+			logger.Debug("user over rate limit")
+			return t.dropRequest("user")
+		}
 		usm, err := t.getUsmSecurityParametersFromUser(username)
 		if err != nil {
 			return nil, err
 		}
+		if !usmCheckSecurityLevel(request.MsgFlags, usm) {
+			return t.usmReport(request, oidUsmStatsUnsupportedSecLevels, &t.priv.usmStats.unsupportedSecLevels, nil)
+		}
+		_, usmSpan := startSpan(ctx, t.Tracer, "snmp.usm",
+			Attr("snmp.usm.user", username), Attr("snmp.usm.flags", int(request.MsgFlags)))
+		GenKeys(usm)
+		authentic, inTimeWindow := true, true
+		if request.MsgFlags&gosnmp.AuthNoPriv != 0 {
+			authentic = usmIsAuthentic(i, received, usm)
+			inTimeWindow = authentic && t.usmInTimeWindow(received)
+		}
+		usmSpan.SetAttributes(Attr("snmp.usm.authentic", authentic), Attr("snmp.usm.in_time_window", inTimeWindow))
+		usmSpan.End()
+		if !authentic {
+			return t.usmReport(request, oidUsmStatsWrongDigests, &t.priv.usmStats.wrongDigests, nil)
+		}
+		if !inTimeWindow {
+			return t.usmReport(request, oidUsmStatsNotInTimeWindows, &t.priv.usmStats.notInTimeWindows, usm)
+		}
 		if decodeError != nil {
-			t.Logger.Printf("v3 decode [will fail with non password] meet %v\n", err)
-			vhandle.SecurityParameters = &gosnmp.UsmSecurityParameters{
-				UserName:                 usm.UserName,
-				AuthenticationProtocol:   usm.AuthenticationProtocol,
-				PrivacyProtocol:          usm.PrivacyProtocol,
-				AuthenticationPassphrase: usm.AuthenticationPassphrase,
-				PrivacyPassphrase:        usm.PrivacyPassphrase,
-				Logger:                   vhandle.Logger,
-			}
-			request, err = vhandle.SnmpDecodePacket(i)
+			logger.Debug("v3 decode without keys failed, decoding as user", "err", decodeError)
+			vhandle.SecurityParameters = usm.Copy()
+			_, decodeSpan := startSpan(ctx, t.Tracer, "snmp.decode", Attr("snmp.decode.pass", 2))
+			decoded, err := vhandle.SnmpDecodePacket(i)
+			decodeSpan.RecordError(err)
+			decodeSpan.End()
 			if err != nil {
+				if request.MsgFlags&gosnmp.AuthPriv == gosnmp.AuthPriv {
+					logger.Debug("v3 decrypt failed", "err", err)
+					return t.usmReport(request, oidUsmStatsDecryptionErrors, &t.priv.usmStats.decryptionErrors, nil)
+				}
+				if t.Metrics != nil {
+					t.Metrics.inASNParseErrs.Add(1)
+				}
 				return nil, errors.WithMessagef(ErrUnsupportedPacketData, "GoSNMP Returns %v", err)
 			}
+			request = decoded
+		}
+		if oid, counter := t.checkContext(request); counter != nil {
+			logger.Debug("context refused", "context", request.ContextName, "report", oid)
+			if request.MsgFlags&gosnmp.Reportable == 0 {
+				counter.Add(1)
+				return nil, errors.WithMessagef(ErrNoSNMPInstance, "context %q", request.ContextName)
+			}
+			return t.usmReport(request, oid, counter, usm)
 		}
 
-		val, err := t.ResponseForPkt(request)
+		scope := t.scopeForUser(request, username)
+		scope.logger = withPDU(logger, request)
+		scope.ctx, scope.tracer, scope.info, scope.audit = ctx, t.Tracer, info, t.AuditSink
+		scope.requestBytes = len(i)
+		val, err := t.responseForPkt(request, scope)
 		if val == nil {
-			request.SecurityParameters = vhandle.SecurityParameters
-			return t.marshalPkt(request, err)
-		} else {
-			securityParamters := usm
-			GenKeys(securityParamters)
-			GenSalt(securityParamters)
-			val.SecurityParameters = securityParamters
-
-			return t.marshalPkt(val, err)
+			// unconfirmed requests, as traps, and PDUs not served are not answered
+			return nil, err
 		}
+		securityParamters := usm
+		GenSalt(securityParamters)
+		val.SecurityParameters = securityParamters
+		val.MsgFlags &^= gosnmp.Reportable
+		val.MsgMaxSize = uint32(t.MaxMessageSize)
+
+		return t.marshalResponse(request, val, err, scope)
 	} else {
+		if t.Metrics != nil {
+			t.Metrics.inBadVersions.Add(1)
+		}
 		return nil, errors.WithStack(ErrUnsupportedProtoVersion)
 	}
 }
 
 func (t *MasterAgent) marshalPkt(pkt *gosnmp.SnmpPacket, err error) ([]byte, error) {
+	if errors.Is(err, ErrRequestDropped) {
+		if t.Metrics != nil {
+			t.Metrics.silentDrops.Add(1)
+		}
+		return nil, err
+	}
 	// when err. marshal error pkt
 	if pkt == nil {
 		pkt = &gosnmp.SnmpPacket{}
 	}
 	if err != nil {
-		t.Logger.Printf("Will marshal: %v\n", err)
+		t.priv.logger.Debug("marshal error response", "err", err)
 
 		errFill := t.fillErrorPkt(err, pkt)
 		if errFill != nil {
 			return nil, err
 		}
 
-		return pkt.MarshalMsg()
+		return marshalMessage(pkt)
 	}
 
-	out, err := pkt.MarshalMsg()
+	out, err := marshalMessage(pkt)
+	return out, err
+}
+
+// marshalResponse marshals the response to request, keeping it within the size allowed
+func (t *MasterAgent) marshalResponse(request, pkt *gosnmp.SnmpPacket, err error, scope *requestScope) ([]byte, error) {
+	if pkt == nil {
+		// unconfirmed requests, as traps, and PDUs not served are not answered
+		return nil, err
+	}
+	span := scope.span("snmp.marshal")
+	defer span.End()
+	out, err := t.marshalPkt(pkt, err)
+	if err != nil {
+		span.RecordError(err)
+		return out, err
+	}
+	out, err = t.fitResponse(request, out, pkt, t.maxResponseSize(request, scope))
+	if err == nil {
+		t.Metrics.observeResponse(pkt)
+		span.SetAttributes(Attr("snmp.error_status", pkt.Error.String()), Attr("snmp.response_bytes", len(out)))
+	}
+	span.RecordError(err)
 	return out, err
 }
 
 func (t *MasterAgent) getUsmSecurityParametersFromUser(username string) (*gosnmp.UsmSecurityParameters, error) {
 	if username == "" {
 		return &gosnmp.UsmSecurityParameters{
-			Logger:                   gosnmp.NewLogger(t.Logger),
+			Logger:                   newGosnmpLogger(t.priv.logger),
 			AuthoritativeEngineID:    string(t.SecurityConfig.AuthoritativeEngineID.Marshal()),
 			AuthoritativeEngineBoots: t.SecurityConfig.AuthoritativeEngineBoots,
 			AuthoritativeEngineTime:  t.SecurityConfig.OnGetAuthoritativeEngineTime(),
@@ -248,7 +515,7 @@ func (t *MasterAgent) getUsmSecurityParametersFromUser(username string) (*gosnmp
 	}
 	if val := t.SecurityConfig.FindForUser(username); val != nil {
 		fval := val.Copy().(*gosnmp.UsmSecurityParameters)
-		fval.Logger = gosnmp.NewLogger(t.Logger)
+		fval.Logger = newGosnmpLogger(t.priv.logger)
 		fval.AuthoritativeEngineID = string(t.SecurityConfig.AuthoritativeEngineID.Marshal())
 		fval.AuthoritativeEngineBoots = t.SecurityConfig.AuthoritativeEngineBoots
 		fval.AuthoritativeEngineTime = t.SecurityConfig.OnGetAuthoritativeEngineTime()
@@ -277,27 +544,100 @@ func (t *MasterAgent) fillErrorPkt(err error, io *gosnmp.SnmpPacket) error {
 }
 
 func (t *MasterAgent) ResponseForPkt(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+	return t.responseForPkt(i, nil)
+}
+
+func (t *MasterAgent) responseForPkt(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	if scope == nil {
+		scope = &requestScope{securityName: getPktContextOrCommunity(i), contextName: getPktContextOrCommunity(i),
+			byCommunity: i.Version != gosnmp.Version3}
+		if val, ok := i.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok && i.Version == gosnmp.Version3 {
+			scope.securityName = val.UserName
+		}
+		scope.logger, scope.tracer, scope.audit = t.priv.logger, t.Tracer, t.AuditSink
+	}
+	if len(t.Interceptors) == 0 {
+		return t.dispatch(i, scope)
+	}
+	req := t.newRequest(i, scope)
+	ret, err := chainHandler(t.Interceptors, func(req *Request) (*gosnmp.SnmpPacket, error) {
+		return t.dispatch(req.Packet, scope)
+	})(req)
+	if ret == nil && err != nil {
+		// errors are answered on the request, as SubAgents do
+		ret = req.Packet
+	}
+	return ret, err
+}
+
+// dispatch checks the access of the request, and serves it by its SubAgent
+func (t *MasterAgent) dispatch(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	accessSpan := scope.span("snmp.access", Attr("snmp.security_name", scope.securityName), Attr("snmp.context", scope.contextName))
+	err := t.checkAccess(scope)
+	accessSpan.RecordError(err)
+	accessSpan.End()
+	if i.Version != gosnmp.Version3 &&
+		(err != nil || i.PDUType == gosnmp.SetRequest && !scope.writable()) {
+		// the community is known, but does not allow this request
+		if t.Metrics != nil {
+			t.Metrics.inBadCommunityUses.Add(1)
+		}
+	}
+	if err != nil {
+		t.auditRefusedSet(i, scope, gosnmp.AuthorizationError, err)
+		return i, err
+	}
+	scope.maxVarbindBytes = t.maxResponseSize(i, scope) - estimateMessageOverhead(i)
 	// Find for which SubAgent
-	community := getPktContextOrCommunity(i)
-	subAgent := t.findForSubAgent(community)
+	subAgent := t.findForContext(scope.contextName)
+	if scope.byCommunity {
+		subAgent = t.findForSubAgent(scope.contextName)
+	}
 	if subAgent == nil {
-		return i, errors.WithStack(ErrNoSNMPInstance)
+		t.priv.mpdStats.unknownContexts.Add(1)
+		err := errors.WithStack(ErrNoSNMPInstance)
+		t.auditRefusedSet(i, scope, gosnmp.NoAccess, err)
+		return i, err
+	}
+	return subAgent.serve(i, scope)
+}
+
+// auditRefusedSet audits the varbinds of a SET request refused before reaching a SubAgent
+func (t *MasterAgent) auditRefusedSet(i *gosnmp.SnmpPacket, scope *requestScope, errret gosnmp.SNMPError, err error) {
+	if i.PDUType != gosnmp.SetRequest {
+		return
+	}
+	for _, varItem := range i.Variables {
+		scope.auditSet(varItem, nil, errret, err)
 	}
-	return subAgent.Serve(i)
+}
+
+// structuredLogger returns the logger of records, secrets redacted: StructuredLogger, or else Logger
+func (t *MasterAgent) structuredLogger() *slog.Logger {
+	if t.StructuredLogger != nil {
+		return slog.New(NewRedactingHandler(t.StructuredLogger.Handler()))
+	}
+	return loggerFromLog(t.Logger)
 }
 
 func (t *MasterAgent) SyncConfig() error {
+	t.priv.logger = t.structuredLogger()
 	t.priv.defaultSubAgent = nil
 	t.priv.communityToSubAgent = make(map[string]*SubAgent)
+	t.priv.contextToSubAgent = make(map[string]*SubAgent)
+	if t.Metrics != nil {
+		t.Metrics.setSubAgents(t.SubAgents)
+	}
 
 	for id, current := range t.SubAgents {
 		t.SubAgents[id].Logger = t.Logger
+		t.SubAgents[id].logger = t.priv.logger
 		t.SubAgents[id].master = t
 		if err := t.SubAgents[id].SyncConfig(); err != nil {
 			return err
 		}
 
-		if len(current.CommunityIDs) == 0 || t.SecurityConfig.NoSecurity {
+		if len(current.CommunityIDs) == 0 && len(current.ContextNames) == 0 || t.SecurityConfig.NoSecurity {
 			if t.priv.defaultSubAgent != nil {
 				return errors.Errorf("SyncConfig: Config Error: duplicate default agent")
 			}
@@ -308,9 +648,16 @@ func (t *MasterAgent) SyncConfig() error {
 			if _, exists := t.priv.communityToSubAgent[val]; exists {
 				return errors.Errorf("SyncConfig: Config Error: duplicate value:%s", val)
 			}
-			t.Logger.Printf("communityToSubAgent: val=%v, current=%p\n", val, current)
+			t.priv.logger.Debug("community to SubAgent", "community", val, "subagent", id)
 			t.priv.communityToSubAgent[val] = current
 		}
+		for _, val := range current.ContextNames {
+			if _, exists := t.priv.contextToSubAgent[val]; exists {
+				return errors.Errorf("SyncConfig: Config Error: duplicate context:%s", val)
+			}
+			t.priv.logger.Debug("context to SubAgent", "context", val, "subagent", id)
+			t.priv.contextToSubAgent[val] = current
+		}
 
 	}
 	return nil
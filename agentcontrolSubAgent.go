@@ -3,9 +3,11 @@ package GoSNMPServer
 import (
 	"fmt"
 	"log"
+	"log/slog"
+	"math"
 	"sort"
-	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gosnmp/gosnmp"
 	"github.com/pkg/errors"
@@ -17,67 +19,182 @@ type SubAgent struct {
 
 	CommunityIDs []string
 
-	// OIDs for Read/Write actions
+	// ContextNames selects SNMPV3 requests, and communities mapped by SecurityConfig.Communities, by context name.
+	//             a context listed here is served by this SubAgent before one listing it in CommunityIDs
+	ContextNames []string
+
+	// OIDs for Read/Write actions. Sorted by SyncConfig.
+	//    Use AddOID / RemoveOID to change them once serving.
 	OIDs []*PDUValueControlItem
 
 	// UserErrorMarkPacket decides if shall treat user returned error as generr
 	UserErrorMarkPacket bool
 
+	// Proxy forwards every request of the SubAgent to a downstream agent instead of serving OIDs.
+	//    OIDs shall be empty. See ProxyForwarder
+	Proxy *ProxyForwarder
+
+	// Logger is set by MasterAgent.SyncConfig
 	Logger *log.Logger
+	logger *slog.Logger
 
 	master *MasterAgent
 
+	// registry indexes OIDs for lookups. Built by SyncConfig
+	registry oidTree
+
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
+
 	sync.RWMutex
 }
 
 func (t *SubAgent) SyncConfig() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.logger == nil {
+		t.logger = loggerFromLog(t.Logger)
+	}
+	return t.syncConfig()
+}
+
+// syncConfig builds the registry of t.OIDs. It is left unchanged on error.
+//
+//	The subagent mutex lock should be held when this is called
+func (t *SubAgent) syncConfig() error {
 	var (
 		err error
 	)
-	t.Lock()
-	defer t.Unlock()
+	if t.Proxy != nil {
+		if len(t.OIDs) != 0 {
+			return errors.Errorf("community %v: proxy SubAgent with OIDs", t.CommunityIDs)
+		}
+		if err = t.Proxy.syncConfig(); err != nil {
+			return errors.WithMessagef(err, "community %v", t.CommunityIDs)
+		}
+	}
+	var registry oidTree
 	for _, oid := range t.OIDs {
-		if err = VerifyOid(oid.OID); err != nil {
+		if oid.oid, err = ParseOID(oid.OID); err != nil {
+			return err
+		}
+		if err = verifyProvider(oid.Provider); err != nil {
 			return err
 		}
+		if err = registry.insert(oid.oid, oid); err != nil {
+			return fmt.Errorf("community %v: %v", t.CommunityIDs, err)
+		}
+		oid.syncCache()
 	}
-	t.Logger.Printf("Total OIDs of %v: %v\n", t.CommunityIDs, len(t.OIDs))
+	t.logger.Info("SubAgent OIDs", "contexts", len(t.CommunityIDs), "oids", len(t.OIDs))
 
-	sort.Sort(byOID(t.OIDs))
-	for id, each := range t.OIDs {
-		t.Logger.Printf("OIDs of %v: %v\n", t.CommunityIDs, each.OID)
-		if id != 0 && t.OIDs[id].OID == t.OIDs[id-1].OID {
-			return fmt.Errorf("community %v: meet duplicate oid %v", t.CommunityIDs, each.OID)
-		}
+	t.registry = registry
+	t.OIDs = registry.items()
+	for _, each := range t.OIDs {
+		t.logger.Debug("SubAgent OID", "oid", each.OID, "type", each.Type.String())
 	}
 	return nil
 }
 
-func (t *SubAgent) ReplaceOIDs(newOids []*PDUValueControlItem) {
+// ReplaceOIDs registers newOids instead of the OIDs. On error the OIDs are kept.
+func (t *SubAgent) ReplaceOIDs(newOids []*PDUValueControlItem) error {
 	t.Lock()
+	defer t.Unlock()
+	oldOids := t.OIDs
 	t.OIDs = newOids
-	t.Unlock()
-	t.SyncConfig()
+	if err := t.syncConfig(); err != nil {
+		t.OIDs = oldOids
+		return err
+	}
+	return nil
+}
+
+// AddOID registers item without rebuilding the registry. It fails for a duplicate OID.
+func (t *SubAgent) AddOID(item *PDUValueControlItem) error {
+	oid, err := ParseOID(item.OID)
+	if err != nil {
+		return err
+	}
+	if err := verifyProvider(item.Provider); err != nil {
+		return err
+	}
+	t.Lock()
+	defer t.Unlock()
+	if err := t.registry.insert(oid, item); err != nil {
+		return fmt.Errorf("community %v: %v", t.CommunityIDs, err)
+	}
+	item.oid = oid
+	item.syncCache()
+	id := t.indexOf(oid)
+	t.OIDs = append(t.OIDs, nil)
+	copy(t.OIDs[id+1:], t.OIDs[id:])
+	t.OIDs[id] = item
+	return nil
+}
+
+// RemoveOID unregisters the item at oid. returns the item removed, nil if none.
+func (t *SubAgent) RemoveOID(oid string) *PDUValueControlItem {
+	parsed, err := ParseOID(oid)
+	if err != nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	item := t.registry.remove(parsed)
+	if item == nil {
+		return nil
+	}
+	id := t.indexOf(parsed)
+	t.OIDs = append(t.OIDs[:id], t.OIDs[id+1:]...)
+	return item
+}
+
+// indexOf returns the position of key in t.OIDs, or where it would be inserted.
+//
+//	The subagent mutex lock should be held when this is called
+func (t *SubAgent) indexOf(oid OID) int {
+	return sort.Search(len(t.OIDs), func(i int) bool {
+		return t.OIDs[i].oid.Compare(oid) >= 0
+	})
 }
 
 func (t *SubAgent) Serve(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+	return t.serve(i, nil)
+}
+
+func (t *SubAgent) serve(i *gosnmp.SnmpPacket, scope *requestScope) (ret *gosnmp.SnmpPacket, err error) {
+	span := scope.span("snmp.serve", Attr("snmp.pdu_type", i.PDUType.String()), Attr("snmp.varbinds", len(i.Variables)))
+	defer func() {
+		if ret != nil && ret.Error == gosnmp.TooBig {
+			// tooBig responses carry no varbinds, see RFC3416 section 4.2.1
+			ret.Variables = []gosnmp.SnmpPDU{}
+		}
+		if ret != nil {
+			span.SetAttributes(Attr("snmp.error_status", ret.Error.String()), Attr("snmp.error_index", int(ret.ErrorIndex)))
+		}
+		span.RecordError(err)
+		span.End()
+	}()
+	if t.Proxy != nil {
+		return t.Proxy.serve(t, i, scope)
+	}
 	switch i.PDUType {
 	case gosnmp.GetRequest:
-		return t.serveGetRequest(i)
+		return t.serveGetRequest(i, scope)
 	case gosnmp.GetNextRequest:
-		return t.serveGetNextRequest(i)
+		return t.serveGetNextRequest(i, scope)
 	case gosnmp.GetBulkRequest:
-		return t.serveGetBulkRequest(i)
+		return t.serveGetBulkRequest(i, scope)
 	case gosnmp.SetRequest:
-		return t.serveSetRequest(i)
+		return t.serveSetRequest(i, scope)
 	case gosnmp.Trap, gosnmp.SNMPv2Trap, gosnmp.InformRequest:
-		return t.serveTrap(i)
+		return t.serveTrap(i, scope)
 	default:
 		return nil, errors.WithStack(ErrUnsupportedOperation)
 	}
 }
 
-func (t *SubAgent) checkPermission(whichPDU *PDUValueControlItem, request *gosnmp.SnmpPacket) PermissionAllowance {
+func (t *SubAgent) checkPermission(whichPDU *PDUValueControlItem, request *gosnmp.SnmpPacket, scope *requestScope) PermissionAllowance {
 	if whichPDU.OnCheckPermission == nil {
 		return PermissionAllowanceAllowed
 	}
@@ -91,17 +208,6 @@ func (t *SubAgent) getPDU(Name string, Type gosnmp.Asn1BER, Value interface{}) g
 		Value: Value,
 	}
 }
-func (t *SubAgent) getPDUHelloVariable() gosnmp.SnmpPDU {
-	// Return a variable. Usually for failure login try count.
-	//   1.3.6.1.6.3.15.1.1.4.0 => http://oidref.com/1.3.6.1.6.3.15.1.1.4.0
-	//   usmStatsUnknownEngineIDs
-	return t.getPDU(
-		"1.3.6.1.6.3.15.1.1.4.0",
-		gosnmp.Counter32,
-		uint32(0),
-	)
-}
-
 func (t *SubAgent) getPDUEndOfMibView(Name string) gosnmp.SnmpPDU {
 	return t.getPDU(
 		Name,
@@ -118,6 +224,25 @@ func (t *SubAgent) getPDUNoSuchInstance(Name string) gosnmp.SnmpPDU {
 	)
 }
 
+// getPDUNoSuch returns the exception for a name not served in scope (RFC3416 section 4.2.1):
+// noSuchInstance if it looks like a missing instance of a served object, noSuchObject otherwise.
+func (t *SubAgent) getPDUNoSuch(Name string, scope *requestScope) gosnmp.SnmpPDU {
+	oid, err := ParseOID(Name)
+	if err == nil && scope.inView(oid) {
+		t.RLock()
+		instance := t.registry.hasSibling(oid)
+		t.RUnlock()
+		if instance {
+			return t.getPDUNoSuchInstance(Name)
+		}
+	}
+	return t.getPDU(
+		Name,
+		gosnmp.NoSuchObject,
+		nil,
+	)
+}
+
 func (t *SubAgent) getPDUNil(Name string) gosnmp.SnmpPDU {
 	return t.getPDU(
 		Name,
@@ -134,17 +259,25 @@ func (t *SubAgent) getPDUOctetString(Name, str string) gosnmp.SnmpPDU {
 	)
 }
 
+// getForPDUValueControlResult reads item for request i. values holds what BatchValueProviders returned, may be nil
 func (t *SubAgent) getForPDUValueControlResult(item *PDUValueControlItem,
-	i *gosnmp.SnmpPacket) (pdu gosnmp.SnmpPDU, errret gosnmp.SNMPError) {
-	if t.checkPermission(item, i) != PermissionAllowanceAllowed {
+	i *gosnmp.SnmpPacket, scope *requestScope, values batchValues) (pdu gosnmp.SnmpPDU, errret gosnmp.SNMPError) {
+	if t.checkPermission(item, i, scope) != PermissionAllowanceAllowed {
 		return t.getPDUNil(item.OID), gosnmp.NoAccess
 	}
-	if item.OnGet == nil {
+	if !item.readable() {
 		return t.getPDUNil(item.OID), gosnmp.ResourceUnavailable
 	}
+	callback := "OnGet"
+	if item.Provider != nil {
+		callback = "BatchValueProvider"
+	}
+	span := t.callbackSpan(scope, callback, item)
+	defer func() { span.end(errret) }()
 	defer func() {
 		// panic in onset
 		if err := recover(); err != nil {
+			span.RecordError(fmt.Errorf("panic: %+v", err))
 			pdu = t.getPDUOctetString(item.OID, fmt.Sprintf("ERROR: %+v", err))
 			if t.UserErrorMarkPacket {
 				errret = gosnmp.GenErr
@@ -152,8 +285,9 @@ func (t *SubAgent) getForPDUValueControlResult(item *PDUValueControlItem,
 			return
 		}
 	}()
-	valtoRet, err := item.OnGet()
+	valtoRet, err := t.readValue(item, values)
 	if err != nil {
+		span.RecordError(err)
 		if t.UserErrorMarkPacket {
 			errret = gosnmp.GenErr
 		} else {
@@ -169,16 +303,19 @@ func (t *SubAgent) getForPDUValueControlResult(item *PDUValueControlItem,
 }
 
 func (t *SubAgent) trapForPDUValueControlResult(item *PDUValueControlItem,
-	i *gosnmp.SnmpPacket, varItem gosnmp.SnmpPDU) (pdu gosnmp.SnmpPDU, errret gosnmp.SNMPError) {
-	if t.checkPermission(item, i) != PermissionAllowanceAllowed {
+	i *gosnmp.SnmpPacket, varItem gosnmp.SnmpPDU, scope *requestScope) (pdu gosnmp.SnmpPDU, errret gosnmp.SNMPError) {
+	if t.checkPermission(item, i, scope) != PermissionAllowanceAllowed {
 		return t.getPDUNil(item.OID), gosnmp.NoAccess
 	}
 	if item.OnTrap == nil {
 		return t.getPDUNil(item.OID), gosnmp.ResourceUnavailable
 	}
+	span := t.callbackSpan(scope, "OnTrap", item)
+	defer func() { span.end(errret) }()
 	defer func() {
 		// panic in onset
 		if err := recover(); err != nil {
+			span.RecordError(fmt.Errorf("panic: %+v", err))
 			pdu = t.getPDUOctetString(item.OID, fmt.Sprintf("ERROR: %+v", err))
 			if t.UserErrorMarkPacket {
 				errret = gosnmp.GenErr
@@ -192,6 +329,7 @@ func (t *SubAgent) trapForPDUValueControlResult(item *PDUValueControlItem,
 	}
 	valtoRet, err := item.OnTrap(isInform, varItem)
 	if err != nil {
+		span.RecordError(err)
 		if t.UserErrorMarkPacket {
 			errret = gosnmp.GenErr
 		} else {
@@ -206,37 +344,29 @@ func (t *SubAgent) trapForPDUValueControlResult(item *PDUValueControlItem,
 	}, gosnmp.NoError
 }
 
-func (t *SubAgent) serveGetRequest(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+func (t *SubAgent) serveGetRequest(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
 	var ret gosnmp.SnmpPacket = copySnmpPacket(i)
-	t.Logger.Printf("before copy: %v...After copy:%v\n",
-		i.SecurityParameters.(*gosnmp.UsmSecurityParameters),
-		ret.SecurityParameters.(*gosnmp.UsmSecurityParameters))
 	ret.PDUType = gosnmp.GetResponse
 	ret.Variables = []gosnmp.SnmpPDU{}
-	t.Logger.Printf("i.Version == %v len(i.Variables) = %v.\n", i.Version, len(i.Variables))
-	if i.Version == gosnmp.Version3 && len(i.Variables) == 0 {
-		// SNMP V3 hello packet
-		mb, _ := t.master.getUsmSecurityParametersFromUser("")
-		ret.SecurityParameters = mb
-		ret.PDUType = gosnmp.Report
-		ret.Variables = append(ret.Variables, t.getPDUHelloVariable())
-		return &ret, nil
+	scope.loggerOr(t.logger).Debug("serve get", "vars", len(i.Variables))
+	items := make([]*PDUValueControlItem, len(i.Variables))
+	for id, varItem := range i.Variables {
+		if item := t.getForPDUValueControl(varbindOID(varItem)); item != nil && scope.inView(item.oid) {
+			items[id] = item
+		}
 	}
+	values := t.fetchBatch(items, i, scope)
 	for id, varItem := range i.Variables {
-		item, _ := t.getForPDUValueControl(varItem.Name)
+		item := items[id]
 		if item == nil {
-			if ret.Error == gosnmp.NoError {
-				ret.Error = gosnmp.NoSuchName
-				ret.ErrorIndex = uint8(id)
-			}
-			ret.Variables = append(ret.Variables, t.getPDUNoSuchInstance(varItem.Name))
+			// SNMPv1 turns the exception into noSuchName, see responseForV1
+			ret.Variables = append(ret.Variables, t.getPDUNoSuch(varItem.Name, scope))
 			continue
 		}
 
-		ctl, snmperr := t.getForPDUValueControlResult(item, i)
+		ctl, snmperr := t.getForPDUValueControlResult(item, i, scope, values)
 		if snmperr != gosnmp.NoError && ret.Error == gosnmp.NoError {
-			ret.Error = snmperr
-			ret.ErrorIndex = uint8(id)
+			setErrorStatus(&ret, snmperr, id+1)
 		}
 		ret.Variables = append(ret.Variables, ctl)
 	}
@@ -245,30 +375,21 @@ func (t *SubAgent) serveGetRequest(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, er
 
 }
 
-func (t *SubAgent) serveTrap(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+func (t *SubAgent) serveTrap(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
 	var ret gosnmp.SnmpPacket = copySnmpPacket(i)
-	t.Logger.Printf("before copy: %v...After copy:%v\n",
-		i.SecurityParameters.(*gosnmp.UsmSecurityParameters),
-		ret.SecurityParameters.(*gosnmp.UsmSecurityParameters))
-
 	ret.PDUType = gosnmp.GetResponse
 	ret.Variables = []gosnmp.SnmpPDU{}
-	t.Logger.Printf("i.Version == %v len(i.Variables) = %v.\n", i.Version, len(i.Variables))
+	scope.loggerOr(t.logger).Debug("serve trap", "vars", len(i.Variables))
 	for id, varItem := range i.Variables {
-		item, _ := t.getForPDUValueControl(varItem.Name)
+		item := t.getForPDUValueControl(varbindOID(varItem))
 		if item == nil {
-			if ret.Error == gosnmp.NoError {
-				ret.Error = gosnmp.NoSuchName
-				ret.ErrorIndex = uint8(id)
-			}
 			ret.Variables = append(ret.Variables, t.getPDUNoSuchInstance(varItem.Name))
 			continue
 		}
 
-		ctl, snmperr := t.trapForPDUValueControlResult(item, i, varItem)
+		ctl, snmperr := t.trapForPDUValueControlResult(item, i, varItem, scope)
 		if snmperr != gosnmp.NoError && ret.Error == gosnmp.NoError {
-			ret.Error = snmperr
-			ret.ErrorIndex = uint8(id)
+			setErrorStatus(&ret, snmperr, id+1)
 		}
 		ret.Variables = append(ret.Variables, ctl)
 	}
@@ -280,203 +401,213 @@ func (t *SubAgent) serveTrap(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
 
 }
 
-func (t *SubAgent) serveGetBulkRequest(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+// bulkEntry is a varbind planned for a GetBulk response. nil item for endOfMibView
+type bulkEntry struct {
+	name  string
+	item  *PDUValueControlItem
+	index int // error-index of the varbind requested
+}
+
+func (t *SubAgent) serveGetBulkRequest(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
 	var ret gosnmp.SnmpPacket = copySnmpPacket(i)
 	ret.PDUType = gosnmp.GetResponse
 	ret.Variables = []gosnmp.SnmpPDU{}
-	vc := uint8(len(i.Variables))
-	t.Logger.Printf("serveGetBulkRequest (vars=%d, non-repeaters=%d, max-repetitions=%d\n", vc, i.NonRepeaters, i.MaxRepetitions)
+	vc := len(i.Variables)
+	logger := scope.loggerOr(t.logger)
+	logger.Debug("serve getbulk", "vars", vc, "non_repeaters", i.NonRepeaters, "max_repetitions", i.MaxRepetitions)
+	// non-repeaters beyond the varbinds are ignored. See RFC3416 section 4.2.3
+	nonRepeaters := min(int(i.NonRepeaters), vc)
+
+	// Walk first, so values are read at once. minSize bounds the walk by
+	// the size of varbinds without values: the response could not hold more.
+	var entries []bulkEntry
+	minSize := 0
+	plan := func(entry bulkEntry) bool {
+		name := entry.name
+		if entry.item != nil {
+			name = entry.item.OID
+		}
+		minSize += estimateVarbindSize(&gosnmp.SnmpPDU{Name: name, Type: gosnmp.Null})
+		if !scope.fits(minSize) {
+			return false
+		}
+		entries = append(entries, entry)
+		return true
+	}
 
 	// handle Non-Repeaters
-	t.Logger.Printf("handle non-repeaters (%d)\n", i.NonRepeaters)
-	for j := uint8(0); j < i.NonRepeaters; j++ {
+	full := false
+	for j := 0; j < nonRepeaters && !full; j++ {
 		queryForOid := i.Variables[j].Name
-		queryForOidStriped := strings.TrimLeft(queryForOid, ".0")
-		item, id := t.getForPDUValueControl(queryForOidStriped)
-		t.Logger.Printf("(non-repeater) t.getForPDUValueControl. query_for_oid=%v item=%v id=%v\n", queryForOid, item, id)
-		t.RLock()
-		if id >= len(t.OIDs) {
-			ret.Variables = append(ret.Variables, t.getPDUEndOfMibView(queryForOid))
-			t.RUnlock()
-			continue
-		} else {
-			t.RUnlock()
-		}
-		t.RLock()
-		item = t.OIDs[id]
-		t.RUnlock()
-
-		ctl, snmperr := t.getForPDUValueControlResult(item, i)
-		if snmperr != gosnmp.NoError && ret.Error == gosnmp.NoError {
-			ret.Error = snmperr
-			ret.ErrorIndex = j
-		}
-		ret.Variables = append(ret.Variables, ctl)
+		item := t.successorOf(varbindOID(i.Variables[j]), scope)
+		full = !plan(bulkEntry{name: queryForOid, item: item, index: j + 1})
 	}
 
-	t.Logger.Printf("handle remaining (%d, max-repetitions=%d)\n", vc-i.NonRepeaters, i.MaxRepetitions)
-	eomv := make(map[string]struct{})
-	for j := uint32(0); j < i.MaxRepetitions; j++ { // loop through repetitions
-		for k := i.NonRepeaters; k < vc; k++ { // loop through "repeaters"
-			queryForOid := i.Variables[k].Name
-			queryForOidStriped := strings.TrimLeft(queryForOid, ".0")
-			item, id := t.getForPDUValueControl(queryForOidStriped)
-			if item != nil {
-				id += 1
+	// cursors holds the last OID returned for each repeater, names its name. A repeater past the
+	// end of the MIB view gets endOfMibView in each remaining repetition, so rows keep their columns.
+	// See RFC3416 section 4.2.3
+	cursors := make([]OID, vc)
+	names := make([]string, vc)
+	done := make([]bool, vc)
+	for k := nonRepeaters; k < vc; k++ {
+		cursors[k] = varbindOID(i.Variables[k])
+		names[k] = i.Variables[k].Name
+	}
+	for j := uint32(0); j < i.MaxRepetitions && !full; j++ { // loop through repetitions
+		ended := true
+		var repetition []bulkEntry
+		for k := nonRepeaters; k < vc; k++ { // loop through "repeaters"
+			var item *PDUValueControlItem
+			if !done[k] {
+				item = t.successorOf(cursors[k], scope) // repetition next
 			}
-			nextIndex := id + int(j)
-			t.RLock()
-			if nextIndex >= len(t.OIDs) {
-				if _, found := eomv[queryForOid]; !found {
-					ret.Variables = append(ret.Variables, t.getPDUEndOfMibView(queryForOid))
-					eomv[queryForOid] = struct{}{}
-				}
-				t.RUnlock()
+			if item == nil {
+				done[k] = true
+				repetition = append(repetition, bulkEntry{name: names[k]})
 				continue
-			} else {
-				t.RUnlock()
 			}
-			t.RLock()
-			item = t.OIDs[nextIndex] // repetition next
-			t.RUnlock()
-			t.Logger.Printf("t.getForPDUValueControl. query_for_oid=%v item=%v id=%v\n", queryForOid, item, id)
-			ctl, snmperr := t.getForPDUValueControlResult(item, i)
-			if snmperr != gosnmp.NoError && ret.Error == gosnmp.NoError {
-				ret.Error = snmperr
-				ret.ErrorIndex = k
+			ended = false
+			cursors[k], names[k] = item.oid, item.OID
+			repetition = append(repetition, bulkEntry{name: names[k], item: item, index: k + 1})
+		}
+		for _, entry := range repetition {
+			if full = !plan(entry); full {
+				break
 			}
-			ret.Variables = append(ret.Variables, ctl)
+		}
+		if ended {
+			break
 		}
 	}
 
+	items := make([]*PDUValueControlItem, len(entries))
+	for id := range entries {
+		items[id] = entries[id].item
+	}
+	values := t.fetchBatch(items, i, scope)
+
+	// size tracks the encoded varbinds. The response is truncated once it gets too large
+	size := 0
+	for _, entry := range entries {
+		pdu := t.getPDUEndOfMibView(entry.name)
+		if entry.item != nil {
+			var snmperr gosnmp.SNMPError
+			pdu, snmperr = t.getForPDUValueControlResult(entry.item, i, scope, values)
+			if snmperr != gosnmp.NoError && ret.Error == gosnmp.NoError {
+				setErrorStatus(&ret, snmperr, entry.index)
+			}
+		}
+		size += estimateVarbindSize(&pdu)
+		if !scope.fits(size) {
+			logger.Debug("getbulk response truncated", "varbinds", len(ret.Variables))
+			break
+		}
+		ret.Variables = append(ret.Variables, pdu)
+	}
 	return &ret, nil
 }
 
-func (t *SubAgent) serveGetNextRequest(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+// serveGetNextRequest for GetNextRequest.
+//
+//	Each varbind gets its own successor, or endOfMibView. See RFC3416 section 4.2.2
+func (t *SubAgent) serveGetNextRequest(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
 	var ret gosnmp.SnmpPacket = copySnmpPacket(i)
-
 	ret.PDUType = gosnmp.GetResponse
 	ret.Variables = []gosnmp.SnmpPDU{}
-	length := len(i.Variables)
-	queryForOid := i.Variables[length-1].Name
-	queryForOidStriped := strings.TrimLeft(queryForOid, ".0")
-	t.Logger.Printf("serveGetNextRequest of %v\n", queryForOid)
-	item, id := t.getForPDUValueControl(queryForOidStriped)
-	t.Logger.Printf("t.getForPDUValueControl. query_for_oid=%v item=%v id=%v\n", queryForOid, item, id)
-	if item != nil {
-		id += 1
-	}
-	t.RLock()
-	if id >= len(t.OIDs) {
-		// NOT find for the last
-		ret.Variables = append(ret.Variables, t.getPDUEndOfMibView(queryForOid))
-		t.RUnlock()
-		return &ret, nil
-	} else {
-		t.RUnlock()
-	}
-	if i.MaxRepetitions != 0 {
-		length = int(i.MaxRepetitions)
-	}
-	t.RLock()
-	if length+id > len(t.OIDs) {
-		length = len(t.OIDs) - id
+	logger := scope.loggerOr(t.logger)
+	items := make([]*PDUValueControlItem, len(i.Variables))
+	for id, varItem := range i.Variables {
+		items[id] = t.successorOf(varbindOID(varItem), scope)
 	}
-	t.Logger.Printf("i.Variables[id: length]. id=%v length =%v. len(t.OIDs)=%v\n", id, length, len(t.OIDs))
-	t.RUnlock()
-	iid := id
-	for {
-		t.RLock()
-		if iid >= len(t.OIDs) {
-			t.RUnlock()
-			break
-		} else {
-			t.RUnlock()
-		}
-		t.RLock()
-		item := t.OIDs[iid]
-		t.RUnlock()
-		if len(ret.Variables) >= length {
-			break
-		}
-		if item.NonWalkable || item.OnGet == nil {
-			t.Logger.Printf("getnext: oid=%v. skip for non walkable\n", item.OID)
-			iid += 1
-			continue // skip non-walkable items
+	values := t.fetchBatch(items, i, scope)
+	for id, varItem := range i.Variables {
+		item := items[id]
+		if item == nil {
+			logger.Debug("getnext end of mib view", "oid", varItem.Name)
+			ret.Variables = append(ret.Variables, t.getPDUEndOfMibView(varItem.Name))
+			continue
 		}
-		ctl, snmperr := t.getForPDUValueControlResult(item, i)
+		ctl, snmperr := t.getForPDUValueControlResult(item, i, scope, values)
 		if snmperr != gosnmp.NoError && ret.Error == gosnmp.NoError {
-			ret.Error = snmperr
-			ret.ErrorIndex = uint8(iid)
+			setErrorStatus(&ret, snmperr, id+1)
 		}
-		t.Logger.Printf("getnext: append oid=%v. result=%v err=%v\n", item.OID, ctl, snmperr)
+		logger.Debug("getnext", "oid", varItem.Name, "next", item.OID, "error", snmperr.String())
 		ret.Variables = append(ret.Variables, ctl)
-		iid += 1
 	}
-
-	if len(ret.Variables) == 0 {
-		// NOT find for the last
-		ret.Variables = append(ret.Variables, t.getPDUEndOfMibView(queryForOid))
-	}
-
 	return &ret, nil
 }
 
 // serveSetRequest for SetRequest.
 //
 //	will just Return GetResponse for SUCCESS
-func (t *SubAgent) serveSetRequest(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+func (t *SubAgent) serveSetRequest(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
 	var ret gosnmp.SnmpPacket = copySnmpPacket(i)
 	ret.PDUType = gosnmp.GetResponse
 	ret.Variables = []gosnmp.SnmpPDU{}
+	if len(i.Variables) > math.MaxUint8 {
+		// an error beyond the 255th varbind could only be answered tooBig, once the others were set.
+		// Nothing is set, so the manager may retry with fewer varbinds.
+		for _, varItem := range i.Variables {
+			scope.auditSet(varItem, nil, gosnmp.TooBig, nil)
+		}
+		setErrorStatus(&ret, gosnmp.TooBig, 0)
+		return &ret, nil
+	}
 	for id, varItem := range i.Variables {
-		item, _ := t.getForPDUValueControl(varItem.Name)
+		item := t.getForPDUValueControl(varbindOID(varItem))
 		if item == nil {
 			if ret.Error == gosnmp.NoError {
-				ret.Error = gosnmp.NoSuchName
-				ret.ErrorIndex = uint8(id)
+				setErrorStatus(&ret, gosnmp.NoSuchName, id+1)
 			}
 			ret.Variables = append(ret.Variables, t.getPDUNoSuchInstance(varItem.Name))
+			scope.auditSet(varItem, nil, gosnmp.NoSuchName, nil)
 			continue
 		}
-		if t.checkPermission(item, i) != PermissionAllowanceAllowed {
+		if !scope.writable() || !scope.inView(item.oid) || t.checkPermission(item, i, scope) != PermissionAllowanceAllowed {
 			if ret.Error == gosnmp.NoError {
-				ret.Error = gosnmp.NoAccess
-				ret.ErrorIndex = uint8(id)
+				setErrorStatus(&ret, gosnmp.NoAccess, id+1)
 			}
 			ret.Variables = append(ret.Variables, t.getPDUNil(varItem.Name))
+			scope.auditSet(varItem, nil, gosnmp.NoAccess, nil)
 			continue
 		}
+		previous := t.previousValue(item, scope)
 		if item.OnSet == nil {
 			if ret.Error == gosnmp.NoError {
-				ret.Error = gosnmp.ReadOnly
-				ret.ErrorIndex = uint8(id)
+				setErrorStatus(&ret, gosnmp.ReadOnly, id+1)
 			}
 			ret.Variables = append(ret.Variables, t.getPDUNil(varItem.Name))
+			scope.auditSet(varItem, previous, gosnmp.ReadOnly, nil)
 			continue
 		}
 		func() {
+			span := t.callbackSpan(scope, "OnSet", item)
+			defer func() { span.end(ret.Error) }()
 			defer func() {
 				// panic in onset
 				if err := recover(); err != nil {
+					span.RecordError(fmt.Errorf("panic: %+v", err))
+					scope.auditSet(varItem, previous, gosnmp.GenErr, fmt.Errorf("panic: %+v", err))
 					if t.UserErrorMarkPacket && ret.Error == gosnmp.NoError {
-						ret.Error = gosnmp.GenErr
-						ret.ErrorIndex = uint8(id)
+						setErrorStatus(&ret, gosnmp.GenErr, id+1)
 					}
 					ret.Variables = append(ret.Variables,
 						t.getPDUOctetString(varItem.Name, fmt.Sprintf("ERROR: %+v", err)))
 				}
 			}()
 			if err := item.OnSet(varItem.Value); err != nil {
+				span.RecordError(err)
+				scope.auditSet(varItem, previous, gosnmp.GenErr, err)
 				if t.UserErrorMarkPacket && ret.Error == gosnmp.NoError {
-					ret.Error = gosnmp.GenErr
-					ret.ErrorIndex = uint8(id)
+					setErrorStatus(&ret, gosnmp.GenErr, id+1)
 				}
 				ret.Variables = append(ret.Variables,
 					t.getPDUOctetString(varItem.Name, fmt.Sprintf("ERROR: %+v", err)))
 				return
 			} else {
+				item.InvalidateCache()
 				ret.Variables = append(ret.Variables, varItem)
+				scope.auditSet(varItem, previous, gosnmp.NoError, nil)
 			}
 		}()
 
@@ -484,23 +615,41 @@ func (t *SubAgent) serveSetRequest(i *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, er
 	return &ret, nil
 }
 
-// The subagent mutex lock should be held when this is called
-func (t *SubAgent) getForPDUValueControl(oid string) (*PDUValueControlItem, int) {
+// isWalkable reports if item could be returned by GetNext / GetBulk
+func (t *SubAgent) isWalkable(item *PDUValueControlItem, scope *requestScope) bool {
+	if scope != nil && scope.skipCounter64 && item.Type == gosnmp.Counter64 {
+		return false
+	}
+	return !item.NonWalkable && item.readable() && scope.inView(item.oid)
+}
+
+// successorOf returns the first walkable item after oid. nil if none.
+func (t *SubAgent) successorOf(oid OID, scope *requestScope) *PDUValueControlItem {
+	if oid == nil {
+		return nil
+	}
 	t.RLock()
 	defer t.RUnlock()
-	toQuery := oidToByteString(oid)
-	i := sort.Search(len(t.OIDs), func(i int) bool {
-		thisOid := oidToByteString(t.OIDs[i].OID)
-		compareResult := compareByteString(thisOid, toQuery)
-		// thisOid >= toQuery
-		return compareResult == ByteStringCompareResultGreaterThen || compareResult == ByteStringCompareResultEqual
+	return t.registry.successor(oid, func(item *PDUValueControlItem) bool {
+		return t.isWalkable(item, scope)
 	})
+}
 
-	if i < len(t.OIDs) {
-		// t.OIDs[i].OID == toQuery
-		if compareByteString(oidToByteString(t.OIDs[i].OID), toQuery) == ByteStringCompareResultEqual {
-			return t.OIDs[i], i
-		}
+// getForPDUValueControl returns the item registered at oid. nil if none.
+func (t *SubAgent) getForPDUValueControl(oid OID) *PDUValueControlItem {
+	if oid == nil {
+		return nil
+	}
+	t.RLock()
+	defer t.RUnlock()
+	return t.registry.get(oid)
+}
+
+// varbindOID parses the name of a varbind. nil if malformed, which matches no item.
+func varbindOID(pdu gosnmp.SnmpPDU) OID {
+	oid, err := ParseOID(pdu.Name)
+	if err != nil {
+		return nil
 	}
-	return nil, i
+	return oid
 }
@@ -0,0 +1,196 @@
+package GoSNMPServer
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// conformanceTree is a random tree with its reference walks, each the sorted
+// list of OIDs GetNext should go through.
+type conformanceTree struct {
+	items   []*PDUValueControlItem
+	walk    []OID // for SNMPv2c / v3
+	walkV1  []OID // without Counter64 objects
+	queries []OID
+}
+
+func newConformanceTree(seed int64, size int) *conformanceTree {
+	random := rand.New(rand.NewSource(seed))
+	randomOID := func() OID {
+		oid := OID{1, 3, 6, 1, 4, 1, 99}
+		for depth := random.Intn(5); depth >= 0; depth-- {
+			oid = append(oid, uint32(random.Intn(6)))
+		}
+		return oid
+	}
+	ret := new(conformanceTree)
+	seen := make(map[string]bool)
+	for len(ret.items) < size {
+		oid := randomOID()
+		if seen[oid.String()] {
+			continue
+		}
+		seen[oid.String()] = true
+		item := stringOIDs(oid.String())[0]
+		switch id := len(ret.items); {
+		case id%7 == 0:
+			item.NonWalkable = true
+		case id%11 == 0:
+			item.OnGet = nil
+		case id%5 == 0:
+			item.Type = gosnmp.Counter64
+			item.OnGet = func() (interface{}, error) { return uint64(1) << 40, nil }
+		}
+		ret.items = append(ret.items, item)
+		ret.queries = append(ret.queries, oid)
+		if item.NonWalkable || item.OnGet == nil {
+			continue
+		}
+		ret.walk = append(ret.walk, oid)
+		if item.Type != gosnmp.Counter64 {
+			ret.walkV1 = append(ret.walkV1, oid)
+		}
+	}
+	for _, walk := range [][]OID{ret.walk, ret.walkV1} {
+		sort.Slice(walk, func(i, j int) bool { return walk[i].Compare(walk[j]) < 0 })
+	}
+	// OIDs between, before and after the registered ones
+	for id := 0; id < size; id++ {
+		ret.queries = append(ret.queries, randomOID())
+	}
+	ret.queries = append(ret.queries, OID{0, 0}, OID{1, 3}, OID{1, 3, 6, 1, 4, 1, 99}, OID{1, 3, 6, 1, 4, 1, 99, 5, 5, 5, 5, 5, 5}, OID{2, 0})
+	return ret
+}
+
+// successor returns the first OID of walk after oid. nil for endOfMibView
+func successor(walk []OID, oid OID) OID {
+	id := sort.Search(len(walk), func(i int) bool { return walk[i].Compare(oid) > 0 })
+	if id == len(walk) {
+		return nil
+	}
+	return walk[id]
+}
+
+func (c *conformanceTree) master(t *testing.T) MasterAgent {
+	master := MasterAgent{AllowedVersion: SNMPV1 | SNMPV2c, SubAgents: []*SubAgent{{OIDs: c.items}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+func TestGetNextConformance(t *testing.T) {
+	tree := newConformanceTree(1, 400)
+	master := tree.master(t)
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		walk := tree.walk
+		if version == gosnmp.Version1 {
+			walk = tree.walkV1
+		}
+		// several varbinds per request, each answered independently
+		for start := 0; start < len(tree.queries); start += 5 {
+			end := min(start+5, len(tree.queries))
+			request := &gosnmp.SnmpPacket{Version: version, Community: "public", PDUType: gosnmp.GetNextRequest}
+			for _, oid := range tree.queries[start:end] {
+				request.Variables = append(request.Variables, gosnmp.SnmpPDU{Name: "." + oid.String(), Type: gosnmp.Null})
+			}
+			scope := &requestScope{skipCounter64: version == gosnmp.Version1}
+			res, err := master.SubAgents[0].serve(request, scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Error != gosnmp.NoError || len(res.Variables) != len(request.Variables) {
+				t.Fatalf("%v: error %v with %d varbinds for %d", version, res.Error, len(res.Variables), len(request.Variables))
+			}
+			for id, oid := range tree.queries[start:end] {
+				got, expected := res.Variables[id], successor(walk, oid)
+				if expected == nil {
+					if got.Type != gosnmp.EndOfMibView || strings.TrimPrefix(got.Name, ".") != oid.String() {
+						t.Errorf("%v GetNext %v: %v %v, expected endOfMibView", version, oid, got.Name, got.Type)
+					}
+					continue
+				}
+				if got.Name != expected.String() || got.Type == gosnmp.EndOfMibView {
+					t.Errorf("%v GetNext %v: %v %v, expected %v", version, oid, got.Name, got.Type, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestWalkConformance(t *testing.T) {
+	tree := newConformanceTree(2, 200)
+	_, port := serveUDP(t, tree.master(t))
+	walks := []struct {
+		version gosnmp.SnmpVersion
+		bulk    bool
+		walk    []OID
+	}{
+		{gosnmp.Version1, false, tree.walkV1},
+		{gosnmp.Version2c, false, tree.walk},
+		{gosnmp.Version2c, true, tree.walk},
+	}
+	for _, each := range walks {
+		client := communityClient(t, port, each.version, "public")
+		walkAll := client.WalkAll
+		if each.bulk {
+			walkAll = client.BulkWalkAll
+		}
+		got, err := walkAll("1.3.6.1.4.1.99")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(each.walk) {
+			t.Fatalf("%v bulk=%v: walked %d OIDs, expected %d", each.version, each.bulk, len(got), len(each.walk))
+		}
+		for id, oid := range each.walk {
+			if got[id].Name != "."+oid.String() {
+				t.Errorf("%v bulk=%v: walked %v at %d, expected %v", each.version, each.bulk, got[id].Name, id, oid)
+				break
+			}
+		}
+	}
+}
+
+func TestGetBulkEndOfMibView(t *testing.T) {
+	master := MasterAgent{SubAgents: []*SubAgent{{OIDs: stringOIDs(
+		"1.3.6.1.4.1.2.1.1", "1.3.6.1.4.1.2.1.2", "1.3.6.1.4.1.2.1.3", "1.3.6.1.4.1.2.1.4")}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	for _, each := range []struct {
+		maxRepetitions uint32
+		// expected lists the varbinds, "!" marking endOfMibView
+		expected string
+	}{
+		// the first repeater ends early, and keeps its column
+		{4, "2.1.3 2.1.1 2.1.4 2.1.2 !2.1.4 2.1.3 !2.1.4 2.1.4"},
+		// once both ended, repetitions stop
+		{10, "2.1.3 2.1.1 2.1.4 2.1.2 !2.1.4 2.1.3 !2.1.4 2.1.4 !2.1.4 !2.1.4"},
+	} {
+		request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "public", PDUType: gosnmp.GetBulkRequest,
+			MaxRepetitions: each.maxRepetitions, Variables: []gosnmp.SnmpPDU{
+				{Name: "1.3.6.1.4.1.2.1.2", Type: gosnmp.Null},
+				{Name: "1.3.6.1.4.1.2.1.0", Type: gosnmp.Null},
+			}}
+		res, err := master.SubAgents[0].Serve(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pdu := range res.Variables {
+			name := strings.TrimPrefix(strings.TrimPrefix(pdu.Name, "."), "1.3.6.1.4.1.")
+			if pdu.Type == gosnmp.EndOfMibView {
+				name = "!" + name
+			}
+			got = append(got, name)
+		}
+		if res.Error != gosnmp.NoError || strings.Join(got, " ") != each.expected {
+			t.Errorf("max-repetitions %d: %v %v, expected %v", each.maxRepetitions, res.Error, got, each.expected)
+		}
+	}
+}
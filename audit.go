@@ -0,0 +1,188 @@
+package GoSNMPServer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Values of AuditRecord.Outcome
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditRecord describes one varbind of a SET request
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Peer is the address of the manager. Empty when unknown
+	Peer string `json:"peer,omitempty"`
+	// PeerUID is the local user of the manager, over Unix sockets. nil when unknown
+	PeerUID *uint32 `json:"peer_uid,omitempty"`
+	// SecurityName is the community (SNMPv1/v2c) or the user (SNMPv3)
+	SecurityName string `json:"security_name"`
+	Context      string `json:"context"`
+	OID          string `json:"oid"`
+	Type         string `json:"type"`
+	// Previous is the value before the SET, read through OnGet / Provider. nil if it could not be read
+	Previous interface{} `json:"previous,omitempty"`
+	Value    interface{} `json:"value"`
+	// Outcome is AuditSuccess or AuditFailure, Error telling why it failed
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AuditSink receives a record for each varbind of each SET request, whether it succeeds or fails.
+//
+//	Records are written while serving the request, Audit should not block.
+type AuditSink interface {
+	Audit(record AuditRecord) error
+}
+
+// JSONLinesAuditSink writes records as JSON lines
+type JSONLinesAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONLinesAuditSink appends records to file path, created if needed.
+func NewJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{w: file, closer: file}, nil
+}
+
+// NewJSONLinesAuditWriter writes records to w
+func NewJSONLinesAuditWriter(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// Audit writes record as one line
+func (s *JSONLinesAuditSink) Audit(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file opened by NewJSONLinesAuditSink
+func (s *JSONLinesAuditSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// InMemoryAuditSink keeps records in memory, for tests.
+type InMemoryAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+// Audit keeps record
+func (s *InMemoryAuditSink) Audit(record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Records returns the records kept, in order
+func (s *InMemoryAuditSink) Records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditRecord(nil), s.records...)
+}
+
+// Reset drops the records kept
+func (s *InMemoryAuditSink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = nil
+}
+
+// auditSet sends the record of varItem to the audit sink of the request, if any.
+//
+//	errret / err describe the failure, NoError and nil for success.
+func (s *requestScope) auditSet(varItem gosnmp.SnmpPDU, previous interface{}, errret gosnmp.SNMPError, err error) {
+	if s == nil || s.audit == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:         time.Now(),
+		SecurityName: s.securityName,
+		Context:      s.contextName,
+		OID:          varItem.Name,
+		Type:         varItem.Type.String(),
+		Previous:     auditValue(previous),
+		Value:        auditValue(varItem.Value),
+		Outcome:      AuditSuccess,
+	}
+	if s.info != nil && s.info.Peer != nil {
+		record.Peer = s.info.Peer.String()
+	}
+	if credentials := s.info.credentials(); credentials != nil {
+		uid := credentials.UID
+		record.PeerUID = &uid
+	}
+	if errret != gosnmp.NoError || err != nil {
+		record.Outcome = AuditFailure
+		record.Error = errret.String()
+		if err != nil {
+			record.Error = fmt.Sprintf("%v: %v", errret, err)
+		}
+	}
+	if err := s.audit.Audit(record); err != nil {
+		s.loggerOr(slog.Default()).Warn("audit failed", "oid", varItem.Name, "err", err)
+	}
+}
+
+// auditValue makes value readable once encoded: octet strings become text, or hex when not UTF-8
+func auditValue(value interface{}) interface{} {
+	if data, ok := value.([]byte); ok {
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		return hex.EncodeToString(data)
+	}
+	return value
+}
+
+// previousValue reads the value of item before a SET, bypassing its cache. nil if it could not be read
+func (t *SubAgent) previousValue(item *PDUValueControlItem, scope *requestScope) (value interface{}) {
+	if scope == nil || scope.audit == nil || !item.readable() {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			value = nil
+		}
+	}()
+	if item.Provider != nil {
+		results, err := t.callProvider(item.Provider, []*PDUValueControlItem{item})
+		if err != nil || results[0].Err != nil {
+			return nil
+		}
+		return results[0].Value
+	}
+	value, err := item.OnGet()
+	if err != nil {
+		return nil
+	}
+	return value
+}
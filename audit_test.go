@@ -0,0 +1,139 @@
+package GoSNMPServer
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+func auditTestItems() []*PDUValueControlItem {
+	items := stringOIDs("1.3.6.1.4.1.77.1", "1.3.6.1.4.1.77.2", "1.3.6.1.4.1.77.3")
+	value := "old"
+	items[0].OnGet = func() (interface{}, error) { return value, nil }
+	items[0].OnSet = func(v interface{}) error {
+		value = string(v.([]byte))
+		return nil
+	}
+	items[1].OnSet = func(interface{}) error { return errors.New("backend down") }
+	items[2].OnSet = nil
+	return items
+}
+
+func TestAuditSet(t *testing.T) {
+	sink := new(InMemoryAuditSink)
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		AuditSink:      sink,
+		SecurityConfig: SecurityConfig{CommunityACLs: []CommunityACL{
+			{Community: "private", ReadWrite: true},
+			{Community: "public"},
+		}},
+		SubAgents: []*SubAgent{{OIDs: auditTestItems()}},
+	}
+	_, port := serveUDP(t, master)
+	set := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.4.1.77.1", Type: gosnmp.OctetString, Value: "new"},
+		{Name: ".1.3.6.1.4.1.77.2", Type: gosnmp.OctetString, Value: "new"},
+		{Name: ".1.3.6.1.4.1.77.3", Type: gosnmp.OctetString, Value: "new"},
+		{Name: ".1.3.6.1.4.1.77.9", Type: gosnmp.OctetString, Value: "new"},
+	}
+	if _, err := communityClient(t, port, gosnmp.Version2c, "private").Set(set); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		oid      string
+		previous interface{}
+		outcome  string
+		error    string
+	}{
+		{".1.3.6.1.4.1.77.1", "old", AuditSuccess, ""},
+		{".1.3.6.1.4.1.77.2", "v1.3.6.1.4.1.77.2", AuditFailure, "GenErr: backend down"},
+		{".1.3.6.1.4.1.77.3", "v1.3.6.1.4.1.77.3", AuditFailure, "ReadOnly"},
+		{".1.3.6.1.4.1.77.9", nil, AuditFailure, "NoSuchName"},
+	}
+	records := sink.Records()
+	if len(records) != len(expected) {
+		t.Fatalf("%d records for %d varbinds", len(records), len(expected))
+	}
+	for id, record := range records {
+		e := expected[id]
+		if record.OID != e.oid || record.Previous != e.previous || record.Outcome != e.outcome || record.Error != e.error {
+			t.Errorf("record %d: %+v", id, record)
+		}
+		if record.SecurityName != "private" || record.Value != "new" || record.Type != "OctetString" ||
+			!strings.HasPrefix(record.Peer, "127.0.0.1:") || record.Time.IsZero() {
+			t.Errorf("record %d: %+v", id, record)
+		}
+	}
+
+	// refused by the community
+	sink.Reset()
+	if _, err := communityClient(t, port, gosnmp.Version2c, "public").Set(set[:1]); err != nil {
+		t.Fatal(err)
+	}
+	records = sink.Records()
+	if len(records) != 1 || records[0].Outcome != AuditFailure || records[0].Error != "NoAccess" || records[0].SecurityName != "public" {
+		t.Errorf("records of a read-only community %+v", records)
+	}
+}
+
+func TestAuditNotSet(t *testing.T) {
+	sink := new(InMemoryAuditSink)
+	_, port := serveUDP(t, MasterAgent{AllowedVersion: SNMPV2c, AuditSink: sink, SubAgents: []*SubAgent{{OIDs: auditTestItems()}}})
+	if _, err := communityClient(t, port, gosnmp.Version2c, "public").Get([]string{"1.3.6.1.4.1.77.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if records := sink.Records(); len(records) != 0 {
+		t.Errorf("GET audited: %+v", records)
+	}
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, value := range []interface{}{[]byte("text"), []byte{0xff, 0x00}} {
+		sink, err := NewJSONLinesAuditSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Audit(AuditRecord{OID: ".1.3.6.1.4.1.77.1", Value: auditValue(value), Outcome: AuditSuccess}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Errorf("audit file mode %v", stat.Mode())
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var values []interface{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(lines.Bytes(), &record); err != nil {
+			t.Fatalf("%v: %s", err, lines.Text())
+		}
+		if _, ok := record["previous"]; ok {
+			t.Errorf("nil previous encoded: %s", lines.Text())
+		}
+		values = append(values, record["value"])
+	}
+	// appended, octet strings as text or hex
+	if len(values) != 2 || values[0] != "text" || values[1] != "ff00" {
+		t.Errorf("values %v", values)
+	}
+}
@@ -0,0 +1,139 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// BatchValue is the value of one OID returned by a BatchValueProvider.
+//
+//	Err fails this OID only, as an error returned by OnGet does.
+type BatchValue struct {
+	Value interface{}
+	Err   error
+}
+
+// BatchValueProvider returns the values of many OIDs in one call, e.g. a table row or a
+// whole table from one backend RPC. Set it as PDUValueControlItem.Provider on each item it serves.
+// Items are grouped by provider, so it should be comparable, e.g. a pointer.
+//
+//	GetValues receives the OIDs (PDUValueControlItem.OID) needed by one request, in OID order,
+//	and returns their values in the same order. An error fails all of them.
+type BatchValueProvider interface {
+	GetValues(oids []string) ([]BatchValue, error)
+}
+
+// FuncBatchValueProvider is the function form of BatchValueProvider. See NewFuncBatchValueProvider
+type FuncBatchValueProvider func(oids []string) ([]BatchValue, error)
+
+type funcBatchValueProvider struct {
+	fn FuncBatchValueProvider
+}
+
+func (p *funcBatchValueProvider) GetValues(oids []string) ([]BatchValue, error) {
+	return p.fn(oids)
+}
+
+// NewFuncBatchValueProvider returns a BatchValueProvider calling fn.
+//
+//	Share the returned provider between items, so they are read together.
+func NewFuncBatchValueProvider(fn FuncBatchValueProvider) BatchValueProvider {
+	return &funcBatchValueProvider{fn: fn}
+}
+
+// verifyProvider checks that items could be grouped by provider
+func verifyProvider(provider BatchValueProvider) error {
+	if provider != nil && !reflect.TypeOf(provider).Comparable() {
+		return errors.Errorf("batch provider %T is not comparable, use a pointer", provider)
+	}
+	return nil
+}
+
+// batchValues holds values fetched from BatchValueProviders for one request
+type batchValues map[*PDUValueControlItem]BatchValue
+
+// fetchBatch calls the provider of items once per provider.
+//
+//	items without Provider, or which could not be read by the request, are skipped.
+func (t *SubAgent) fetchBatch(items []*PDUValueControlItem, i *gosnmp.SnmpPacket, scope *requestScope) batchValues {
+	values := make(batchValues)
+	var providers []BatchValueProvider
+	groups := make(map[BatchValueProvider][]*PDUValueControlItem)
+	for _, item := range items {
+		if item == nil || item.Provider == nil || t.checkPermission(item, i, scope) != PermissionAllowanceAllowed {
+			continue
+		}
+		if _, found := values[item]; found {
+			continue
+		}
+		values[item] = BatchValue{}
+		if _, found := groups[item.Provider]; !found {
+			providers = append(providers, item.Provider)
+		}
+		groups[item.Provider] = append(groups[item.Provider], item)
+	}
+	for _, provider := range providers {
+		group := groups[provider]
+		sortItemsByOID(group)
+		span := scope.span("snmp.callback", Attr("snmp.callback", "BatchValueProvider.GetValues"),
+			Attr("snmp.oid", group[0].OID), Attr("snmp.oids", len(group)))
+		results, err := t.callProvider(provider, group)
+		span.RecordError(err)
+		span.End()
+		for id, item := range group {
+			if err != nil {
+				values[item] = BatchValue{Err: err}
+			} else {
+				values[item] = results[id]
+			}
+		}
+	}
+	return values
+}
+
+// callProvider calls provider.GetValues for items and checks the results
+func (t *SubAgent) callProvider(provider BatchValueProvider, items []*PDUValueControlItem) (results []BatchValue, err error) {
+	defer func() {
+		// panic in provider
+		if recovered := recover(); recovered != nil {
+			results, err = nil, fmt.Errorf("%+v", recovered)
+		}
+	}()
+	oids := make([]string, len(items))
+	for id, item := range items {
+		oids[id] = item.OID
+	}
+	t.logger.Debug("batch provider", "oids", len(oids))
+	results, err = provider.GetValues(oids)
+	if err == nil && len(results) != len(oids) {
+		err = errors.Errorf("batch provider returns %v values for %v oids", len(results), len(oids))
+	}
+	return results, err
+}
+
+// readValue reads the value of item from values, or from its Provider / OnGet
+func (t *SubAgent) readValue(item *PDUValueControlItem, values batchValues) (interface{}, error) {
+	if item.Provider == nil {
+		return t.onGet(item)
+	}
+	result, found := values[item]
+	if !found {
+		results, err := t.callProvider(item.Provider, []*PDUValueControlItem{item})
+		if err != nil {
+			return nil, err
+		}
+		result = results[0]
+	}
+	return result.Value, result.Err
+}
+
+// sortItemsByOID sorts registered items in OID order
+func sortItemsByOID(items []*PDUValueControlItem) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].oid.Compare(items[j].oid) < 0
+	})
+}
@@ -0,0 +1,215 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// recordingProvider values each OID "<name>:<oid>", recording the OIDs of each call
+type recordingProvider struct {
+	name string
+	// fail, if any, replaces the values returned
+	fail func(oids []string) ([]BatchValue, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *recordingProvider) GetValues(oids []string) ([]BatchValue, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, strings.Join(oids, " "))
+	p.mu.Unlock()
+	if p.fail != nil {
+		return p.fail(oids)
+	}
+	values := make([]BatchValue, len(oids))
+	for id, oid := range oids {
+		values[id].Value = p.name + ":" + oid
+	}
+	return values, nil
+}
+
+// takeCalls returns the calls since the last one, "|" separated
+func (p *recordingProvider) takeCalls() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	calls := strings.Join(p.calls, "|")
+	p.calls = nil
+	return calls
+}
+
+// provided returns items of oids read by provider
+func provided(provider BatchValueProvider, oids ...string) []*PDUValueControlItem {
+	items := stringOIDs(oids...)
+	for _, item := range items {
+		item.OnGet, item.Provider = nil, provider
+	}
+	return items
+}
+
+// batchTestTable returns the cells of a table of 2 columns and 3 rows under 1.3.6.1.4.1.5.1
+func batchTestTable() []string {
+	var oids []string
+	for column := 1; column <= 2; column++ {
+		for row := 1; row <= 3; row++ {
+			oids = append(oids, fmt.Sprintf("1.3.6.1.4.1.5.1.%d.%d", column, row))
+		}
+	}
+	return oids
+}
+
+// pduValues returns the string values of pdus
+func pduValues(pdus []gosnmp.SnmpPDU) string {
+	values := make([]string, len(pdus))
+	for id, pdu := range pdus {
+		value, _ := pdu.Value.([]byte)
+		values[id] = string(value)
+		if pdu.Type == gosnmp.EndOfMibView {
+			values[id] = "!"
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func TestBatchProviderCalledOnce(t *testing.T) {
+	table := &recordingProvider{name: "t"}
+	cells := batchTestTable()
+	master := MasterAgent{AllowedVersion: SNMPV2c, SubAgents: []*SubAgent{{OIDs: provided(table, cells...)}}}
+	_, port := serveUDP(t, master)
+	client := communityClient(t, port, gosnmp.Version2c, "public")
+
+	// values are returned in the order of the request, the provider is given the OIDs in OID order
+	response, err := client.Get([]string{cells[4], cells[0], cells[3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("t:%s t:%s t:%s", cells[4], cells[0], cells[3])
+	if response.Error != gosnmp.NoError || pduValues(response.Variables) != expected {
+		t.Errorf("Get: %v %v, expected %v", response.Error, pduValues(response.Variables), expected)
+	}
+	if calls := table.takeCalls(); calls != strings.Join([]string{cells[0], cells[3], cells[4]}, " ") {
+		t.Errorf("Get called %v", calls)
+	}
+
+	// GetBulk over both columns: rows in repetitions
+	response, err = client.GetBulk([]string{"1.3.6.1.4.1.5.1.1", "1.3.6.1.4.1.5.1.2"}, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	for row := 0; row < 3; row++ {
+		rows = append(rows, "t:"+cells[row], "t:"+cells[3+row])
+	}
+	expected = strings.Join(rows, " ") + " t:" + cells[3] + " !"
+	if response.Error != gosnmp.NoError || pduValues(response.Variables) != expected {
+		t.Errorf("GetBulk: %v %v, expected %v", response.Error, pduValues(response.Variables), expected)
+	}
+	if calls := table.takeCalls(); calls != strings.Join(cells, " ") {
+		t.Errorf("GetBulk called %v", calls)
+	}
+}
+
+func TestBatchProviderGroups(t *testing.T) {
+	first, second := &recordingProvider{name: "a"}, &recordingProvider{name: "b"}
+	var items []*PDUValueControlItem
+	items = append(items, provided(first, "1.3.6.1.4.1.5.1.1", "1.3.6.1.4.1.5.3.1")...)
+	items = append(items, provided(second, "1.3.6.1.4.1.5.2.1", "1.3.6.1.4.1.5.2.2")...)
+	items = append(items, stringOIDs("1.3.6.1.4.1.5.1.2", "1.3.6.1.4.1.5.4.1")...)
+	master := MasterAgent{AllowedVersion: SNMPV2c, SubAgents: []*SubAgent{{OIDs: items}}}
+	_, port := serveUDP(t, master)
+	oids := []string{"1.3.6.1.4.1.5.2.2", "1.3.6.1.4.1.5.1.2", "1.3.6.1.4.1.5.3.1", "1.3.6.1.4.1.5.2.1",
+		"1.3.6.1.4.1.5.4.1", "1.3.6.1.4.1.5.1.1"}
+	response, err := communityClient(t, port, gosnmp.Version2c, "public").Get(oids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "b:1.3.6.1.4.1.5.2.2 v1.3.6.1.4.1.5.1.2 a:1.3.6.1.4.1.5.3.1 b:1.3.6.1.4.1.5.2.1 " +
+		"v1.3.6.1.4.1.5.4.1 a:1.3.6.1.4.1.5.1.1"
+	if response.Error != gosnmp.NoError || pduValues(response.Variables) != expected {
+		t.Errorf("Get: %v %v, expected %v", response.Error, pduValues(response.Variables), expected)
+	}
+	for _, each := range []struct {
+		provider *recordingProvider
+		expected string
+	}{
+		{first, "1.3.6.1.4.1.5.1.1 1.3.6.1.4.1.5.3.1"},
+		{second, "1.3.6.1.4.1.5.2.1 1.3.6.1.4.1.5.2.2"},
+	} {
+		if calls := each.provider.takeCalls(); calls != each.expected {
+			t.Errorf("provider %s called %v, expected once with %v", each.provider.name, calls, each.expected)
+		}
+	}
+}
+
+func TestBatchProviderErrors(t *testing.T) {
+	for name, fail := range map[string]func(oids []string) ([]BatchValue, error){
+		"error":  func([]string) ([]BatchValue, error) { return nil, errors.New("backend down") },
+		"length": func([]string) ([]BatchValue, error) { return []BatchValue{{Value: "x"}}, nil },
+		"panic":  func([]string) ([]BatchValue, error) { panic("backend panic") },
+	} {
+		failing := &recordingProvider{name: "f", fail: fail}
+		items := append(stringOIDs("1.3.6.1.4.1.5.1.1"), provided(failing, "1.3.6.1.4.1.5.2.1", "1.3.6.1.4.1.5.2.2")...)
+		master := MasterAgent{SubAgents: []*SubAgent{{OIDs: items, UserErrorMarkPacket: true}}}
+		if err := master.ReadyForWork(); err != nil {
+			t.Fatal(err)
+		}
+		for _, pduType := range []gosnmp.PDUType{gosnmp.GetRequest, gosnmp.GetNextRequest} {
+			request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "public", PDUType: pduType,
+				Variables: []gosnmp.SnmpPDU{
+					{Name: "1.3.6.1.4.1.5.1.1", Type: gosnmp.Null},
+					{Name: "1.3.6.1.4.1.5.2.2", Type: gosnmp.Null},
+					{Name: "1.3.6.1.4.1.5.2.1", Type: gosnmp.Null},
+				}}
+			if pduType == gosnmp.GetNextRequest {
+				// successors of 1.3.6.1.4.1.5.1.1, of 1.3.6.1.4.1.5.2.1 and of 1.3.6.1.4.1.5.2
+				request.Variables[0].Name, request.Variables[1].Name, request.Variables[2].Name =
+					"1.3.6.1.4.1.5.1", "1.3.6.1.4.1.5.2.1", "1.3.6.1.4.1.5.2"
+			}
+			response, err := master.SubAgents[0].Serve(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := failing.takeCalls()
+			if response.Error != gosnmp.GenErr || response.ErrorIndex != 2 || calls == "" || strings.Contains(calls, "|") {
+				t.Errorf("%s %v: %v at %d, called %v", name, pduType, response.Error, response.ErrorIndex, calls)
+			}
+		}
+	}
+}
+
+func TestBatchProviderWalk(t *testing.T) {
+	table, other := &recordingProvider{name: "t"}, &recordingProvider{name: "o"}
+	cells := batchTestTable()
+	items := append(provided(table, cells...), provided(other, "1.3.6.1.4.1.5.2.1", "1.3.6.1.4.1.6.1")...)
+	master := MasterAgent{AllowedVersion: SNMPV2c, SubAgents: []*SubAgent{{OIDs: items}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	walks := map[string]func(fn WalkFunc) error{
+		"SubAgent": func(fn WalkFunc) error { return master.SubAgents[0].Walk("1.3.6.1.4.1.5.1", fn) },
+		"MasterAgent": func(fn WalkFunc) error {
+			return master.Walk("public", "1.3.6.1.4.1.5.1", fn)
+		},
+	}
+	for name, walk := range walks {
+		var walked []gosnmp.SnmpPDU
+		if err := walk(func(pdu gosnmp.SnmpPDU) error {
+			walked = append(walked, pdu)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if pduNames(walked) != strings.Join(cells, " ") {
+			t.Errorf("%s walked %v", name, pduNames(walked))
+		}
+		// once for the subtree, its successors not read
+		if calls, others := table.takeCalls(), other.takeCalls(); calls != strings.Join(cells, " ") || others != "" {
+			t.Errorf("%s walk called %v, then %v", name, calls, others)
+		}
+	}
+}
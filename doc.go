@@ -1,7 +1,7 @@
 /*
 GoSNMPServer is an SNMP server library fully written in Go. It **WILL** provides Server Get,
 GetNext, GetBulk, Walk, BulkWalk, Set and Traps. It supports IPv4 and
-IPv6, using __SNMPv2c__ or __SNMPv3__. Builds are tested against
+IPv6, using __SNMPv1__, __SNMPv2c__ or __SNMPv3__. Builds are tested against
 linux/amd64 and linux/386.
 
 Build your own SNMP Server, try this:
@@ -17,8 +17,9 @@ Some Code Here:
 	import "github.com/eriksejr/GoSNMPServer/mibImps"
 
 
+	logger := GoSNMPServer.NewDefaultLogger()
 	master := GoSNMPServer.MasterAgent{
-		Logger: GoSNMPServer.NewDefaultLogger(),
+		StructuredLogger: logger,
 		SecurityConfig: GoSNMPServer.SecurityConfig{
 			AuthoritativeEngineBoots: 1,
 			Users: []gosnmp.UsmSecurityParameters{
@@ -41,7 +42,7 @@ Some Code Here:
 	server := GoSNMPServer.NewSNMPServer(master)
 	err := server.ListenUDP("udp", "127.0.0.1:1161")
 	if err != nil {
-		logger.Errorf("Error in listen: %+v", err)
+		logger.Error("Error in listen", "err", err)
 	}
 	server.ServeForever()
 
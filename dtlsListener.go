@@ -0,0 +1,86 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/protocol"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+	"github.com/pion/logging"
+	"github.com/pion/transport/v2/udp"
+	"github.com/pkg/errors"
+)
+
+// NewDTLSListener listens for SNMP over DTLS (RFC6353) on a UDP address, each DTLS record holding one
+// message. Managers shall present a certificate, mapped to a tmSecurityName by SecurityConfig.CertToNames.
+//
+//	config shall hold the certificate of the agent in Certificates; GetCertificate is not supported.
+//	Client certificates are always required. Their chain is verified against config.ClientCAs when
+//	set, so CertToNameEntry may name CA fingerprints. config.CipherSuites is ignored.
+func NewDTLSListener(network, address string, config *tls.Config) (ISnmpServerListener, error) {
+	if config == nil || len(config.Certificates) == 0 {
+		return nil, errors.New("DTLS listener without certificate")
+	}
+	udpaddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "ResolveUDPAddr Error")
+	}
+	// chains are verified once connected, as over TLS
+	roots := config.ClientCAs
+	dtlsConfig := &dtls.Config{
+		Certificates:         config.Certificates,
+		ClientAuth:           dtls.RequireAnyClientCert,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+		LoggerFactory:        &logging.DefaultLoggerFactory{Writer: io.Discard},
+	}
+	// only handshakes open connections, as dtls.Listen does
+	listenConfig := udp.ListenConfig{AcceptFilter: isDTLSHandshake}
+	listener, err := listenConfig.Listen(network, udpaddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "DTLS Listen Error")
+	}
+	ret := newStreamListener(listener, func(conn net.Conn) (*StreamReplyer, error) {
+		return openDTLS(conn, dtlsConfig, roots)
+	})
+	ret.datagrams = true
+	return ret, nil
+}
+
+// isDTLSHandshake tells whether the datagram starts with a DTLS handshake record
+func isDTLSHandshake(packet []byte) bool {
+	records, err := recordlayer.UnpackDatagram(packet)
+	if err != nil || len(records) == 0 {
+		return false
+	}
+	header := new(recordlayer.Header)
+	if err := header.Unmarshal(records[0]); err != nil {
+		return false
+	}
+	return header.ContentType == protocol.ContentTypeHandshake
+}
+
+// openDTLS completes the handshake of conn, so its replyer tells the certificates of the manager.
+// Their chain is verified against roots, if any.
+func openDTLS(conn net.Conn, config *dtls.Config, roots *x509.CertPool) (*StreamReplyer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	dtlsConn, err := dtls.ServerWithContext(ctx, conn, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "DTLS handshake")
+	}
+	state := &tls.ConnectionState{HandshakeComplete: true}
+	for _, raw := range dtlsConn.ConnectionState().PeerCertificates {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			dtlsConn.Close()
+			return nil, errors.Wrap(err, "DTLS client certificate")
+		}
+		state.PeerCertificates = append(state.PeerCertificates, cert)
+	}
+	verifyClientChain(state, roots)
+	return &StreamReplyer{conn: dtlsConn, tlsState: state}, nil
+}
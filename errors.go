@@ -7,3 +7,5 @@ var ErrNoSNMPInstance = errors.New("ErrNoSNMPInstance")
 var ErrUnsupportedOperation = errors.New("ErrUnsupportedOperation")
 var ErrNoPermission = errors.New("ErrNoPermission")
 var ErrUnsupportedPacketData = errors.New("ErrUnsupportedPacketData")
+var ErrResponseTooBig = errors.New("ErrResponseTooBig")
+var ErrRequestDropped = errors.New("ErrRequestDropped")
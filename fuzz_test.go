@@ -0,0 +1,107 @@
+package GoSNMPServer
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func fuzzMaster(tb testing.TB) *MasterAgent {
+	master := &MasterAgent{
+		AllowedVersion: SNMPV1 | SNMPV2c | SNMPV3,
+		SubAgents:      []*SubAgent{{CommunityIDs: []string{"public"}, OIDs: stringOIDs(aclTestOIDs...)}},
+		SecurityConfig: SecurityConfig{AuthoritativeEngineBoots: 1},
+	}
+	master.SecurityConfig.Users = make([]gosnmp.UsmSecurityParameters, 2)
+	usmTestUser{gosnmp.SHA, gosnmp.AES}.fill(&master.SecurityConfig.Users[0])
+	usmTestUser{gosnmp.NoAuth, gosnmp.NoPriv}.fill(&master.SecurityConfig.Users[1])
+	if err := master.ReadyForWork(); err != nil {
+		tb.Fatal(err)
+	}
+	return master
+}
+
+// fuzzSeeds returns valid requests of every version and PDU type
+func fuzzSeeds(tb testing.TB, master *MasterAgent) [][]byte {
+	var seeds [][]byte
+	add := func(request *gosnmp.SnmpPacket) {
+		raw, err := request.MarshalMsg()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		seeds = append(seeds, raw)
+	}
+	variables := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "x"},
+		{Name: ".1.3.6.1.2.1.2", Type: gosnmp.Null},
+	}
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		for _, pduType := range []gosnmp.PDUType{gosnmp.GetRequest, gosnmp.GetNextRequest, gosnmp.GetBulkRequest,
+			gosnmp.SetRequest, gosnmp.SNMPv2Trap, gosnmp.InformRequest} {
+			if version == gosnmp.Version1 && pduType == gosnmp.GetBulkRequest {
+				continue
+			}
+			request := &gosnmp.SnmpPacket{Version: version, Community: "public", PDUType: pduType, RequestID: 7,
+				NonRepeaters: 1, MaxRepetitions: 3, Variables: variables}
+			add(request)
+			// without varbinds
+			request.Variables = nil
+			add(request)
+		}
+	}
+	for _, user := range []usmTestUser{{gosnmp.NoAuth, gosnmp.NoPriv}, {gosnmp.SHA, gosnmp.AES}} {
+		usm := &gosnmp.UsmSecurityParameters{
+			AuthoritativeEngineID:    string(master.SecurityConfig.AuthoritativeEngineID.Marshal()),
+			AuthoritativeEngineBoots: master.SecurityConfig.AuthoritativeEngineBoots,
+		}
+		user.fill(usm)
+		GenKeys(usm)
+		GenSalt(usm)
+		add(&gosnmp.SnmpPacket{Version: gosnmp.Version3, MsgFlags: user.flags() | gosnmp.Reportable,
+			SecurityModel: gosnmp.UserSecurityModel, SecurityParameters: usm, MsgID: 3, RequestID: 7,
+			PDUType: gosnmp.GetBulkRequest, NonRepeaters: 1, MaxRepetitions: 3, ContextName: "public", Variables: variables})
+	}
+	// engine discovery
+	add(&gosnmp.SnmpPacket{Version: gosnmp.Version3, MsgFlags: gosnmp.Reportable, SecurityModel: gosnmp.UserSecurityModel,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{}, MsgID: 1, PDUType: gosnmp.GetRequest})
+	return seeds
+}
+
+func FuzzResponseForBuffer(f *testing.F) {
+	master := fuzzMaster(f)
+	for _, seed := range fuzzSeeds(f, master) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, _ := master.ResponseForBuffer(data)
+		if len(out) > master.MaxMessageSize {
+			t.Fatalf("%d octets answered beyond MaxMessageSize %d", len(out), master.MaxMessageSize)
+		}
+	})
+}
+
+func FuzzParseOID(f *testing.F) {
+	for _, seed := range []string{"", ".", "1.3.6.1", ".1.3.6.1.2.1.1.1.0", "1..3", "4294967295.4294967296", "-1", "1.3.x"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		oid, err := ParseOID(text)
+		if err != nil {
+			return
+		}
+		again, err := ParseOID(oid.String())
+		if err != nil || !again.Equal(oid) {
+			t.Fatalf("%q parsed as %v, then %v %v", text, oid, again, err)
+		}
+		if next := oid.Next(); next != nil && next.Compare(oid) <= 0 {
+			t.Fatalf("Next of %v is %v", oid, next)
+		}
+		if oid.Compare(oid.Append(1)) >= 0 || !oid.Append(1).HasPrefix(oid) {
+			t.Fatalf("%v not before its children", oid)
+		}
+		if oid.EncodedLen() <= 0 {
+			t.Fatalf("%v encoded in %d octets", oid, oid.EncodedLen())
+		}
+		varbindOID(gosnmp.SnmpPDU{Name: text})
+	})
+}
@@ -4,5 +4,10 @@ go 1.21
 
 require (
 	github.com/gosnmp/gosnmp v1.36.2-0.20230920160036-9457f610e8cf
+	github.com/pion/dtls/v2 v2.2.7
+	github.com/pion/logging v0.2.2
+	github.com/pion/transport/v2 v2.2.1
 	github.com/pkg/errors v0.9.1
 )
+
+require golang.org/x/crypto v0.8.0 // indirect
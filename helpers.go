@@ -1,11 +1,9 @@
 package GoSNMPServer
 
 import (
-	"strconv"
-	"strings"
+	"math"
 
 	"github.com/gosnmp/gosnmp"
-	"github.com/pkg/errors"
 )
 
 func getPktContextOrCommunity(i *gosnmp.SnmpPacket) string {
@@ -24,93 +22,44 @@ func copySnmpPacket(i *gosnmp.SnmpPacket) gosnmp.SnmpPacket {
 	return ret
 }
 
+// setErrorStatus sets the error-status of ret, and its error-index: the position of the
+// varbind in error counted from 1, 0 for none.
+//
+//	gosnmp carries error-index in an octet. An error beyond the 255th varbind is answered
+//	tooBig instead, so the manager retries with fewer varbinds. SetRequests of more varbinds
+//	are refused before any is set.
+func setErrorStatus(ret *gosnmp.SnmpPacket, status gosnmp.SNMPError, index int) {
+	if index > math.MaxUint8 {
+		ret.Error = gosnmp.TooBig
+		ret.ErrorIndex = 0
+		return
+	}
+	ret.Error = status
+	ret.ErrorIndex = uint8(index)
+}
+
+// ByteString is the former parsed form of oids.
+// Deprecated: instead use OID.
 type ByteString []int
+
+// ByteStringCompareResult is the former result of comparing oids.
+// Deprecated: instead use OID.Compare.
 type ByteStringCompareResult int
 
 const ByteStringCompareResultEqual = 0
 const ByteStringCompareResultLessThen = -1
 const ByteStringCompareResultGreaterThen = 1
 
-func compareByteString(arr1, arr2 ByteString) ByteStringCompareResult {
-	minLength := len(arr1)
-	if len(arr2) < minLength {
-		minLength = len(arr2)
-	}
-
-	for i := 0; i < minLength; i++ {
-		if arr1[i] < arr2[i] {
-			return ByteStringCompareResultLessThen
-		} else if arr1[i] > arr2[i] {
-			return ByteStringCompareResultGreaterThen
-		}
-	}
-
-	if len(arr1) < len(arr2) {
-		return ByteStringCompareResultLessThen
-	} else if len(arr1) > len(arr2) {
-		return ByteStringCompareResultGreaterThen
-	}
-
-	return ByteStringCompareResultEqual
-}
-
-// Fix BUG: When converting certain byte values to the rune type,
-// some byte values may not be represented correctly because the rune type represents a Unicode character.
-// This can cause byte values to become unpredictable or incorrect after conversion.
-func oidToByteString(oid string) ByteString {
-	xi := strings.Split(oid, ".")
-	out := []int{}
-	for id, each := range xi {
-		if each == "" {
-			if id == 0 {
-				continue
-			} else {
-				panic(errors.Errorf("oidToByteString not valid id. value=%v", oid))
-			}
-
-		}
-		i, err := strconv.ParseInt(each, 10, 32)
-		if err != nil {
-			panic(err)
-		}
-		out = append(out, int(i))
-	}
-	return ByteString(out)
-}
-
 // IsValidObjectIdentifier will check an oid string is valid oid
 // Deprecated: instead use VerifyOid.
 func IsValidObjectIdentifier(oid string) (result bool) {
-	defer func() {
-		if err := recover(); err != nil {
-			result = false
-			return
-		}
-	}()
-	if len(oid) == 0 {
-		return false
-	}
-	oidToByteString(oid)
-	return true
+	_, err := ParseOID(oid)
+	return err == nil
 }
 
 // VerifyOid will check an oid string is valid oid,
-// each number should be positive uint32.
+// each number should be an uint32.
 func VerifyOid(oid string) error {
-	xi := strings.Split(oid, ".")
-	for id, each := range xi {
-		if each == "" {
-			if id == 0 {
-				continue
-			}
-			return errors.New("oidToByteString not valid int,but it is empty " + oid)
-		}
-		i, err := strconv.ParseInt(each, 10, 32)
-		if err != nil {
-			return errors.New("oidToByteString not valid int. value=" + each)
-		} else if i < 0 {
-			return errors.New("oidToByteString not valid int. value=" + each + " should be positive")
-		}
-	}
-	return nil
+	_, err := ParseOID(oid)
+	return err
 }
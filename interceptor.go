@@ -0,0 +1,72 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Request is a decoded request passed along MasterAgent.Interceptors
+type Request struct {
+	// Packet is the request decoded (and decrypted for SNMPv3). Interceptors may replace it before calling next.
+	Packet *gosnmp.SnmpPacket
+	// Info describes where the request comes from
+	Info RequestInfo
+	// SecurityName is the community (SNMPv1/v2c) or user (SNMPv3) mapped to, and ContextName the context
+	// selecting the SubAgent. They are informational: access is checked against the request as received.
+	SecurityName string
+	ContextName  string
+	// Context carries the span of the request, if MasterAgent.Tracer is set
+	Context context.Context
+	// Logger carries the attributes of the request
+	Logger *slog.Logger
+}
+
+// RequestHandler answers a request
+type RequestHandler func(req *Request) (*gosnmp.SnmpPacket, error)
+
+// Interceptor sees each request between decoding and the SubAgent, as gRPC unary interceptors do.
+//
+//	Call next to go on, and modify the response it returns before it is marshaled, or
+//	short-circuit returning a response of your own or an error:
+//	  ErrRequestDropped        drops the request without response (snmpSilentDrops)
+//	  ErrNoPermission ...      answers with the error-status, as returned by SubAgents
+type Interceptor func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error)
+
+// ChainInterceptors returns one Interceptor calling interceptors in order, the first being the outermost.
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	return func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error) {
+		return chainHandler(interceptors, next)(req)
+	}
+}
+
+// chainHandler returns the handler calling interceptors, then last
+func chainHandler(interceptors []Interceptor, last RequestHandler) RequestHandler {
+	handler := last
+	for id := len(interceptors) - 1; id >= 0; id-- {
+		interceptor, next := interceptors[id], handler
+		handler = func(req *Request) (*gosnmp.SnmpPacket, error) {
+			return interceptor(req, next)
+		}
+	}
+	return handler
+}
+
+// newRequest describes packet i of scope for the interceptors
+func (t *MasterAgent) newRequest(i *gosnmp.SnmpPacket, scope *requestScope) *Request {
+	req := &Request{
+		Packet:       i,
+		SecurityName: scope.securityName,
+		ContextName:  scope.contextName,
+		Context:      scope.ctx,
+		Logger:       scope.loggerOr(t.priv.logger),
+	}
+	if scope.info != nil {
+		req.Info = *scope.info
+	}
+	if req.Context == nil {
+		req.Context = context.Background()
+	}
+	return req
+}
@@ -0,0 +1,136 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// interceptorTestMaster serves 1.3.6.1.2.1.1.1.0 and 1.3.6.1.2.1.1.2.0 through interceptors, counting OnGet
+func interceptorTestMaster(t *testing.T, gets *int, interceptors ...Interceptor) *MasterAgent {
+	items := stringOIDs("1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.2.0")
+	for _, item := range items {
+		onGet := item.OnGet
+		item.OnGet = func() (interface{}, error) {
+			*gets++
+			return onGet()
+		}
+	}
+	master := &MasterAgent{AllowedVersion: SNMPV2c, Metrics: NewMetrics(), Interceptors: interceptors,
+		SubAgents: []*SubAgent{{OIDs: items}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+// interceptedGet sends a Get of 1.3.6.1.2.1.1.1.0 to master, returning the response decoded, nil if none
+func interceptedGet(t *testing.T, master *MasterAgent) (*gosnmp.SnmpPacket, error) {
+	t.Helper()
+	out, err := master.ResponseForBuffer(communityRequest(t, gosnmp.Version2c, gosnmp.GetRequest, "1.3.6.1.2.1.1.1.0"))
+	if len(out) == 0 {
+		return nil, err
+	}
+	decoder := gosnmp.GoSNMP{Version: gosnmp.Version2c, Logger: gosnmp.NewLogger(nil)}
+	response, decodeErr := decoder.SnmpDecodePacket(out)
+	if decodeErr != nil {
+		t.Fatal(decodeErr)
+	}
+	return response, err
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var trace []string
+	traced := func(name string) Interceptor {
+		return func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error) {
+			trace = append(trace, name+">")
+			defer func() { trace = append(trace, "<"+name) }()
+			return next(req)
+		}
+	}
+	gets := 0
+	master := interceptorTestMaster(t, &gets, traced("a"), ChainInterceptors(traced("b"), traced("c")), traced("d"))
+	response, err := interceptedGet(t, master)
+	if err != nil || response == nil || response.Error != gosnmp.NoError || gets != 1 {
+		t.Fatalf("Get: %v %v, %d OnGet", response, err, gets)
+	}
+	// the first is the outermost, chains keep their order
+	if got := strings.Join(trace, " "); got != "a> b> c> d> <d <c <b <a" {
+		t.Errorf("called %v", got)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	gets := 0
+	master := interceptorTestMaster(t, &gets, func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error) {
+		ret := copySnmpPacket(req.Packet)
+		ret.PDUType = gosnmp.GetResponse
+		ret.Variables = []gosnmp.SnmpPDU{{Name: req.Packet.Variables[0].Name, Type: gosnmp.OctetString, Value: "cached"}}
+		return &ret, nil
+	})
+	response, err := interceptedGet(t, master)
+	if err != nil || response == nil || response.Error != gosnmp.NoError || pduValues(response.Variables) != "cached" {
+		t.Errorf("short-circuit: %v %v", response, err)
+	}
+	if gets != 0 {
+		t.Errorf("SubAgent reached, %d OnGet", gets)
+	}
+}
+
+func TestInterceptorErrors(t *testing.T) {
+	for _, each := range []struct {
+		err error
+		// expected is the error-status answered, -1 for no response
+		expected int
+	}{
+		{errors.Wrap(ErrNoPermission, "denied"), int(gosnmp.AuthorizationError)},
+		{ErrUnsupportedOperation, int(gosnmp.ResourceUnavailable)},
+		{errors.New("interceptor failure"), int(gosnmp.GenErr)},
+		{errors.Wrap(ErrRequestDropped, "dropped"), -1},
+	} {
+		gets := 0
+		master := interceptorTestMaster(t, &gets, func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error) {
+			return nil, each.err
+		})
+		response, err := interceptedGet(t, master)
+		switch {
+		case gets != 0:
+			t.Errorf("%v: SubAgent reached", each.err)
+		case each.expected < 0 && (response != nil || !errors.Is(err, ErrRequestDropped)):
+			t.Errorf("%v: answered %v %v", each.err, response, err)
+		case each.expected < 0 && master.Metrics.silentDrops.Load() != 1:
+			t.Errorf("%v: %d silent drops", each.err, master.Metrics.silentDrops.Load())
+		case each.expected >= 0 && (response == nil || int(response.Error) != each.expected || response.ErrorIndex != 0 ||
+			response.PDUType != gosnmp.GetResponse || response.RequestID != 1):
+			t.Errorf("%v: answered %v", each.err, response)
+		}
+	}
+}
+
+func TestInterceptorRewrite(t *testing.T) {
+	gets := 0
+	master := interceptorTestMaster(t, &gets,
+		// changes the response
+		func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error) {
+			ret, err := next(req)
+			if err == nil {
+				ret.Variables[0].Value = fmt.Sprintf("changed %s", ret.Variables[0].Value)
+			}
+			return ret, err
+		},
+		// asks another OID
+		func(req *Request, next RequestHandler) (*gosnmp.SnmpPacket, error) {
+			packet := copySnmpPacket(req.Packet)
+			packet.Variables = []gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.1.2.0", Type: gosnmp.Null}}
+			req.Packet = &packet
+			return next(req)
+		})
+	response, err := interceptedGet(t, master)
+	if err != nil || response == nil || response.Error != gosnmp.NoError || gets != 1 ||
+		pduNames(response.Variables) != "1.3.6.1.2.1.1.2.0" || pduValues(response.Variables) != "changed v1.3.6.1.2.1.1.2.0" {
+		t.Errorf("rewritten: %v %v", response, err)
+	}
+}
@@ -1,8 +1,9 @@
 package GoSNMPServer
 
 import (
-	"io"
+	"crypto/tls"
 	"log"
+	"log/slog"
 	"net"
 
 	"github.com/pkg/errors"
@@ -15,19 +16,55 @@ type ISnmpServerListener interface {
 	Shutdown()
 }
 
+// IStructuredLoggerListener is implemented by the listeners which take structured records.
+// SNMPServer gives them its logger with SetupStructuredLogger, instead of SetupLogger.
+type IStructuredLoggerListener interface {
+	SetupStructuredLogger(*slog.Logger)
+}
+
 type IReplyer interface {
 	ReplyPDU([]byte) error
 	Shutdown()
 }
 
+// ITLSReplyer is implemented by the replyers of managers over TLS or DTLS.
+// The messages of other replyers are not protected by a transport security model.
+type ITLSReplyer interface {
+	// TLSConnectionState returns the TLS session of the manager. nil if not over TLS
+	TLSConnectionState() *tls.ConnectionState
+}
+
+// IRemoteAddrReplyer is implemented by the replyers which know the address of the manager.
+// The address of other replyers is unknown.
+type IRemoteAddrReplyer interface {
+	// RemoteAddr returns the address of the manager. nil if unknown
+	RemoteAddr() net.Addr
+}
+
+// IPeerCredentialsReplyer is implemented by the replyers which know the local process of the
+// manager, as over Unix sockets. The process of other replyers is unknown.
+type IPeerCredentialsReplyer interface {
+	// PeerCredentials returns the local process of the manager. nil if unknown
+	PeerCredentials() *PeerCredentials
+}
+
+// PeerCredentials identifies the local process of a manager, as Unix sockets tell (SO_PEERCRED)
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
 type UDPListener struct {
 	conn   *net.UDPConn
-	logger *log.Logger
+	logger *slog.Logger
+	buffer []byte
 }
 
 func NewUDPListener(l3proto, address string) (ISnmpServerListener, error) {
 	ret := new(UDPListener)
-	ret.logger = log.New(io.Discard, "", 0)
+	ret.logger = NewDiscardLogger()
+	ret.buffer = make([]byte, DefaultMaxMessageSize)
 	udpaddr, err := net.ResolveUDPAddr(l3proto, address)
 	if err != nil {
 		return nil, errors.Wrap(err, "ResolveUDPAddr Error")
@@ -41,29 +78,40 @@ func NewUDPListener(l3proto, address string) (ISnmpServerListener, error) {
 }
 
 func (udp *UDPListener) SetupLogger(i *log.Logger) {
+	udp.logger = loggerFromLog(i)
+}
+
+func (udp *UDPListener) SetupStructuredLogger(i *slog.Logger) {
 	udp.logger = i
 }
+
+// SetBufferSize sets the size of the receive buffer, the largest datagram accepted.
+func (udp *UDPListener) SetBufferSize(size int) {
+	udp.buffer = make([]byte, size)
+}
+
 func (udp *UDPListener) Address() net.Addr {
 	return udp.conn.LocalAddr()
 }
 
 func (udp *UDPListener) NextSnmp() ([]byte, IReplyer, error) {
-	var msg [4096]byte
 	if udp.conn == nil {
 		return nil, nil, errors.New("Connection Not Listen")
 	}
-	counts, udpAddr, err := udp.conn.ReadFromUDP(msg[:])
+	counts, udpAddr, err := udp.conn.ReadFromUDP(udp.buffer)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "UDP Read Error")
 	}
-	udp.logger.Printf("udp request from %v. size=%v\n", udpAddr, counts)
-	return msg[:counts], &UDPReplyer{udpAddr, udp.conn}, nil
+	udp.logger.Debug("udp request", "peer", udpAddr.String(), "size", counts)
+	msg := make([]byte, counts)
+	copy(msg, udp.buffer[:counts])
+	return msg, &UDPReplyer{udpAddr, udp.conn}, nil
 }
 
+// Shutdown closes the socket, so NextSnmp returns. Address is kept.
 func (udp *UDPListener) Shutdown() {
 	if udp.conn != nil {
 		udp.conn.Close()
-		udp.conn = nil
 	}
 }
 
@@ -81,4 +129,8 @@ func (r *UDPReplyer) ReplyPDU(i []byte) error {
 	return nil
 }
 
+func (r *UDPReplyer) RemoteAddr() net.Addr {
+	return r.target
+}
+
 func (r *UDPReplyer) Shutdown() {}
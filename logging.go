@@ -0,0 +1,232 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// redacted replaces secrets in log records
+const redacted = "REDACTED"
+
+// secretKeys are parts of attribute keys whose values are never logged
+var secretKeys = []string{"passphrase", "password", "secret", "privkey", "authkey", "privacykey", "authenticationkey", "community"}
+
+// requestSeq numbers requests for the request_id log attribute
+var requestSeq atomic.Uint64
+
+// NewDefaultLogger returns a logger writing text records of level Info and above to stderr, secrets redacted.
+func NewDefaultLogger() *slog.Logger {
+	return slog.New(NewRedactingHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})))
+}
+
+// NewDiscardLogger returns a logger which drops everything.
+func NewDiscardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// NewLoggerFromLog adapts a *log.Logger: records of level and above are written
+// to l as text lines (without time, which l adds), secrets redacted.
+func NewLoggerFromLog(l *log.Logger, level slog.Leveler) *slog.Logger {
+	return slog.New(NewRedactingHandler(slog.NewTextHandler(logLoggerWriter{l}, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+}
+
+// loggerFromLog adapts l for every level, as its Printf calls were. nil and io.Discard drop everything
+func loggerFromLog(l *log.Logger) *slog.Logger {
+	if l == nil || l.Writer() == io.Discard {
+		return NewDiscardLogger()
+	}
+	return NewLoggerFromLog(l, slog.LevelDebug)
+}
+
+type logLoggerWriter struct {
+	l *log.Logger
+}
+
+func (w logLoggerWriter) Write(p []byte) (int, error) {
+	if err := w.l.Output(4, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewRedactingHandler wraps h, replacing secrets before they reach it:
+//
+//	attributes whose key names a secret (passphrase, password, community ...) are REDACTED.
+//	gosnmp.UsmSecurityParameters and gosnmp.SnmpPacket values are logged without their secrets.
+func NewRedactingHandler(h slog.Handler) slog.Handler {
+	if _, ok := h.(*redactingHandler); ok {
+		return h
+	}
+	return &redactingHandler{next: h}
+}
+
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	clean := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, clean)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for id, a := range attrs {
+		clean[id] = redactAttr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(clean)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr returns a without secrets
+func redactAttr(a slog.Attr) slog.Attr {
+	if containsSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		clean := make([]any, len(group))
+		for id, each := range group {
+			clean[id] = redactAttr(each)
+		}
+		return slog.Group(a.Key, clean...)
+	case slog.KindAny:
+		switch value := a.Value.Any().(type) {
+		case *gosnmp.UsmSecurityParameters:
+			return slog.Attr{Key: a.Key, Value: usmLogValue(value)}
+		case *gosnmp.SnmpPacket:
+			return slog.Attr{Key: a.Key, Value: packetLogValue(value)}
+		case gosnmp.SnmpPacket:
+			return slog.Attr{Key: a.Key, Value: packetLogValue(&value)}
+		}
+	}
+	return a
+}
+
+// usmLogValue describes user without keys and passphrases
+func usmLogValue(user *gosnmp.UsmSecurityParameters) slog.Value {
+	if user == nil {
+		return slog.AnyValue(nil)
+	}
+	return slog.GroupValue(
+		slog.String("user", user.UserName),
+		slog.String("auth", user.AuthenticationProtocol.String()),
+		slog.String("priv", user.PrivacyProtocol.String()),
+		slog.Uint64("engine_boots", uint64(user.AuthoritativeEngineBoots)),
+		slog.Uint64("engine_time", uint64(user.AuthoritativeEngineTime)),
+	)
+}
+
+// packetLogValue describes a packet without its community and security parameters
+func packetLogValue(pkt *gosnmp.SnmpPacket) slog.Value {
+	if pkt == nil {
+		return slog.AnyValue(nil)
+	}
+	return slog.GroupValue(
+		slog.String("version", pkt.Version.String()),
+		slog.String("pdu_type", pkt.PDUType.String()),
+		slog.Uint64("request_id", uint64(pkt.RequestID)),
+		slog.String("error", pkt.Error.String()),
+		slog.Int("error_index", int(pkt.ErrorIndex)),
+		slog.Any("oids", varbindNames(pkt.Variables)),
+	)
+}
+
+// varbindNames returns the names of varbinds
+func varbindNames(vars []gosnmp.SnmpPDU) []string {
+	ret := make([]string, len(vars))
+	for id := range vars {
+		ret[id] = vars[id].Name
+	}
+	return ret
+}
+
+// requestLogger returns logger with the attributes of where request comes from
+func requestLogger(logger *slog.Logger, request *gosnmp.SnmpPacket, info *RequestInfo) *slog.Logger {
+	attrs := []any{slog.Uint64("request_id", requestSeq.Add(1))}
+	if info != nil && info.Peer != nil {
+		attrs = append(attrs, slog.String("peer", info.Peer.String()))
+	}
+	if credentials := info.credentials(); credentials != nil {
+		attrs = append(attrs, slog.Uint64("peer_uid", uint64(credentials.UID)), slog.Int("peer_pid", int(credentials.PID)))
+	}
+	attrs = append(attrs, slog.String("version", request.Version.String()))
+	return logger.With(attrs...)
+}
+
+// withPDU returns logger with the pdu type and oids of request, once decoded
+func withPDU(logger *slog.Logger, request *gosnmp.SnmpPacket) *slog.Logger {
+	return logger.With(
+		slog.String("pdu_type", request.PDUType.String()),
+		slog.Any("oids", varbindNames(request.Variables)))
+}
+
+// containsSecret reports if text mentions a secret
+func containsSecret(text string) bool {
+	text = strings.ToLower(text)
+	for _, each := range secretKeys {
+		if strings.Contains(text, each) {
+			return true
+		}
+	}
+	return false
+}
+
+// gosnmpLogger passes gosnmp logs to logger at Debug level.
+//
+//	gosnmp formats secrets into messages (e.g. the community parsed), such messages are REDACTED.
+type gosnmpLogger struct {
+	logger *slog.Logger
+}
+
+func newGosnmpLogger(logger *slog.Logger) gosnmp.Logger {
+	return gosnmp.NewLogger(gosnmpLogger{logger: logger})
+}
+
+func (l gosnmpLogger) Print(v ...interface{}) {
+	if l.logger.Enabled(context.Background(), slog.LevelDebug) {
+		l.log(fmt.Sprint(v...))
+	}
+}
+
+func (l gosnmpLogger) Printf(format string, v ...interface{}) {
+	if l.logger.Enabled(context.Background(), slog.LevelDebug) {
+		l.log(fmt.Sprintf(format, v...))
+	}
+}
+
+func (l gosnmpLogger) log(msg string) {
+	if containsSecret(msg) {
+		msg = redacted
+	}
+	l.logger.Debug(strings.TrimSpace(msg), "source", "gosnmp")
+}
@@ -0,0 +1,126 @@
+package GoSNMPServer
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// syncBuffer is a bytes.Buffer for loggers of the serving goroutine
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestLoggerFromLog(t *testing.T) {
+	var out syncBuffer
+	user := usmTestUser{gosnmp.SHA256, gosnmp.AES}
+	master := usmTestMaster(user)
+	master.Logger = log.New(&out, "snmp: ", 0)
+	_, port := serveUDP(t, master)
+	if _, err := usmTestClient(t, port, user, nil).Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	if !strings.Contains(text, "snmp: ") || !strings.Contains(text, "serve get") {
+		t.Errorf("debug records not printed to the *log.Logger:\n%s", text)
+	}
+	if strings.Contains(text, "authpassphrase") || strings.Contains(text, "privpassphrase") {
+		t.Errorf("passphrase logged:\n%s", text)
+	}
+}
+
+func TestStructuredLogger(t *testing.T) {
+	var out syncBuffer
+	master := MasterAgent{
+		AllowedVersion:   SNMPV2c,
+		StructuredLogger: slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		SubAgents:        []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}},
+	}
+	_, port := serveUDP(t, master)
+	if _, err := communityClient(t, port, gosnmp.Version2c, "public").Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		if record["msg"] == "serve get" {
+			found = record["request_id"] != nil && record["pdu_type"] == "GetRequest" && record["version"] == "2c"
+		}
+	}
+	if !found {
+		t.Errorf("no serve get record with request attributes:\n%s", out.String())
+	}
+}
+
+func TestRedactingHandlerWrappedOnce(t *testing.T) {
+	master := MasterAgent{
+		StructuredLogger: NewDiscardLogger(),
+		SubAgents:        []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}},
+	}
+	for id := 0; id < 3; id++ {
+		if err := master.ReadyForWork(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler, ok := master.priv.logger.Handler().(*redactingHandler)
+	if !ok {
+		t.Fatalf("handler %T not redacting", master.priv.logger.Handler())
+	}
+	if _, nested := handler.next.(*redactingHandler); nested {
+		t.Error("redacting handlers nested by SyncConfig")
+	}
+	if master.StructuredLogger.Handler() == master.priv.logger.Handler() {
+		t.Error("StructuredLogger changed")
+	}
+}
+
+// printfListener is a listener of the former interface, without SetupStructuredLogger
+type printfListener struct {
+	ISnmpServerListener
+	logger *log.Logger
+}
+
+func (l *printfListener) SetupLogger(logger *log.Logger) {
+	l.logger = logger
+}
+
+func TestListenerSetupLogger(t *testing.T) {
+	logger := log.New(&syncBuffer{}, "", 0)
+	server := NewSNMPServer(MasterAgent{Logger: logger, SubAgents: []*SubAgent{{}}})
+	t.Cleanup(server.Shutdown)
+	memory := NewMemoryListener(t.Name())
+	printf := &printfListener{ISnmpServerListener: NewMemoryListener(t.Name() + "/printf")}
+	for _, listener := range []ISnmpServerListener{memory, printf} {
+		if err := server.Listen(listener); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if printf.logger != logger {
+		t.Error("SetupLogger not given MasterAgent.Logger")
+	}
+	if memory.logger != server.logger {
+		t.Error("SetupStructuredLogger not given the server logger")
+	}
+}
@@ -0,0 +1,174 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryAddr is the address of a MemoryListener or of a MemoryConn
+type MemoryAddr string
+
+func (a MemoryAddr) Network() string { return "memory" }
+
+func (a MemoryAddr) String() string { return string(a) }
+
+// memoryMessage is a request sent through a MemoryListener
+type memoryMessage struct {
+	data        []byte
+	from        MemoryAddr
+	credentials *PeerCredentials
+	reply       chan []byte   // buffered, receives the response
+	done        chan struct{} // closed once served, replied or not
+}
+
+// MemoryListener is an ISnmpServerListener passing messages through channels, without sockets.
+// Managers send requests through the MemoryConn of Dial.
+type MemoryListener struct {
+	addr      MemoryAddr
+	logger    *slog.Logger
+	requests  chan *memoryMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+	peers     atomic.Uint32
+
+	// served is the message last returned by NextSnmp, done when the next one is asked for
+	served *memoryMessage
+}
+
+// NewMemoryListener returns a MemoryListener with address name
+func NewMemoryListener(name string) *MemoryListener {
+	return &MemoryListener{
+		addr:     MemoryAddr(name),
+		logger:   NewDiscardLogger(),
+		requests: make(chan *memoryMessage),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (l *MemoryListener) SetupLogger(i *log.Logger) {
+	l.logger = loggerFromLog(i)
+}
+
+func (l *MemoryListener) SetupStructuredLogger(i *slog.Logger) {
+	l.logger = i
+}
+
+func (l *MemoryListener) Address() net.Addr {
+	return l.addr
+}
+
+func (l *MemoryListener) NextSnmp() ([]byte, IReplyer, error) {
+	if l.served != nil {
+		close(l.served.done)
+		l.served = nil
+	}
+	select {
+	case msg := <-l.requests:
+		l.logger.Debug("memory request", "peer", msg.from.String(), "size", len(msg.data))
+		l.served = msg
+		return msg.data, &MemoryReplyer{msg: msg}, nil
+	case <-l.closed:
+		return nil, nil, &net.OpError{Op: "read", Net: l.addr.Network(), Addr: l.addr, Err: net.ErrClosed}
+	}
+}
+
+func (l *MemoryListener) Shutdown() {
+	l.closeOnce.Do(func() { close(l.closed) })
+}
+
+// Dial returns a connection to the listener, as a new manager
+func (l *MemoryListener) Dial() *MemoryConn {
+	return l.DialAs(nil)
+}
+
+// DialAs returns a connection to the listener, as a new manager whose requests carry credentials
+func (l *MemoryListener) DialAs(credentials *PeerCredentials) *MemoryConn {
+	return &MemoryConn{
+		listener:    l,
+		addr:        MemoryAddr(fmt.Sprintf("%v/peer-%d", l.addr, l.peers.Add(1))),
+		credentials: credentials,
+	}
+}
+
+// MemoryConn sends requests to a MemoryListener. It is safe for concurrent use.
+type MemoryConn struct {
+	listener    *MemoryListener
+	addr        MemoryAddr
+	credentials *PeerCredentials
+}
+
+// LocalAddr returns the address the server sees requests from
+func (c *MemoryConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// Exchange sends request, then waits for it to be served and returns the response.
+//
+//	The response is nil if the server replied nothing, as for traps and requests dropped.
+func (c *MemoryConn) Exchange(ctx context.Context, request []byte) ([]byte, error) {
+	msg := &memoryMessage{
+		data:        append([]byte(nil), request...),
+		from:        c.addr,
+		credentials: c.credentials,
+		reply:       make(chan []byte, 1),
+		done:        make(chan struct{}),
+	}
+	select {
+	case c.listener.requests <- msg:
+	case <-c.listener.closed:
+		return nil, errors.WithStack(net.ErrClosed)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case response := <-msg.reply:
+		return response, nil
+	case <-msg.done:
+	case <-c.listener.closed:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	// the response is sent before done is closed
+	select {
+	case response := <-msg.reply:
+		return response, nil
+	default:
+	}
+	select {
+	case <-msg.done:
+		return nil, nil
+	default:
+		return nil, errors.WithStack(net.ErrClosed)
+	}
+}
+
+// MemoryReplyer replies to a request of a MemoryConn
+type MemoryReplyer struct {
+	msg *memoryMessage
+}
+
+func (r *MemoryReplyer) ReplyPDU(i []byte) error {
+	select {
+	case r.msg.reply <- append([]byte(nil), i...):
+		return nil
+	default:
+		return errors.New("memory request already replied")
+	}
+}
+
+func (r *MemoryReplyer) RemoteAddr() net.Addr {
+	return r.msg.from
+}
+
+func (r *MemoryReplyer) PeerCredentials() *PeerCredentials {
+	return r.msg.credentials
+}
+
+func (r *MemoryReplyer) Shutdown() {}
@@ -0,0 +1,287 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// oidSnmp is the snmp group of SNMPv2-MIB. See RFC3418
+const oidSnmp = "1.3.6.1.2.1.11"
+
+// metricsDurationBuckets are the upper bounds (seconds) of the request duration histogram
+var metricsDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Metrics counts messages a MasterAgent receives and sends.
+//
+//	Serve them with Handler in the Prometheus text format, or as the
+//	SNMPv2-MIB snmp group with SNMPGroupOIDs.
+//	A Metrics belongs to one MasterAgent.
+type Metrics struct {
+	// SNMPv2-MIB snmp group
+	inPkts              atomic.Uint32
+	outPkts             atomic.Uint32
+	inBadVersions       atomic.Uint32
+	inBadCommunityNames atomic.Uint32
+	inBadCommunityUses  atomic.Uint32
+	inASNParseErrs      atomic.Uint32
+	silentDrops         atomic.Uint32
+	proxyDrops          atomic.Uint32
+
+	mu        sync.Mutex
+	requests  map[metricsRequestKey]uint64
+	responses map[gosnmp.SNMPError]uint64
+	durations map[gosnmp.PDUType]*metricsHistogram
+
+	usm       *usmStats
+	tsm       *tsmStats
+	mpd       *mpdStats
+	subAgents []*SubAgent
+}
+
+type metricsRequestKey struct {
+	version gosnmp.SnmpVersion
+	pduType gosnmp.PDUType
+}
+
+type metricsHistogram struct {
+	buckets []uint64 // cumulative counts of metricsDurationBuckets
+	count   uint64
+	sum     float64
+}
+
+// NewMetrics creates a Metrics to set as MasterAgent.Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  make(map[metricsRequestKey]uint64),
+		responses: make(map[gosnmp.SNMPError]uint64),
+		durations: make(map[gosnmp.PDUType]*metricsHistogram),
+		mpd:       new(mpdStats),
+	}
+}
+
+func (m *Metrics) setSubAgents(subAgents []*SubAgent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subAgents = subAgents
+}
+
+// observeRequest records a request served and how long it took. nil m records nothing
+func (m *Metrics) observeRequest(request *gosnmp.SnmpPacket, elapsed time.Duration) {
+	if m == nil || request == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[metricsRequestKey{version: request.Version, pduType: request.PDUType}]++
+	histogram, found := m.durations[request.PDUType]
+	if !found {
+		histogram = &metricsHistogram{buckets: make([]uint64, len(metricsDurationBuckets))}
+		m.durations[request.PDUType] = histogram
+	}
+	seconds := elapsed.Seconds()
+	for id, bound := range metricsDurationBuckets {
+		if seconds <= bound {
+			histogram.buckets[id]++
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+// observeResponse records the error-status of a response sent. nil m records nothing
+func (m *Metrics) observeResponse(response *gosnmp.SnmpPacket) {
+	if m == nil || response == nil || response.PDUType != gosnmp.GetResponse {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[response.Error]++
+}
+
+// SNMPGroupOIDs returns the scalars of the SNMPv2-MIB snmp group, to append to SubAgent.OIDs
+func (m *Metrics) SNMPGroupOIDs() []*PDUValueControlItem {
+	counter := func(subID int, document string, value *atomic.Uint32) *PDUValueControlItem {
+		return &PDUValueControlItem{
+			OID:      fmt.Sprintf("%s.%d.0", oidSnmp, subID),
+			Type:     gosnmp.Counter32,
+			OnGet:    func() (interface{}, error) { return Asn1Counter32Wrap(uint(value.Load())), nil },
+			Document: document,
+		}
+	}
+	return []*PDUValueControlItem{
+		counter(1, "snmpInPkts", &m.inPkts),
+		counter(3, "snmpInBadVersions", &m.inBadVersions),
+		counter(4, "snmpInBadCommunityNames", &m.inBadCommunityNames),
+		counter(5, "snmpInBadCommunityUses", &m.inBadCommunityUses),
+		counter(6, "snmpInASNParseErrs", &m.inASNParseErrs),
+		{
+			OID:  oidSnmp + ".30.0",
+			Type: gosnmp.Integer,
+			// authentication failure traps are not sent: disabled(2)
+			OnGet:    func() (interface{}, error) { return Asn1IntegerWrap(2), nil },
+			Document: "snmpEnableAuthenTraps",
+		},
+		counter(31, "snmpSilentDrops", &m.silentDrops),
+		counter(32, "snmpProxyDrops", &m.proxyDrops),
+	}
+}
+
+// MPDStatsOIDs returns the snmpMPDStats scalars of SNMP-MPD-MIB, with snmpUnavailableContexts and
+// snmpUnknownContexts of SNMP-TARGET-MIB, to append to SubAgent.OIDs
+func (m *Metrics) MPDStatsOIDs() []*PDUValueControlItem {
+	counter := func(oid, document string, value *atomic.Uint32) *PDUValueControlItem {
+		return &PDUValueControlItem{
+			OID:      oid,
+			Type:     gosnmp.Counter32,
+			OnGet:    func() (interface{}, error) { return Asn1Counter32Wrap(uint(value.Load())), nil },
+			Document: document,
+		}
+	}
+	return []*PDUValueControlItem{
+		counter(oidSnmpUnknownSecurityModels, "snmpUnknownSecurityModels", &m.mpd.unknownSecurityModels),
+		counter(oidSnmpInvalidMsgs, "snmpInvalidMsgs", &m.mpd.invalidMsgs),
+		counter(oidSnmpUnknownPDUHandlers, "snmpUnknownPDUHandlers", &m.mpd.unknownPDUHandlers),
+		counter(oidSnmpUnavailableContexts, "snmpUnavailableContexts", &m.mpd.unavailableContexts),
+		counter(oidSnmpUnknownContexts, "snmpUnknownContexts", &m.mpd.unknownContexts),
+	}
+}
+
+// Handler serves the metrics in the Prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteTo(w)
+	})
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	counter := func(name, help string, value uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("gosnmpserver_snmp_in_pkts_total", "Messages received (snmpInPkts).", uint64(m.inPkts.Load()))
+	counter("gosnmpserver_snmp_out_pkts_total", "Messages sent.", uint64(m.outPkts.Load()))
+	counter("gosnmpserver_snmp_in_bad_versions_total", "Messages of a version not served (snmpInBadVersions).", uint64(m.inBadVersions.Load()))
+	counter("gosnmpserver_snmp_in_bad_community_names_total", "Messages of an unknown community or not allowed source (snmpInBadCommunityNames).", uint64(m.inBadCommunityNames.Load()))
+	counter("gosnmpserver_snmp_in_bad_community_uses_total", "Messages asking a community for an operation it does not allow (snmpInBadCommunityUses).", uint64(m.inBadCommunityUses.Load()))
+	counter("gosnmpserver_snmp_in_asn_parse_errs_total", "Messages which could not be decoded (snmpInASNParseErrs).", uint64(m.inASNParseErrs.Load()))
+	counter("gosnmpserver_snmp_silent_drops_total", "Requests dropped without response (snmpSilentDrops).", uint64(m.silentDrops.Load()))
+	counter("gosnmpserver_snmp_proxy_drops_total", "Proxied requests dropped (snmpProxyDrops).", uint64(m.proxyDrops.Load()))
+
+	if m.usm != nil {
+		b.WriteString("# HELP gosnmpserver_usm_stats_total SNMPv3 messages refused by the user-based security model (usmStats).\n")
+		b.WriteString("# TYPE gosnmpserver_usm_stats_total counter\n")
+		for _, each := range []struct {
+			reason string
+			value  *atomic.Uint32
+		}{
+			{"unsupportedSecLevels", &m.usm.unsupportedSecLevels},
+			{"notInTimeWindows", &m.usm.notInTimeWindows},
+			{"unknownUserNames", &m.usm.unknownUserNames},
+			{"unknownEngineIDs", &m.usm.unknownEngineIDs},
+			{"wrongDigests", &m.usm.wrongDigests},
+			{"decryptionErrors", &m.usm.decryptionErrors},
+		} {
+			fmt.Fprintf(&b, "gosnmpserver_usm_stats_total{reason=%q} %d\n", each.reason, each.value.Load())
+		}
+	}
+
+	if m.tsm != nil {
+		b.WriteString("# HELP gosnmpserver_tsm_stats_total SNMPv3 messages refused by the transport security model (snmpTsmStats, snmpTlstmSessionStats).\n")
+		b.WriteString("# TYPE gosnmpserver_tsm_stats_total counter\n")
+		for _, each := range []struct {
+			reason string
+			value  *atomic.Uint32
+		}{
+			{"invalidCaches", &m.tsm.invalidCaches},
+			{"invalidClientCertificates", &m.tsm.invalidClientCertificates},
+		} {
+			fmt.Fprintf(&b, "gosnmpserver_tsm_stats_total{reason=%q} %d\n", each.reason, each.value.Load())
+		}
+	}
+
+	b.WriteString("# HELP gosnmpserver_mpd_stats_total SNMPv3 messages refused by message processing or for their context (snmpMPDStats, snmpUnknownContexts).\n")
+	b.WriteString("# TYPE gosnmpserver_mpd_stats_total counter\n")
+	for _, each := range []struct {
+		reason string
+		value  *atomic.Uint32
+	}{
+		{"unknownSecurityModels", &m.mpd.unknownSecurityModels},
+		{"invalidMsgs", &m.mpd.invalidMsgs},
+		{"unknownPDUHandlers", &m.mpd.unknownPDUHandlers},
+		{"unavailableContexts", &m.mpd.unavailableContexts},
+		{"unknownContexts", &m.mpd.unknownContexts},
+	} {
+		fmt.Fprintf(&b, "gosnmpserver_mpd_stats_total{reason=%q} %d\n", each.reason, each.value.Load())
+	}
+
+	m.mu.Lock()
+	requestKeys := make([]metricsRequestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].version != requestKeys[j].version {
+			return requestKeys[i].version < requestKeys[j].version
+		}
+		return requestKeys[i].pduType < requestKeys[j].pduType
+	})
+	b.WriteString("# HELP gosnmpserver_requests_total Requests served by version and pdu type.\n")
+	b.WriteString("# TYPE gosnmpserver_requests_total counter\n")
+	for _, key := range requestKeys {
+		fmt.Fprintf(&b, "gosnmpserver_requests_total{version=%q,pdu_type=%q} %d\n",
+			key.version.String(), key.pduType.String(), m.requests[key])
+	}
+
+	responseKeys := make([]gosnmp.SNMPError, 0, len(m.responses))
+	for key := range m.responses {
+		responseKeys = append(responseKeys, key)
+	}
+	sort.Slice(responseKeys, func(i, j int) bool { return responseKeys[i] < responseKeys[j] })
+	b.WriteString("# HELP gosnmpserver_responses_total Responses sent by error-status.\n")
+	b.WriteString("# TYPE gosnmpserver_responses_total counter\n")
+	for _, key := range responseKeys {
+		fmt.Fprintf(&b, "gosnmpserver_responses_total{error_status=%q} %d\n", key.String(), m.responses[key])
+	}
+
+	durationKeys := make([]gosnmp.PDUType, 0, len(m.durations))
+	for key := range m.durations {
+		durationKeys = append(durationKeys, key)
+	}
+	sort.Slice(durationKeys, func(i, j int) bool { return durationKeys[i] < durationKeys[j] })
+	b.WriteString("# HELP gosnmpserver_request_duration_seconds Time to answer a request by pdu type.\n")
+	b.WriteString("# TYPE gosnmpserver_request_duration_seconds histogram\n")
+	for _, key := range durationKeys {
+		histogram := m.durations[key]
+		for id, bound := range metricsDurationBuckets {
+			fmt.Fprintf(&b, "gosnmpserver_request_duration_seconds_bucket{pdu_type=%q,le=\"%g\"} %d\n",
+				key.String(), bound, histogram.buckets[id])
+		}
+		fmt.Fprintf(&b, "gosnmpserver_request_duration_seconds_bucket{pdu_type=%q,le=\"+Inf\"} %d\n", key.String(), histogram.count)
+		fmt.Fprintf(&b, "gosnmpserver_request_duration_seconds_sum{pdu_type=%q} %g\n", key.String(), histogram.sum)
+		fmt.Fprintf(&b, "gosnmpserver_request_duration_seconds_count{pdu_type=%q} %d\n", key.String(), histogram.count)
+	}
+	subAgents := m.subAgents
+	m.mu.Unlock()
+
+	var cache CacheStats
+	for _, subAgent := range subAgents {
+		stats := subAgent.CacheStats()
+		cache.Hits += stats.Hits
+		cache.Misses += stats.Misses
+	}
+	counter("gosnmpserver_cache_hits_total", "Reads answered from the OnGet cache.", cache.Hits)
+	counter("gosnmpserver_cache_misses_total", "Reads which called OnGet with a cache.", cache.Misses)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
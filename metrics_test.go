@@ -0,0 +1,74 @@
+package GoSNMPServer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestMetricsDisabled(t *testing.T) {
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		SecurityConfig: SecurityConfig{CommunityACLs: []CommunityACL{{Community: "public"}}},
+		SubAgents:      []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}},
+	}
+	server, port := serveUDP(t, master)
+	if server.Metrics() != nil {
+		t.Fatal("metrics created without MasterAgent.Metrics")
+	}
+	if _, err := communityClient(t, port, gosnmp.Version2c, "public").Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := communityClient(t, port, gosnmp.Version2c, "other").Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+		t.Error("unknown community answered")
+	}
+}
+
+func TestMetricsCounts(t *testing.T) {
+	metrics := NewMetrics()
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		Metrics:        metrics,
+		SecurityConfig: SecurityConfig{CommunityACLs: []CommunityACL{{Community: "public"}}},
+		SubAgents:      []*SubAgent{{OIDs: append(stringOIDs("1.3.6.1.2.1.1.1.0"), metrics.SNMPGroupOIDs()...)}},
+	}
+	server, port := serveUDP(t, master)
+	if server.Metrics() != metrics {
+		t.Fatal("metrics not served")
+	}
+	public := communityClient(t, port, gosnmp.Version2c, "public")
+	if _, err := public.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := communityClient(t, port, gosnmp.Version2c, "other").Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+		t.Error("unknown community answered")
+	}
+	// snmpInPkts and snmpInBadCommunityNames, the Get counted
+	res, err := public.Get([]string{oidSnmp + ".1.0", oidSnmp + ".4.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gosnmp.ToBigInt(res.Variables[0].Value).Uint64(); got != 3 {
+		t.Errorf("snmpInPkts = %d, expected 3", got)
+	}
+	if got := gosnmp.ToBigInt(res.Variables[1].Value).Uint64(); got != 1 {
+		t.Errorf("snmpInBadCommunityNames = %d, expected 1", got)
+	}
+
+	var text strings.Builder
+	if _, err := metrics.WriteTo(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"gosnmpserver_snmp_in_pkts_total 3\n",
+		"gosnmpserver_snmp_out_pkts_total 2\n",
+		"gosnmpserver_snmp_in_bad_community_names_total 1\n",
+		`gosnmpserver_requests_total{version="2c",pdu_type="GetRequest"} 3` + "\n",
+		`gosnmpserver_responses_total{error_status="NoError"} 2` + "\n",
+	} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("metrics without %q", line)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package GoSNMPServer
+
+import (
+	"sync/atomic"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// snmpMPDStats of SNMP-MPD-MIB (RFC3412) and the context counters of SNMP-TARGET-MIB (RFC3413),
+// the latter carried back in REPORT pdus.
+const (
+	oidSnmpUnknownSecurityModels = "1.3.6.1.6.3.11.2.1.1.0"
+	oidSnmpInvalidMsgs           = "1.3.6.1.6.3.11.2.1.2.0"
+	oidSnmpUnknownPDUHandlers    = "1.3.6.1.6.3.11.2.1.3.0"
+	oidSnmpUnavailableContexts   = "1.3.6.1.6.3.12.1.4.0"
+	oidSnmpUnknownContexts       = "1.3.6.1.6.3.12.1.5.0"
+)
+
+type mpdStats struct {
+	unknownSecurityModels atomic.Uint32
+	invalidMsgs           atomic.Uint32
+	unknownPDUHandlers    atomic.Uint32
+	unavailableContexts   atomic.Uint32
+	unknownContexts       atomic.Uint32
+}
+
+// isLocalContextEngineID reports if contextEngineID names the local engine. Empty, as gosnmp
+// clients send by default, stands for the local engine.
+func (t *MasterAgent) isLocalContextEngineID(contextEngineID string) bool {
+	return contextEngineID == "" || contextEngineID == string(t.SecurityConfig.AuthoritativeEngineID.Marshal())
+}
+
+// checkContext verifies the scopedPDU of a SNMPv3 request, as the dispatcher (RFC3412 section 4.2.2)
+// and the command responder (RFC3413 section 3.2) do.
+//
+//	returns the counter to report and its oid, nil if the request is for a context served:
+//	snmpUnknownPDUHandlers for another contextEngineID, snmpUnknownContexts for a contextName
+//	no SubAgent serves.
+func (t *MasterAgent) checkContext(request *gosnmp.SnmpPacket) (string, *atomic.Uint32) {
+	if !t.isLocalContextEngineID(request.ContextEngineID) {
+		return oidSnmpUnknownPDUHandlers, &t.priv.mpdStats.unknownPDUHandlers
+	}
+	if t.findForContext(request.ContextName) == nil {
+		return oidSnmpUnknownContexts, &t.priv.mpdStats.unknownContexts
+	}
+	return "", nil
+}
+
+// findForContext returns the SubAgent serving contextName: the one listing it in ContextNames,
+// then in CommunityIDs, then the default one.
+func (t *MasterAgent) findForContext(contextName string) *SubAgent {
+	if val, ok := t.priv.contextToSubAgent[contextName]; ok {
+		return val
+	}
+	return t.findForSubAgent(contextName)
+}
@@ -0,0 +1,175 @@
+package GoSNMPServer
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// contextTestMaster serves 1.3.6.1.2.1.1.1.0 in context "device", 1.3.6.1.2.1.1.2.0 in "public",
+// and 1.3.6.1.2.1.1.3.0 in the other contexts when withDefault
+func contextTestMaster(withDefault bool) MasterAgent {
+	master := usmTestMaster(usmTestUser{gosnmp.SHA, gosnmp.NoPriv}, usmTestUser{gosnmp.NoAuth, gosnmp.NoPriv})
+	master.AllowedVersion = SNMPV2c | SNMPV3
+	master.SubAgents = []*SubAgent{
+		{ContextNames: []string{"device"}, OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")},
+		{CommunityIDs: []string{"public"}, OIDs: stringOIDs("1.3.6.1.2.1.1.2.0")},
+	}
+	if withDefault {
+		master.SubAgents = append(master.SubAgents, &SubAgent{OIDs: stringOIDs("1.3.6.1.2.1.1.3.0")})
+	}
+	return master
+}
+
+// contextGet gets the OIDs of contextTestMaster in contextName
+func contextGet(t *testing.T, port uint16, contextName string) *gosnmp.SnmpPacket {
+	t.Helper()
+	client := usmTestClient(t, port, usmTestUser{gosnmp.SHA, gosnmp.NoPriv}, nil)
+	client.ContextName = contextName
+	response, err := client.Get([]string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.1.3.0"})
+	if err != nil {
+		t.Fatalf("context %q: %v", contextName, err)
+	}
+	return response
+}
+
+// servedIn returns the OID of the only object response holds, "" if several or none
+func servedIn(response *gosnmp.SnmpPacket) string {
+	served := ""
+	for _, pdu := range response.Variables {
+		if pdu.Type == gosnmp.OctetString {
+			if served != "" {
+				return ""
+			}
+			served = pdu.Name
+		}
+	}
+	return served
+}
+
+func TestContextSubAgents(t *testing.T) {
+	_, port := serveUDP(t, contextTestMaster(true))
+	for contextName, expected := range map[string]string{
+		"device": ".1.3.6.1.2.1.1.1.0",
+		// SubAgents listing the context as community
+		"public": ".1.3.6.1.2.1.1.2.0",
+		"":       ".1.3.6.1.2.1.1.3.0",
+		"other":  ".1.3.6.1.2.1.1.3.0",
+	} {
+		response := contextGet(t, port, contextName)
+		if response.PDUType != gosnmp.GetResponse || servedIn(response) != expected {
+			t.Errorf("context %q: %v %v", contextName, response.PDUType, response.Variables)
+		}
+	}
+	// contexts are not communities
+	response, err := communityClient(t, port, gosnmp.Version2c, "device").Get([]string{"1.3.6.1.2.1.1.1.0"})
+	if err != nil || servedIn(response) != "" {
+		t.Errorf("community named as a context: %v %v", response, err)
+	}
+}
+
+// usmRequest returns request, a noAuthNoPriv SNMPv3 message to master
+func usmRequest(t *testing.T, master *MasterAgent, request *gosnmp.SnmpPacket) []byte {
+	t.Helper()
+	usm := &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    string(master.SecurityConfig.AuthoritativeEngineID.Marshal()),
+		AuthoritativeEngineBoots: master.SecurityConfig.AuthoritativeEngineBoots,
+	}
+	usmTestUser{gosnmp.NoAuth, gosnmp.NoPriv}.fill(usm)
+	request.Version, request.MsgFlags = gosnmp.Version3, gosnmp.NoAuthNoPriv|gosnmp.Reportable
+	request.SecurityModel, request.SecurityParameters = gosnmp.UserSecurityModel, usm
+	request.MsgID, request.RequestID = 1, 1
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// contextRequest returns a noAuthNoPriv SNMPv3 Get in contextName of contextEngineID, to master
+func contextRequest(t *testing.T, master *MasterAgent, contextName, contextEngineID string) []byte {
+	t.Helper()
+	return usmRequest(t, master, &gosnmp.SnmpPacket{MsgMaxSize: 65507, ContextName: contextName,
+		ContextEngineID: contextEngineID, PDUType: gosnmp.GetRequest,
+		Variables: []gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.Null}}})
+}
+
+func TestContextReports(t *testing.T) {
+	master := contextTestMaster(false)
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	engineID := string(master.SecurityConfig.AuthoritativeEngineID.Marshal())
+	for _, each := range []struct {
+		contextName, contextEngineID string
+		// report is the counter reported, "" for a response
+		report string
+	}{
+		{"device", "", ""},
+		{"device", engineID, ""},
+		{"other", "", oidSnmpUnknownContexts},
+		{"", "", oidSnmpUnknownContexts},
+		{"device", "\x80\x00\x1f\x88\x04other", oidSnmpUnknownPDUHandlers},
+	} {
+		out, err := master.ResponseForBuffer(contextRequest(t, &master, each.contextName, each.contextEngineID))
+		if len(out) == 0 {
+			t.Errorf("context %q of %x not answered: %v", each.contextName, each.contextEngineID, err)
+			continue
+		}
+		decoder := gosnmp.GoSNMP{SecurityParameters: &gosnmp.UsmSecurityParameters{}, Logger: gosnmp.Default.Logger}
+		response, err := decoder.SnmpDecodePacket(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if each.report == "" && (response.PDUType != gosnmp.GetResponse || servedIn(response) != ".1.3.6.1.2.1.1.1.0") ||
+			each.report != "" && (response.PDUType != gosnmp.Report || len(response.Variables) != 1 ||
+				response.Variables[0].Name != "."+each.report) {
+			t.Errorf("context %q of %x: %v %v", each.contextName, each.contextEngineID, response.PDUType, response.Variables)
+		}
+	}
+	stats := master.priv.mpdStats
+	if stats.unknownContexts.Load() != 2 || stats.unknownPDUHandlers.Load() != 1 {
+		t.Errorf("snmpUnknownContexts %d, snmpUnknownPDUHandlers %d", stats.unknownContexts.Load(), stats.unknownPDUHandlers.Load())
+	}
+}
+
+func TestContextCommunityTable(t *testing.T) {
+	master := contextTestMaster(false)
+	master.SecurityConfig.Communities = []CommunityEntry{
+		{Name: "devices", SecurityName: "monitor", ContextName: "device"},
+		{Name: "remote", SecurityName: "monitor", ContextEngineID: "\x80\x00\x1f\x88\x04other", ContextName: "device"},
+		{Name: "nowhere", SecurityName: "monitor", ContextName: "other"},
+	}
+	server, port := serveUDP(t, master)
+	get := func(community string) *gosnmp.SnmpPacket {
+		response, err := communityClient(t, port, gosnmp.Version2c, community).Get([]string{"1.3.6.1.2.1.1.1.0"})
+		if err != nil {
+			return nil
+		}
+		return response
+	}
+	if response := get("devices"); response == nil || servedIn(response) != ".1.3.6.1.2.1.1.1.0" {
+		t.Errorf("community of context device: %v", response)
+	}
+	for _, community := range []string{"remote", "nowhere"} {
+		if response := get(community); response != nil && response.Error == gosnmp.NoError {
+			t.Errorf("community %s served %v", community, response.Variables)
+		}
+	}
+	stats := server.master.priv.mpdStats
+	if stats.unavailableContexts.Load() != 1 || stats.unknownContexts.Load() != 1 {
+		t.Errorf("snmpUnavailableContexts %d, snmpUnknownContexts %d", stats.unavailableContexts.Load(), stats.unknownContexts.Load())
+	}
+}
+
+func TestContextDuplicate(t *testing.T) {
+	master := MasterAgent{SubAgents: []*SubAgent{{ContextNames: []string{"a"}}, {ContextNames: []string{"a"}}}}
+	if err := master.ReadyForWork(); err == nil {
+		t.Error("context served by two SubAgents")
+	}
+	// a context may be a community of another SubAgent
+	master = MasterAgent{SubAgents: []*SubAgent{{ContextNames: []string{"a"}}, {CommunityIDs: []string{"a"}}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Error(err)
+	}
+}
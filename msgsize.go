@@ -0,0 +1,151 @@
+package GoSNMPServer
+
+import (
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxMessageSize is the largest SNMP message (snmpEngineMaxMessageSize)
+// sent or received when MasterAgent.MaxMessageSize is not set: the largest UDP payload.
+const DefaultMaxMessageSize = 65507
+
+// minMaxMessageSize is the smallest msgMaxSize a manager may announce. See RFC3412
+const minMaxMessageSize = 484
+
+// berLengthSize returns the size of the BER length octets for a content of length n
+func berLengthSize(n int) int {
+	if n < 0x80 {
+		return 1
+	}
+	size := 1
+	for ; n > 0; n >>= 8 {
+		size++
+	}
+	return size
+}
+
+// berTLVSize returns the size of a BER encoded value of content length n
+func berTLVSize(n int) int {
+	return 1 + berLengthSize(n) + n
+}
+
+// berOIDContentSize returns the content length of an encoded OBJECT IDENTIFIER
+func berOIDContentSize(oid string) int {
+	parsed, err := ParseOID(oid)
+	if err != nil {
+		return len(oid)
+	}
+	return parsed.EncodedLen()
+}
+
+// estimateVarbindSize returns an upper bound of the encoded size of a varbind
+func estimateVarbindSize(pdu *gosnmp.SnmpPDU) int {
+	var value int
+	switch pdu.Type {
+	case gosnmp.OctetString, gosnmp.BitString, gosnmp.Opaque:
+		switch v := pdu.Value.(type) {
+		case string:
+			value = berTLVSize(len(v))
+		case []byte:
+			value = berTLVSize(len(v))
+		default:
+			value = berTLVSize(0)
+		}
+	case gosnmp.ObjectIdentifier:
+		if v, ok := pdu.Value.(string); ok {
+			value = berTLVSize(berOIDContentSize(v))
+		} else {
+			value = berTLVSize(0)
+		}
+	case gosnmp.Integer, gosnmp.Counter64:
+		value = berTLVSize(9)
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		value = berTLVSize(5)
+	case gosnmp.IPAddress:
+		value = berTLVSize(16)
+	case gosnmp.OpaqueFloat, gosnmp.OpaqueDouble:
+		value = berTLVSize(berTLVSize(8) + 1)
+	default:
+		// Null, NoSuchObject, NoSuchInstance, EndOfMibView ...
+		value = berTLVSize(0)
+	}
+	return berTLVSize(berTLVSize(berOIDContentSize(pdu.Name)) + value)
+}
+
+// estimateMessageOverhead returns an upper bound of the encoded size of a
+// response to request without any varbinds.
+func estimateMessageOverhead(request *gosnmp.SnmpPacket) int {
+	// version, request-id, error-status, error-index, pdu / message headers
+	overhead := 3 + 6 + 3 + 3 + 2*4
+	if request.Version == gosnmp.Version3 {
+		// msgGlobalData, contextEngineID, contextName
+		overhead += 32 + berTLVSize(32) + berTLVSize(len(request.ContextName))
+		// usm: engine id, boots, time, user name, auth 48, priv 8, encryption padding / headers
+		overhead += berTLVSize(32) + 6 + 6 + berTLVSize(32) + berTLVSize(48) + berTLVSize(8) + 16 + 8
+	} else {
+		overhead += berTLVSize(len(request.Community))
+	}
+	return overhead
+}
+
+// maxResponseSize returns the largest response allowed to request
+func (t *MasterAgent) maxResponseSize(request *gosnmp.SnmpPacket, scope *requestScope) int {
+	limit := t.MaxMessageSize
+	if request.Version == gosnmp.Version3 &&
+		request.MsgMaxSize >= minMaxMessageSize && int(request.MsgMaxSize) < limit {
+		limit = int(request.MsgMaxSize)
+	}
+	if request.Version != gosnmp.Version3 && scope != nil {
+		limit = t.RateLimits.maxAmplification(limit, scope.requestBytes)
+	}
+	return limit
+}
+
+// fitResponse marshals a response within limit octets.
+//
+//	GetBulk responses are truncated from the end. Other responses become tooBig. See RFC3416 section 4.2
+func (t *MasterAgent) fitResponse(request *gosnmp.SnmpPacket, out []byte, response *gosnmp.SnmpPacket, limit int) ([]byte, error) {
+	if len(out) <= limit || response == nil || response.PDUType != gosnmp.GetResponse {
+		return out, nil
+	}
+	t.priv.logger.Debug("response too big", "size", len(out), "limit", limit)
+	var err error
+	if request.PDUType == gosnmp.GetBulkRequest {
+		// binary search for the most varbinds that fit
+		all := response.Variables
+		low, high := 0, len(all)-1
+		for low < high {
+			mid := (low + high + 1) / 2
+			response.Variables = all[:mid]
+			if out, err = marshalMessage(response); err != nil {
+				return nil, err
+			}
+			if len(out) <= limit {
+				low = mid
+			} else {
+				high = mid - 1
+			}
+		}
+		response.Variables = all[:low]
+		if out, err = marshalMessage(response); err != nil {
+			return nil, err
+		}
+	} else {
+		response.Error = gosnmp.TooBig
+		response.ErrorIndex = 0
+		response.Variables = []gosnmp.SnmpPDU{}
+		if request.Version == gosnmp.Version1 {
+			response.Variables = request.Variables
+		}
+		if out, err = marshalMessage(response); err != nil {
+			return nil, err
+		}
+	}
+	if len(out) > limit {
+		if t.Metrics != nil {
+			t.Metrics.silentDrops.Add(1)
+		}
+		return nil, errors.WithStack(ErrResponseTooBig)
+	}
+	return out, nil
+}
@@ -0,0 +1,152 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// msgSizeTestOIDs returns count OIDs under 1.3.6.1.4.1.3
+func msgSizeTestOIDs(count int) []string {
+	oids := make([]string, count)
+	for id := range oids {
+		oids[id] = fmt.Sprintf("1.3.6.1.4.1.3.%d.0", id+1)
+	}
+	return oids
+}
+
+// msgSizeTestMaster serves 100 OIDs of msgSizeTestOIDs in versions, answering at most 1000 octets
+func msgSizeTestMaster(t *testing.T, versions EnabledVersion) *MasterAgent {
+	master := usmTestMaster(usmTestUser{gosnmp.NoAuth, gosnmp.NoPriv})
+	master.AllowedVersion = versions
+	master.MaxMessageSize = 1000
+	master.SubAgents = []*SubAgent{{OIDs: stringOIDs(msgSizeTestOIDs(100)...)}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	return &master
+}
+
+// msgSizeExchange returns the response of master to raw, decoded as version, and its size
+func msgSizeExchange(t *testing.T, master *MasterAgent, version gosnmp.SnmpVersion, raw []byte) (*gosnmp.SnmpPacket, int) {
+	t.Helper()
+	out, err := master.ResponseForBuffer(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := gosnmp.GoSNMP{Version: version, Logger: gosnmp.NewLogger(nil)}
+	if version == gosnmp.Version3 {
+		decoder = gosnmp.GoSNMP{SecurityParameters: &gosnmp.UsmSecurityParameters{}, Logger: gosnmp.NewLogger(nil)}
+	}
+	response, err := decoder.SnmpDecodePacket(out)
+	if err != nil {
+		t.Fatalf("response of %d octets: %v", len(out), err)
+	}
+	return response, len(out)
+}
+
+// communityRequest marshals a request of pduType for oids
+func communityRequest(t *testing.T, version gosnmp.SnmpVersion, pduType gosnmp.PDUType, oids ...string) []byte {
+	t.Helper()
+	request := &gosnmp.SnmpPacket{Version: version, Community: "public", PDUType: pduType, RequestID: 1, MaxRepetitions: 100}
+	for _, oid := range oids {
+		request.Variables = append(request.Variables, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Null})
+	}
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// checkWalk checks that variables are the first OIDs of msgSizeTestOIDs
+func checkWalk(t *testing.T, name string, variables []gosnmp.SnmpPDU) {
+	t.Helper()
+	if len(variables) == 0 || len(variables) >= 100 {
+		t.Errorf("%s: %d varbinds", name, len(variables))
+	}
+	for id, oid := range msgSizeTestOIDs(len(variables)) {
+		if variables[id].Name != "."+oid || variables[id].Type != gosnmp.OctetString {
+			t.Errorf("%s: %v %v at %d, expected %v", name, variables[id].Name, variables[id].Type, id, oid)
+			return
+		}
+	}
+}
+
+func TestMaxMessageSizeGetBulk(t *testing.T) {
+	master := msgSizeTestMaster(t, SNMPV2c)
+	response, size := msgSizeExchange(t, master, gosnmp.Version2c,
+		communityRequest(t, gosnmp.Version2c, gosnmp.GetBulkRequest, "1.3.6.1.4.1.3"))
+	if size > 1000 || response.Error != gosnmp.NoError {
+		t.Errorf("GetBulk of %d octets: %v", size, response.Error)
+	}
+	checkWalk(t, "GetBulk", response.Variables)
+}
+
+func TestMaxMessageSizeTooBig(t *testing.T) {
+	master := msgSizeTestMaster(t, SNMPV1|SNMPV2c)
+	oids := msgSizeTestOIDs(40)
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		for _, pduType := range []gosnmp.PDUType{gosnmp.GetRequest, gosnmp.GetNextRequest} {
+			response, size := msgSizeExchange(t, master, version, communityRequest(t, version, pduType, oids...))
+			if size > 1000 || response.Error != gosnmp.TooBig || response.ErrorIndex != 0 {
+				t.Errorf("%v %v of %d octets: %v at %d", version, pduType, size, response.Error, response.ErrorIndex)
+				continue
+			}
+			// SNMPv1 returns the varbinds of the request. See RFC1157 section 4.1.2
+			if version == gosnmp.Version2c && len(response.Variables) != 0 ||
+				version == gosnmp.Version1 && pduNames(response.Variables) != strings.Join(oids, " ") {
+				t.Errorf("%v %v: tooBig with %v", version, pduType, pduNames(response.Variables))
+			}
+		}
+	}
+}
+
+func TestMsgMaxSize(t *testing.T) {
+	master := msgSizeTestMaster(t, SNMPV3)
+	for _, each := range []struct {
+		msgMaxSize uint32
+		// limit bounds the response, which exceeds above
+		limit, above int
+	}{
+		{600, 600, 300},
+		{2000, 1000, 600},
+		// below 484: ignored
+		{300, 1000, 600},
+	} {
+		response, size := msgSizeExchange(t, master, gosnmp.Version3, usmRequest(t, master, &gosnmp.SnmpPacket{
+			MsgMaxSize: each.msgMaxSize, PDUType: gosnmp.GetBulkRequest, MaxRepetitions: 100,
+			Variables: []gosnmp.SnmpPDU{{Name: "1.3.6.1.4.1.3", Type: gosnmp.Null}}}))
+		if size > each.limit || size <= each.above || response.Error != gosnmp.NoError {
+			t.Errorf("msgMaxSize %d: GetBulk of %d octets, %v", each.msgMaxSize, size, response.Error)
+		}
+		checkWalk(t, fmt.Sprintf("msgMaxSize %d", each.msgMaxSize), response.Variables)
+	}
+}
+
+func TestUDPBufferSize(t *testing.T) {
+	oids := msgSizeTestOIDs(250)
+	for _, each := range []struct {
+		maxMessageSize int
+		answered       bool
+	}{
+		{2000, false},
+		{8000, true},
+	} {
+		_, port := serveUDP(t, MasterAgent{AllowedVersion: SNMPV2c, MaxMessageSize: each.maxMessageSize,
+			SubAgents: []*SubAgent{{OIDs: stringOIDs(oids[:1]...)}}})
+		client := udpClient(t, port, gosnmp.Version2c)
+		client.MaxOids = len(oids)
+		client.Retries = 0
+		if err := client.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		// a request of about 5000 octets
+		response, err := client.Get(oids)
+		if answered := err == nil && len(response.Variables) == len(oids); answered != each.answered {
+			t.Errorf("MaxMessageSize %d: %v %v", each.maxMessageSize, response, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package GoSNMPServer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OID is a parsed OBJECT IDENTIFIER. Each sub-identifier is an uint32 as RFC2578 asks.
+//
+//	OIDs are ordered lexicographically, as GetNext walks them.
+type OID []uint32
+
+// ParseOID parses a dotted oid string, with or without the leading dot. e.g.
+//
+//	".1.3.6.1.2.1.1.1.0"
+//	"1.3.6.1.2.1.1.1.0"
+func ParseOID(oid string) (OID, error) {
+	trimmed := strings.TrimPrefix(oid, ".")
+	if trimmed == "" {
+		return nil, errors.Errorf("not valid oid %q: empty", oid)
+	}
+	parts := strings.Split(trimmed, ".")
+	ret := make(OID, len(parts))
+	for id, each := range parts {
+		value, err := strconv.ParseUint(each, 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("not valid oid %q: sub-identifier %q should be an uint32", oid, each)
+		}
+		ret[id] = uint32(value)
+	}
+	return ret, nil
+}
+
+// String returns the dotted form without leading dot
+func (o OID) String() string {
+	var b strings.Builder
+	for id, each := range o {
+		if id != 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(strconv.FormatUint(uint64(each), 10))
+	}
+	return b.String()
+}
+
+// Compare compares two OIDs lexicographically. returns -1, 0, 1
+func (o OID) Compare(other OID) int {
+	for id := 0; id < len(o) && id < len(other); id++ {
+		if o[id] < other[id] {
+			return -1
+		} else if o[id] > other[id] {
+			return 1
+		}
+	}
+	if len(o) < len(other) {
+		return -1
+	} else if len(o) > len(other) {
+		return 1
+	}
+	return 0
+}
+
+// Equal reports if two OIDs are the same
+func (o OID) Equal(other OID) bool {
+	return o.Compare(other) == 0
+}
+
+// HasPrefix reports if o equals or is under the subtree prefix
+func (o OID) HasPrefix(prefix OID) bool {
+	if len(prefix) > len(o) {
+		return false
+	}
+	return o[:len(prefix)].Compare(prefix) == 0
+}
+
+// Append returns a new OID of o followed by subIDs. o is not modified.
+func (o OID) Append(subIDs ...uint32) OID {
+	ret := make(OID, 0, len(o)+len(subIDs))
+	ret = append(ret, o...)
+	return append(ret, subIDs...)
+}
+
+// Next returns the smallest OID after every OID of the subtree o,
+// that is o with its last sub-identifier incremented.
+//
+//	returns nil if there is none (every sub-identifier is the max uint32)
+func (o OID) Next() OID {
+	for end := len(o); end > 0; end-- {
+		if o[end-1] != ^uint32(0) {
+			ret := o[:end].Append()
+			ret[end-1]++
+			return ret
+		}
+	}
+	return nil
+}
+
+// EncodedLen returns the length of the BER contents octets of o. See X.690 section 8.19
+func (o OID) EncodedLen() int {
+	if len(o) < 2 {
+		return 1
+	}
+	size := berSubIDSize(uint64(o[0])*40 + uint64(o[1]))
+	for _, each := range o[2:] {
+		size += berSubIDSize(uint64(each))
+	}
+	return size
+}
+
+// berSubIDSize returns the octets of a base 128 encoded sub-identifier
+func berSubIDSize(value uint64) int {
+	size := 1
+	for value >>= 7; value > 0; value >>= 7 {
+		size++
+	}
+	return size
+}
@@ -0,0 +1,155 @@
+package GoSNMPServer
+
+import (
+	"encoding/asn1"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestParseOID(t *testing.T) {
+	for _, each := range []struct {
+		oid string
+		// expected is the String of the parsed OID, "" when rejected
+		expected string
+	}{
+		{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.1.0"},
+		{".1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.1.0"},
+		{".0.0.5", "0.0.5"},
+		{"1", "1"},
+		{"1.4294967295", "1.4294967295"},
+		{"1.4294967296", ""},
+		{"1.-1", ""},
+		{"1.+1", ""},
+		{"1.a", ""},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"1..3", ""},
+		{"1.3.", ""},
+		{"1.3 ", ""},
+	} {
+		oid, err := ParseOID(each.oid)
+		switch {
+		case each.expected == "" && err == nil:
+			t.Errorf("%q parsed as %v", each.oid, oid)
+		case each.expected != "" && (err != nil || oid.String() != each.expected):
+			t.Errorf("%q: %v %v, expected %v", each.oid, oid, err, each.expected)
+		}
+	}
+}
+
+func TestOIDCompare(t *testing.T) {
+	for _, each := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.3.6", "1.3.6", 0},
+		{"1.3.6", "1.3.7", -1},
+		{"1.3.10", "1.3.9", 1},
+		// prefixes come first
+		{"1.3", "1.3.6", -1},
+		{"1.3.6.1", "1.3.6", 1},
+		{"1.4", "1.3.6.1", 1},
+		{"0.0.5", "0.5", -1},
+		{"1.4294967295", "1.4294967294.1", 1},
+	} {
+		a, b := mustParseOID(t, each.a), mustParseOID(t, each.b)
+		if got := a.Compare(b); got != each.expected {
+			t.Errorf("%v Compare %v: %d, expected %d", a, b, got, each.expected)
+		}
+		if got := b.Compare(a); got != -each.expected {
+			t.Errorf("%v Compare %v: %d, expected %d", b, a, got, -each.expected)
+		}
+		if a.Equal(b) != (each.expected == 0) {
+			t.Errorf("%v Equal %v: %v", a, b, a.Equal(b))
+		}
+	}
+}
+
+func TestOIDHasPrefix(t *testing.T) {
+	for _, each := range []struct {
+		oid      string
+		prefix   OID
+		expected bool
+	}{
+		{"1.3.6.1", OID{1, 3, 6, 1}, true},
+		{"1.3.6.1", OID{1, 3}, true},
+		{"1.3.6.1", OID{}, true},
+		{"1.3.6.1", nil, true},
+		{"1.3.6.1", OID{1, 3, 6, 1, 2}, false},
+		{"1.3.6.1", OID{1, 3, 7}, false},
+		{"1.3.61", OID{1, 3, 6}, false},
+	} {
+		oid := mustParseOID(t, each.oid)
+		if got := oid.HasPrefix(each.prefix); got != each.expected {
+			t.Errorf("%v HasPrefix %v: %v", oid, each.prefix, got)
+		}
+	}
+}
+
+func TestOIDNext(t *testing.T) {
+	for _, each := range []struct {
+		oid      OID
+		expected OID
+	}{
+		{OID{1, 3, 6}, OID{1, 3, 7}},
+		{OID{1, 3, 4294967295}, OID{1, 4}},
+		{OID{1, 4294967295, 4294967295}, OID{2}},
+		{OID{4294967295, 4294967295}, nil},
+		{OID{}, nil},
+	} {
+		if got := each.oid.Next(); got.Compare(each.expected) != 0 || (got == nil) != (each.expected == nil) {
+			t.Errorf("%v Next: %v, expected %v", each.oid, got, each.expected)
+		}
+	}
+	// o is not modified
+	oid := OID{1, 3, 6}
+	if oid.Next(); oid.String() != "1.3.6" {
+		t.Errorf("Next modified %v", oid)
+	}
+}
+
+// marshalledOIDLen returns the length of the contents octets gosnmp encodes oid in, as a varbind name
+func marshalledOIDLen(t *testing.T, oid string) int {
+	t.Helper()
+	request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "public", PDUType: gosnmp.GetRequest,
+		Variables: []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Null}}}
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// message, PDU, varbind list, varbind, name
+	path := []int{2, 3, 0, 0}
+	var value asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &value); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range path {
+		rest := value.Bytes
+		for id := 0; id <= index; id++ {
+			if rest, err = asn1.Unmarshal(rest, &value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if value.Tag != asn1.TagOID {
+		t.Fatalf("%v: tag %d of the name", oid, value.Tag)
+	}
+	return len(value.Bytes)
+}
+
+func TestOIDEncodedLen(t *testing.T) {
+	for _, oid := range []string{
+		"1.3",
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.127.128.16383.16384",
+		"1.3.6.1.4.1.4294967295",
+		"2.39.2097151.2097152",
+		"0.0.5",
+	} {
+		if got, expected := mustParseOID(t, oid).EncodedLen(), marshalledOIDLen(t, oid); got != expected {
+			t.Errorf("%v EncodedLen %d, gosnmp marshals %d octets", oid, got, expected)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package GoSNMPServer
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// oidTree is a registry of PDUValueControlItem keyed by parsed OIDs.
+//
+//	exact lookup, successor lookup, insert and delete are O(depth) (times log of the fan out).
+type oidTree struct {
+	root oidTreeNode
+	size int
+}
+
+type oidTreeNode struct {
+	subID    uint32
+	item     *PDUValueControlItem
+	children []*oidTreeNode // sorted by subID
+}
+
+// child returns the position of subID in children, and if it exists
+func (n *oidTreeNode) child(subID uint32) (int, bool) {
+	id := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].subID >= subID
+	})
+	return id, id < len(n.children) && n.children[id].subID == subID
+}
+
+// first returns the first accepted item of this subtree, in OID order
+func (n *oidTreeNode) first(accept func(*PDUValueControlItem) bool) *PDUValueControlItem {
+	if n.item != nil && accept(n.item) {
+		return n.item
+	}
+	for _, each := range n.children {
+		if item := each.first(accept); item != nil {
+			return item
+		}
+	}
+	return nil
+}
+
+// successor returns the first accepted item of this subtree after key (relative to this node)
+func (n *oidTreeNode) successor(key OID, accept func(*PDUValueControlItem) bool) *PDUValueControlItem {
+	if len(key) == 0 {
+		for _, each := range n.children {
+			if item := each.first(accept); item != nil {
+				return item
+			}
+		}
+		return nil
+	}
+	id, found := n.child(key[0])
+	if found {
+		if item := n.children[id].successor(key[1:], accept); item != nil {
+			return item
+		}
+		id++
+	}
+	for ; id < len(n.children); id++ {
+		if item := n.children[id].first(accept); item != nil {
+			return item
+		}
+	}
+	return nil
+}
+
+func (n *oidTreeNode) walk(fn func(*PDUValueControlItem)) {
+	if n.item != nil {
+		fn(n.item)
+	}
+	for _, each := range n.children {
+		each.walk(fn)
+	}
+}
+
+func (t *oidTree) get(key OID) *PDUValueControlItem {
+	node := &t.root
+	for _, subID := range key {
+		id, found := node.child(subID)
+		if !found {
+			return nil
+		}
+		node = node.children[id]
+	}
+	return node.item
+}
+
+// hasSibling reports if an item is registered one sub-identifier below the parent of key,
+// as the other instances of the object key would be an instance of.
+func (t *oidTree) hasSibling(key OID) bool {
+	if len(key) < 2 {
+		return false
+	}
+	node := &t.root
+	for _, subID := range key[:len(key)-1] {
+		id, found := node.child(subID)
+		if !found {
+			return false
+		}
+		node = node.children[id]
+	}
+	for _, each := range node.children {
+		if each.item != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds item at key. It fails for an existing key.
+func (t *oidTree) insert(key OID, item *PDUValueControlItem) error {
+	node := &t.root
+	for _, subID := range key {
+		id, found := node.child(subID)
+		if !found {
+			node.children = append(node.children, nil)
+			copy(node.children[id+1:], node.children[id:])
+			node.children[id] = &oidTreeNode{subID: subID}
+		}
+		node = node.children[id]
+	}
+	if node.item != nil {
+		return errors.Errorf("meet duplicate oid %v", item.OID)
+	}
+	node.item = item
+	t.size++
+	return nil
+}
+
+// remove deletes the item at key and prunes empty nodes. returns the item removed
+func (t *oidTree) remove(key OID) *PDUValueControlItem {
+	path := make([]*oidTreeNode, 0, len(key)+1)
+	node := &t.root
+	path = append(path, node)
+	for _, subID := range key {
+		id, found := node.child(subID)
+		if !found {
+			return nil
+		}
+		node = node.children[id]
+		path = append(path, node)
+	}
+	item := node.item
+	if item == nil {
+		return nil
+	}
+	node.item = nil
+	t.size--
+	for depth := len(path) - 1; depth > 0; depth-- {
+		current := path[depth]
+		if current.item != nil || len(current.children) != 0 {
+			break
+		}
+		parent := path[depth-1]
+		id, _ := parent.child(current.subID)
+		parent.children = append(parent.children[:id], parent.children[id+1:]...)
+	}
+	return item
+}
+
+// successor returns the first accepted item after key. nil if none
+func (t *oidTree) successor(key OID, accept func(*PDUValueControlItem) bool) *PDUValueControlItem {
+	return t.root.successor(key, accept)
+}
+
+// items returns all items in OID order
+func (t *oidTree) items() []*PDUValueControlItem {
+	ret := make([]*PDUValueControlItem, 0, t.size)
+	t.root.walk(func(item *PDUValueControlItem) {
+		ret = append(ret, item)
+	})
+	return ret
+}
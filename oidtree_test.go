@@ -0,0 +1,104 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestOIDTree(t *testing.T) {
+	var tree oidTree
+	all := func(*PDUValueControlItem) bool { return true }
+	for _, oid := range []string{"1.3.6.1.2", "1.3.6.1.2.1", "1.3.6.1.10", "1.3.6.1.9.5", "1.4"} {
+		key, _ := ParseOID(oid)
+		if err := tree.insert(key, &PDUValueControlItem{OID: oid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.insert(OID{1, 4}, &PDUValueControlItem{OID: "1.4"}); err == nil {
+		t.Error("duplicate oid inserted")
+	}
+	var walked []string
+	for item := tree.successor(OID{}, all); item != nil; item = tree.successor(mustParseOID(t, item.OID), all) {
+		walked = append(walked, item.OID)
+	}
+	if fmt.Sprint(walked) != "[1.3.6.1.2 1.3.6.1.2.1 1.3.6.1.9.5 1.3.6.1.10 1.4]" {
+		t.Errorf("walked %v", walked)
+	}
+	if item := tree.remove(OID{1, 3, 6, 1, 2, 1}); item == nil || item.OID != "1.3.6.1.2.1" {
+		t.Errorf("removed %v", item)
+	}
+	if item := tree.successor(OID{1, 3, 6, 1, 2, 0}, all); item == nil || item.OID != "1.3.6.1.9.5" {
+		t.Errorf("successor after remove %v", item)
+	}
+	if tree.size != 4 || len(tree.items()) != 4 {
+		t.Errorf("size %d with %d items", tree.size, len(tree.items()))
+	}
+}
+
+func mustParseOID(tb testing.TB, oid string) OID {
+	ret, err := ParseOID(oid)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return ret
+}
+
+func TestReplaceOIDs(t *testing.T) {
+	master := MasterAgent{SubAgents: []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	agent := master.SubAgents[0]
+	if err := agent.ReplaceOIDs(stringOIDs("1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.1.2.0")); err == nil {
+		t.Fatal("duplicate OIDs replaced")
+	}
+	if len(agent.OIDs) != 1 || agent.getForPDUValueControl(OID{1, 3, 6, 1, 2, 1, 1, 1, 0}) == nil {
+		t.Fatalf("OIDs not restored: %d", len(agent.OIDs))
+	}
+	if err := agent.ReplaceOIDs(stringOIDs("1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.1.3.0")); err != nil {
+		t.Fatal(err)
+	}
+	if len(agent.OIDs) != 2 || agent.getForPDUValueControl(OID{1, 3, 6, 1, 2, 1, 1, 1, 0}) != nil {
+		t.Fatalf("OIDs not replaced: %d", len(agent.OIDs))
+	}
+}
+
+// benchmarkAgent returns a SubAgent of size OIDs, as rows of a 1000 columns table
+func benchmarkAgent(b *testing.B, size int) *SubAgent {
+	b.Helper()
+	oids := make([]string, size)
+	for id := range oids {
+		oids[id] = fmt.Sprintf("1.3.6.1.4.1.99.1.1.%d.%d", id%1000+1, id/1000+1)
+	}
+	master := MasterAgent{SubAgents: []*SubAgent{{OIDs: stringOIDs(oids...)}}}
+	if err := master.ReadyForWork(); err != nil {
+		b.Fatal(err)
+	}
+	return master.SubAgents[0]
+}
+
+func BenchmarkRegistry(b *testing.B) {
+	for _, size := range []int{10000, 100000, 1000000} {
+		agent := benchmarkAgent(b, size)
+		middle := agent.OIDs[size/2].OID
+		requests := map[string]*gosnmp.SnmpPacket{
+			"Get":     {PDUType: gosnmp.GetRequest, Variables: []gosnmp.SnmpPDU{{Name: middle}}},
+			"GetNext": {PDUType: gosnmp.GetNextRequest, Variables: []gosnmp.SnmpPDU{{Name: middle}}},
+			"GetBulk": {PDUType: gosnmp.GetBulkRequest, MaxRepetitions: 50, Variables: []gosnmp.SnmpPDU{{Name: middle}}},
+		}
+		for _, name := range []string{"Get", "GetNext", "GetBulk"} {
+			request := requests[name]
+			request.Version = gosnmp.Version2c
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := agent.Serve(request); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -2,6 +2,7 @@ package GoSNMPServer
 
 import (
 	"net"
+	"time"
 
 	"github.com/gosnmp/gosnmp"
 	"github.com/pkg/errors"
@@ -18,6 +19,8 @@ const PermissionAllowanceDenied PermissionAllowance = 1
 
 // FuncPDUControlCheckPermission checks for permission.
 //
+//	contextName is the community of a SNMPv1/v2c request, even when SecurityConfig.Communities
+//	maps it to another context, and the contextName of a SNMPv3 request.
 //	return PermissionAllowanceAllowed / PermissionAllowanceDenied
 type FuncPDUControlCheckPermission func(pktVersion gosnmp.SnmpVersion, pduType gosnmp.PDUType, contextName string) PermissionAllowance
 
@@ -43,6 +46,8 @@ type FuncPDUControlSet func(value interface{}) error
 type PDUValueControlItem struct {
 	// OID controls which OID does this PDUValue works
 	OID string
+	// oid is OID parsed on registration to a SubAgent
+	oid OID
 	// Type defines which type this OID is.
 	Type gosnmp.Asn1BER
 
@@ -51,6 +56,12 @@ type PDUValueControlItem struct {
 	//             All write only item will be NonWalkable
 	NonWalkable bool
 
+	// CacheTTL keeps the value of OnGet for this duration. 0 for no cache (call OnGet on each read).
+	//          Concurrent reads share one OnGet call. A successful OnSet drops the value cached.
+	//          Items read by a Provider are not cached: the Provider may keep values itself.
+	CacheTTL time.Duration
+	cache    *valueCache
+
 	/////////// Callbacks
 
 	// OnCheckPermission will be called on access this OID. set to nil to allow all access.
@@ -60,10 +71,20 @@ type PDUValueControlItem struct {
 
 	// OnGet will be called on any GET / walk option. set to nil for mark this as a write-only item
 	OnGet FuncPDUControlGet
+	// Provider reads this item together with the other items of the request it provides, instead of OnGet.
+	Provider BatchValueProvider
 	// OnSet will be called on any Set option. set to nil for mark as a read-only item.
 	OnSet FuncPDUControlSet
 	// OnTrap will be called on TRAP.
 	OnTrap FuncPDUControlTrap
+
+	// Document for what this PDU means
+	Document string
+}
+
+// readable reports if the item has a value to read
+func (t *PDUValueControlItem) readable() bool {
+	return t.OnGet != nil || t.Provider != nil
 }
 
 func Asn1IntegerUnwrap(i interface{}) int { return i.(int) }
@@ -113,21 +134,3 @@ func Asn1OpaqueFloatWrap(i float32) interface{}   { return i }
 
 func Asn1OpaqueDoubleUnwrap(i interface{}) float64 { return i.(float64) }
 func Asn1OpaqueDoubleWrap(i float64) interface{}   { return i }
-
-type byOID []*PDUValueControlItem
-
-func (x byOID) Len() int {
-	return len(x)
-}
-
-func (x byOID) Less(i, j int) bool {
-	bsi := oidToByteString(x[i].OID)
-	bsj := oidToByteString(x[j].OID)
-	//  oidToByteString(x[i].OID) < oidToByteString(x[j].OID)
-	return compareByteString(bsi, bsj) == ByteStringCompareResultLessThen
-
-}
-
-func (x byOID) Swap(i, j int) {
-	x[i], x[j] = x[j], x[i]
-}
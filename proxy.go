@@ -0,0 +1,488 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// OIDs of SNMPv2-MIB and SNMP-COMMUNITY-MIB carried by traps. See RFC3584 section 3
+const (
+	oidSysUpTime          = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID        = "1.3.6.1.6.3.1.1.4.1.0"
+	oidSnmpTrapEnterprise = "1.3.6.1.6.3.1.1.4.3.0"
+	oidSnmpTraps          = "1.3.6.1.6.3.1.1.5"
+	oidSnmpTrapAddress    = "1.3.6.1.6.3.18.1.3.0"
+)
+
+// ProxyForwarder makes a SubAgent forward the requests of its communities / contexts to a downstream
+// agent, as the proxy forwarder application of RFC3413 does, and the traps it receives to notification
+// receivers.
+//
+//	Requests are sent as the downstream agent expects: SNMPv1, SNMPv2c or SNMPv3 with the security
+//	of Client, translated as RFC3584 section 4 asks. Client chooses its own request-ids.
+//	Requests which could not be forwarded, as timeouts, are answered genErr and counted as snmpProxyDrops.
+//	Views of the requester apply: objects out of view are not forwarded, nor returned. GetNext and
+//	GetBulk ask again past successors out of view, as the SubAgent serving its own OIDs skips them.
+//	Requests are forwarded one at a time, each waiting for the response or timeout of the previous.
+type ProxyForwarder struct {
+	// Client reaches the downstream agent: Target, Port, Version, Community or the SNMPv3 user and
+	// ContextName, Timeout and Retries. Connect is called on first use.
+	Client *gosnmp.GoSNMP
+
+	// NotificationTargets receive the traps and informs sent to the SubAgent, each one in its own version.
+	// Connect is called on first use.
+	NotificationTargets []*gosnmp.GoSNMP
+
+	// mu serializes the use of Client and NotificationTargets, which are not safe for concurrent use.
+	// It is held for each whole round trip, up to Timeout for every try: concurrent requests wait for
+	// each other. SubAgents with a ProxyForwarder each forward in parallel.
+	mu sync.Mutex
+}
+
+func (p *ProxyForwarder) syncConfig() error {
+	if p.Client == nil {
+		return errors.New("ProxyForwarder: nil Client")
+	}
+	for _, target := range p.NotificationTargets {
+		if target == nil {
+			return errors.New("ProxyForwarder: nil notification target")
+		}
+	}
+	return nil
+}
+
+// connect connects client once
+func connect(client *gosnmp.GoSNMP) error {
+	if client.Conn != nil {
+		return nil
+	}
+	return client.Connect()
+}
+
+// serve forwards request i of SubAgent t
+func (p *ProxyForwarder) serve(t *SubAgent, i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	logger := scope.loggerOr(t.logger)
+	if i.PDUType == gosnmp.Trap || i.PDUType == gosnmp.SNMPv2Trap || i.PDUType == gosnmp.InformRequest {
+		return p.serveTrap(t, i, scope)
+	}
+	ret := copySnmpPacket(i)
+	ret.PDUType = gosnmp.GetResponse
+	var res *gosnmp.SnmpPacket
+	var err error
+	switch i.PDUType {
+	case gosnmp.GetRequest:
+		res, err = p.forwardGet(i, scope)
+	case gosnmp.GetNextRequest:
+		res, err = p.forwardGetNext(i, scope)
+	case gosnmp.GetBulkRequest:
+		res, err = p.forwardGetBulk(i, scope)
+	case gosnmp.SetRequest:
+		res, err = p.forwardSet(i, scope)
+	default:
+		return nil, errors.WithStack(ErrUnsupportedOperation)
+	}
+	if err != nil {
+		logger.Debug("proxy forward failed", "target", p.Client.Target, "err", err)
+		t.countProxyDrop()
+		ret.Error = gosnmp.GenErr
+		ret.ErrorIndex = 0
+		if i.PDUType == gosnmp.SetRequest {
+			for _, varItem := range i.Variables {
+				scope.auditSet(varItem, nil, gosnmp.GenErr, err)
+			}
+		}
+		return &ret, nil
+	}
+	ret.Error, ret.ErrorIndex, ret.Variables = res.Error, res.ErrorIndex, res.Variables
+	logger.Debug("proxy forwarded", "target", p.Client.Target, "error", ret.Error.String(), "vars", len(ret.Variables))
+	return &ret, nil
+}
+
+// forwardGet forwards the varbinds of i in view. The others are noSuchObject
+func (p *ProxyForwarder) forwardGet(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	vars := make([]gosnmp.SnmpPDU, len(i.Variables))
+	var names []string
+	var positions []int
+	for id, varItem := range i.Variables {
+		oid := varbindOID(varItem)
+		if oid == nil || !scope.inView(oid) {
+			vars[id] = gosnmp.SnmpPDU{Name: varItem.Name, Type: gosnmp.NoSuchObject}
+			continue
+		}
+		names = append(names, varItem.Name)
+		positions = append(positions, id)
+	}
+	ret := &gosnmp.SnmpPacket{Variables: vars}
+	if len(names) == 0 {
+		return ret, nil
+	}
+	res, err := p.request(gosnmp.GetRequest, names, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return mergeForwarded(ret, res, positions)
+}
+
+// forwardGetNext forwards a GetNext request. Successors out of view are skipped, as by serveGetNextRequest
+func (p *ProxyForwarder) forwardGetNext(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	names := make([]string, len(i.Variables))
+	for id, varItem := range i.Variables {
+		names[id] = varItem.Name
+	}
+	return p.nextInView(names, names, scope)
+}
+
+// forwardGetBulk forwards a GetBulk request. The non-repeaters and the first repetition out of view
+// are asked again, as forwardGetNext does, and then answered alone. Otherwise the response ends
+// before the first repetition holding successors out of view, as an agent may return fewer
+// repetitions. See RFC3416 section 4.2.3
+func (p *ProxyForwarder) forwardGetBulk(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	names := make([]string, len(i.Variables))
+	for id, varItem := range i.Variables {
+		names[id] = varItem.Name
+	}
+	res, err := p.request(gosnmp.GetBulkRequest, names, i.NonRepeaters, i.MaxRepetitions)
+	if err != nil || res.Error != gosnmp.NoError {
+		return res, err
+	}
+	// the non-repeaters and the first repetition are one varbind per requested name
+	first := min(len(names), len(res.Variables))
+	var positions []int
+	var asked, starts []string
+	for id := 0; id < first; id++ {
+		if pdu := res.Variables[id]; pdu.Type != gosnmp.EndOfMibView && hidden(pdu, scope) {
+			positions = append(positions, id)
+			asked, starts = append(asked, names[id]), append(starts, pdu.Name)
+		}
+	}
+	if len(positions) != 0 {
+		next, err := p.nextInView(asked, starts, scope)
+		if err != nil || next.Error != gosnmp.NoError {
+			return next, err
+		}
+		for id, position := range positions {
+			res.Variables[position] = next.Variables[id]
+		}
+		// the next repetitions follow the successors out of view
+		res.Variables = res.Variables[:first]
+		return res, nil
+	}
+	repeaters := len(names) - min(int(i.NonRepeaters), len(names))
+	for row := first; row < len(res.Variables); row += repeaters {
+		for _, pdu := range res.Variables[row:min(row+repeaters, len(res.Variables))] {
+			if pdu.Type != gosnmp.EndOfMibView && hidden(pdu, scope) {
+				res.Variables = res.Variables[:row]
+				return res, nil
+			}
+		}
+	}
+	return res, nil
+}
+
+// nextInView asks the downstream agent the successors in view of starts, for the varbinds of names.
+// Successors out of view are asked again, until one is in view or the MIB view ends.
+func (p *ProxyForwarder) nextInView(names, starts []string, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	ret := &gosnmp.SnmpPacket{Variables: make([]gosnmp.SnmpPDU, len(names))}
+	positions := make([]int, len(names))
+	for id := range positions {
+		positions[id] = id
+	}
+	pending := append([]string(nil), starts...)
+	for len(positions) != 0 {
+		res, err := p.request(gosnmp.GetNextRequest, pending, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != gosnmp.NoError || len(res.Variables) != len(positions) {
+			return mergeForwarded(ret, res, positions)
+		}
+		var next []int
+		var nextPending []string
+		for id, position := range positions {
+			pdu := res.Variables[id]
+			if pdu.Type == gosnmp.EndOfMibView {
+				ret.Variables[position] = gosnmp.SnmpPDU{Name: names[position], Type: gosnmp.EndOfMibView}
+				continue
+			}
+			if !hidden(pdu, scope) {
+				ret.Variables[position] = pdu
+				continue
+			}
+			// a downstream agent going backwards would be asked forever
+			from := varbindOID(gosnmp.SnmpPDU{Name: pending[id]})
+			if oid := varbindOID(pdu); oid == nil || from == nil || oid.Compare(from) <= 0 {
+				return nil, errors.Errorf("downstream answered %v as successor of %v", pdu.Name, pending[id])
+			}
+			next, nextPending = append(next, position), append(nextPending, pdu.Name)
+		}
+		positions, pending = next, nextPending
+	}
+	return ret, nil
+}
+
+// hidden reports if pdu, answered by the downstream agent, is not returned to the requester: out of
+// its view, or a Counter64 for SNMPv1
+func hidden(pdu gosnmp.SnmpPDU, scope *requestScope) bool {
+	oid := varbindOID(pdu)
+	return oid == nil || !scope.inView(oid) || scope != nil && scope.skipCounter64 && pdu.Type == gosnmp.Counter64
+}
+
+// forwardSet forwards a SetRequest, unless a varbind could not be written by the requester
+func (p *ProxyForwarder) forwardSet(i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	for id, varItem := range i.Variables {
+		oid := varbindOID(varItem)
+		if oid == nil || !scope.writable() || !scope.inView(oid) {
+			for _, each := range i.Variables {
+				scope.auditSet(each, nil, gosnmp.NoAccess, nil)
+			}
+			ret := &gosnmp.SnmpPacket{Variables: i.Variables}
+			setErrorStatus(ret, gosnmp.NoAccess, id+1)
+			return ret, nil
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := connect(p.Client); err != nil {
+		return nil, err
+	}
+	res, err := p.Client.Set(i.Variables)
+	if err != nil {
+		return nil, err
+	}
+	if p.Client.Version == gosnmp.Version1 {
+		res.Error = v2ErrorFromV1Set(res.Error)
+	}
+	for id, varItem := range i.Variables {
+		var errret gosnmp.SNMPError
+		if res.Error != gosnmp.NoError && (res.ErrorIndex == 0 || int(res.ErrorIndex) == id+1) {
+			errret = res.Error
+		}
+		scope.auditSet(varItem, nil, errret, nil)
+	}
+	return res, nil
+}
+
+// v2ErrorFromV1Set maps the error-status of a SNMPv1 response to a SetRequest to SNMPv2. See RFC3584 section 4.3
+func v2ErrorFromV1Set(err gosnmp.SNMPError) gosnmp.SNMPError {
+	switch err {
+	case gosnmp.NoSuchName, gosnmp.ReadOnly:
+		return gosnmp.NotWritable
+	case gosnmp.BadValue:
+		return gosnmp.WrongValue
+	default:
+		return err
+	}
+}
+
+// request sends a Get, GetNext or GetBulk request of names to the downstream agent.
+//
+//	SNMPv1 agents are asked GetNext for GetBulk, and again without the varbind they
+//	report noSuchName for. That varbind becomes noSuchInstance or endOfMibView. See RFC3584 section 4.3
+func (p *ProxyForwarder) request(pduType gosnmp.PDUType, names []string, nonRepeaters uint8, maxRepetitions uint32) (*gosnmp.SnmpPacket, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := connect(p.Client); err != nil {
+		return nil, err
+	}
+	if p.Client.Version != gosnmp.Version1 {
+		switch pduType {
+		case gosnmp.GetRequest:
+			return p.Client.Get(names)
+		case gosnmp.GetNextRequest:
+			return p.Client.GetNext(names)
+		default:
+			return p.Client.GetBulk(names, nonRepeaters, maxRepetitions)
+		}
+	}
+
+	exception := gosnmp.NoSuchInstance
+	if pduType != gosnmp.GetRequest {
+		pduType, exception = gosnmp.GetNextRequest, gosnmp.EndOfMibView
+	}
+	ret := &gosnmp.SnmpPacket{Variables: make([]gosnmp.SnmpPDU, len(names))}
+	positions := make([]int, len(names))
+	for id := range positions {
+		positions[id] = id
+	}
+	for len(positions) != 0 {
+		pending := make([]string, len(positions))
+		for id, position := range positions {
+			pending[id] = names[position]
+		}
+		var res *gosnmp.SnmpPacket
+		var err error
+		if pduType == gosnmp.GetRequest {
+			res, err = p.Client.Get(pending)
+		} else {
+			res, err = p.Client.GetNext(pending)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if res.Error == gosnmp.NoSuchName && res.ErrorIndex >= 1 && int(res.ErrorIndex) <= len(positions) {
+			missing := positions[res.ErrorIndex-1]
+			ret.Variables[missing] = gosnmp.SnmpPDU{Name: names[missing], Type: exception}
+			positions = append(positions[:res.ErrorIndex-1], positions[res.ErrorIndex:]...)
+			continue
+		}
+		return mergeForwarded(ret, res, positions)
+	}
+	return ret, nil
+}
+
+// mergeForwarded puts the varbinds of res, a response to the varbinds at positions, into ret
+func mergeForwarded(ret, res *gosnmp.SnmpPacket, positions []int) (*gosnmp.SnmpPacket, error) {
+	if res.Error != gosnmp.NoError {
+		ret.Error = res.Error
+		if res.ErrorIndex >= 1 && int(res.ErrorIndex) <= len(positions) {
+			setErrorStatus(ret, res.Error, positions[res.ErrorIndex-1]+1)
+		}
+	}
+	if len(res.Variables) != len(positions) {
+		if res.Error != gosnmp.NoError {
+			return ret, nil
+		}
+		return nil, errors.Errorf("downstream answered %d varbinds for %d", len(res.Variables), len(positions))
+	}
+	for id, position := range positions {
+		ret.Variables[position] = res.Variables[id]
+	}
+	return ret, nil
+}
+
+// serveTrap forwards a trap or an inform to the notification receivers. Informs are acknowledged
+// once forwarded, genErr if no receiver could get them.
+func (p *ProxyForwarder) serveTrap(t *SubAgent, i *gosnmp.SnmpPacket, scope *requestScope) (*gosnmp.SnmpPacket, error) {
+	logger := scope.loggerOr(t.logger)
+	var peer string
+	if scope != nil && scope.info != nil {
+		if ip := scope.info.peerIP(); ip != nil {
+			peer = ip.String()
+		}
+	}
+	forwarded := 0
+	p.mu.Lock()
+	for _, target := range p.NotificationTargets {
+		var trap gosnmp.SnmpTrap
+		if target.Version == gosnmp.Version1 {
+			trap = trapToV1(i, peer)
+		} else {
+			trap = trapToV2(i)
+			trap.IsInform = i.PDUType == gosnmp.InformRequest
+		}
+		err := connect(target)
+		if err == nil {
+			_, err = target.SendTrap(trap)
+		}
+		if err != nil {
+			logger.Debug("proxy trap forward failed", "target", target.Target, "err", err)
+			continue
+		}
+		forwarded++
+	}
+	p.mu.Unlock()
+	if forwarded == 0 && len(p.NotificationTargets) != 0 {
+		t.countProxyDrop()
+	}
+	if i.PDUType != gosnmp.InformRequest {
+		return nil, nil
+	}
+	ret := copySnmpPacket(i)
+	ret.PDUType = gosnmp.GetResponse
+	if forwarded == 0 {
+		ret.Error = gosnmp.GenErr
+	}
+	return &ret, nil
+}
+
+// trapToV2 returns the varbinds of a SNMPv2 trap for i, translated from SNMPv1. See RFC3584 section 3.1
+func trapToV2(i *gosnmp.SnmpPacket) gosnmp.SnmpTrap {
+	if i.PDUType != gosnmp.Trap {
+		return gosnmp.SnmpTrap{Variables: i.Variables}
+	}
+	trapOID := fmt.Sprintf("%s.%d", oidSnmpTraps, i.GenericTrap+1)
+	if i.GenericTrap == 6 {
+		trapOID = fmt.Sprintf("%s.0.%d", strings.TrimPrefix(i.Enterprise, "."), i.SpecificTrap)
+	}
+	vars := []gosnmp.SnmpPDU{
+		{Name: oidSysUpTime, Type: gosnmp.TimeTicks, Value: uint32(i.Timestamp)},
+		{Name: oidSnmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: trapOID},
+	}
+	vars = append(vars, i.Variables...)
+	if i.AgentAddress != "" {
+		vars = append(vars, gosnmp.SnmpPDU{Name: oidSnmpTrapAddress, Type: gosnmp.IPAddress, Value: i.AgentAddress})
+	}
+	vars = append(vars, gosnmp.SnmpPDU{Name: oidSnmpTrapEnterprise, Type: gosnmp.ObjectIdentifier, Value: i.Enterprise})
+	return gosnmp.SnmpTrap{Variables: vars}
+}
+
+// trapToV1 translates i to a SNMPv1 trap, from agent address peer unless told. See RFC3584 section 3.2
+func trapToV1(i *gosnmp.SnmpPacket, peer string) gosnmp.SnmpTrap {
+	if i.PDUType == gosnmp.Trap {
+		return gosnmp.SnmpTrap{Variables: i.Variables, Enterprise: i.Enterprise, AgentAddress: i.AgentAddress,
+			GenericTrap: i.GenericTrap, SpecificTrap: i.SpecificTrap, Timestamp: i.Timestamp}
+	}
+	ret := gosnmp.SnmpTrap{AgentAddress: peer}
+	var trapOID string
+	for _, varItem := range i.Variables {
+		name := strings.TrimPrefix(varItem.Name, ".")
+		switch {
+		case name == oidSysUpTime:
+			if ticks, ok := varItem.Value.(uint32); ok {
+				ret.Timestamp = uint(ticks)
+			}
+		case name == oidSnmpTrapOID:
+			trapOID, _ = varItem.Value.(string)
+			trapOID = strings.TrimPrefix(trapOID, ".")
+		case name == oidSnmpTrapEnterprise:
+			ret.Enterprise, _ = varItem.Value.(string)
+		case name == oidSnmpTrapAddress:
+			if address, ok := varItem.Value.(string); ok && address != "" {
+				ret.AgentAddress = address
+			}
+		case varItem.Type == gosnmp.Counter64:
+			// SNMPv1 could not carry it
+		default:
+			ret.Variables = append(ret.Variables, varItem)
+		}
+	}
+	if ret.AgentAddress == "" {
+		ret.AgentAddress = "0.0.0.0"
+	}
+	arcs := strings.Split(trapOID, ".")
+	if generic, found := strings.CutPrefix(trapOID, oidSnmpTraps+"."); found && !strings.Contains(generic, ".") {
+		number, _ := strconv.Atoi(generic)
+		if number >= 1 && number <= 6 {
+			ret.GenericTrap = number - 1
+			if ret.Enterprise == "" {
+				ret.Enterprise = oidSnmpTraps
+			}
+			return ret
+		}
+	}
+	ret.GenericTrap = 6
+	if len(arcs) >= 2 {
+		ret.SpecificTrap, _ = strconv.Atoi(arcs[len(arcs)-1])
+		arcs = arcs[:len(arcs)-1]
+		if len(arcs) >= 3 && arcs[len(arcs)-1] == "0" {
+			arcs = arcs[:len(arcs)-1]
+		}
+		ret.Enterprise = strings.Join(arcs, ".")
+	}
+	if ret.Enterprise == "" {
+		ret.Enterprise = oidSnmpTraps
+	}
+	return ret
+}
+
+// countProxyDrop counts a request or trap which could not be forwarded (snmpProxyDrops)
+func (t *SubAgent) countProxyDrop() {
+	if t.master != nil && t.master.Metrics != nil {
+		t.master.Metrics.proxyDrops.Add(1)
+	}
+}
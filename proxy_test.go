@@ -0,0 +1,225 @@
+package GoSNMPServer
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// proxyTestOIDs are served by the downstream agent. The ones of 1.3.6.1.2.1.2 and 1.3.6.1.4 are out
+// of the view of "public"
+var proxyTestOIDs = []string{
+	"1.3.6.1.2.1.1.1.0",
+	"1.3.6.1.2.1.1.2.0",
+	"1.3.6.1.2.1.2.1.0",
+	"1.3.6.1.2.1.2.2.0",
+	"1.3.6.1.2.1.3.1.0",
+	"1.3.6.1.4.1.1.1",
+}
+
+// proxyTestDownstream serves proxyTestOIDs and a Counter64 at 1.3.6.1.2.1.1.3.0 in version
+func proxyTestDownstream(t *testing.T, version EnabledVersion) *gosnmp.GoSNMP {
+	items := append(stringOIDs(proxyTestOIDs...), &PDUValueControlItem{
+		OID:   "1.3.6.1.2.1.1.3.0",
+		Type:  gosnmp.Counter64,
+		OnGet: func() (interface{}, error) { return uint64(1 << 40), nil },
+	})
+	_, port := serveUDP(t, MasterAgent{AllowedVersion: version, SubAgents: []*SubAgent{{OIDs: items}}})
+	client := udpClient(t, port, gosnmp.Version2c)
+	if version == SNMPV1 {
+		client.Version = gosnmp.Version1
+	}
+	return client
+}
+
+// proxyTestMaster forwards "public", limited to 1.3.6.1.2.1.1 and 1.3.6.1.2.1.3, and "private" to downstream
+func proxyTestMaster(downstream *gosnmp.GoSNMP, targets ...*gosnmp.GoSNMP) MasterAgent {
+	return MasterAgent{
+		AllowedVersion: SNMPV1 | SNMPV2c,
+		Metrics:        NewMetrics(),
+		SecurityConfig: SecurityConfig{CommunityACLs: []CommunityACL{
+			{Community: "public", View: OIDView{"1.3.6.1.2.1.1", "1.3.6.1.2.1.3"}},
+			{Community: "private", ReadWrite: true},
+		}},
+		SubAgents: []*SubAgent{{
+			CommunityIDs: []string{"public", "private"},
+			Proxy:        &ProxyForwarder{Client: downstream, NotificationTargets: targets},
+		}},
+	}
+}
+
+func pduNames(pdus []gosnmp.SnmpPDU) string {
+	names := make([]string, 0, len(pdus))
+	for _, pdu := range pdus {
+		names = append(names, strings.TrimPrefix(pdu.Name, "."))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestProxyWalkView(t *testing.T) {
+	for _, version := range []EnabledVersion{SNMPV1, SNMPV2c} {
+		_, port := serveUDP(t, proxyTestMaster(proxyTestDownstream(t, version)))
+		all := "1.3.6.1.2.1.1.1.0 1.3.6.1.2.1.1.2.0 1.3.6.1.2.1.1.3.0 1.3.6.1.2.1.2.1.0 1.3.6.1.2.1.2.2.0 1.3.6.1.2.1.3.1.0 1.3.6.1.4.1.1.1"
+		for _, each := range []struct {
+			community string
+			version   gosnmp.SnmpVersion
+			expected  string
+		}{
+			{"public", gosnmp.Version2c, "1.3.6.1.2.1.1.1.0 1.3.6.1.2.1.1.2.0 1.3.6.1.2.1.1.3.0 1.3.6.1.2.1.3.1.0"},
+			// no Counter64 for SNMPv1
+			{"public", gosnmp.Version1, "1.3.6.1.2.1.1.1.0 1.3.6.1.2.1.1.2.0 1.3.6.1.2.1.3.1.0"},
+			{"private", gosnmp.Version2c, all},
+		} {
+			if version == SNMPV1 {
+				// nor from SNMPv1 agents
+				each.expected = strings.ReplaceAll(each.expected, " 1.3.6.1.2.1.1.3.0", "")
+			}
+			client := communityClient(t, port, each.version, each.community)
+			walk, err := client.WalkAll("1.3.6.1")
+			if err != nil || pduNames(walk) != each.expected {
+				t.Errorf("downstream %v, %s %v walk: %v %v", version, each.community, each.version, pduNames(walk), err)
+			}
+			if each.version == gosnmp.Version1 {
+				continue
+			}
+			bulk, err := client.BulkWalkAll("1.3.6.1")
+			if err != nil || pduNames(bulk) != each.expected {
+				t.Errorf("downstream %v, %s bulk walk: %v %v", version, each.community, pduNames(bulk), err)
+			}
+		}
+
+		// non-repeaters and repeaters past the view
+		client := communityClient(t, port, gosnmp.Version2c, "public")
+		expected := "1.3.6.1.2.1.3.1.0 1.3.6.1.2.1.1.3.0"
+		if version == SNMPV1 {
+			expected = "1.3.6.1.2.1.3.1.0 1.3.6.1.2.1.3.1.0"
+		}
+		response, err := client.GetBulk([]string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.2.0"}, 1, 3)
+		if err != nil || response.Error != gosnmp.NoError || pduNames(response.Variables) != expected {
+			t.Errorf("downstream %v, GetBulk: %v %v", version, pduNames(response.Variables), err)
+		}
+		response, err = client.GetNext([]string{"1.3.6.1.2.1.3.1.0"})
+		if err != nil || len(response.Variables) != 1 || response.Variables[0].Type != gosnmp.EndOfMibView ||
+			pduNames(response.Variables) != "1.3.6.1.2.1.3.1.0" {
+			t.Errorf("downstream %v, GetNext at the end of the view: %v %v", version, response.Variables, err)
+		}
+	}
+}
+
+func TestProxyGetSet(t *testing.T) {
+	server, port := serveUDP(t, proxyTestMaster(proxyTestDownstream(t, SNMPV2c)))
+	public := communityClient(t, port, gosnmp.Version2c, "public")
+	response, err := public.Get([]string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.1.0", "1.3.6.1.2.1.1.9.0"})
+	if err != nil || response.Error != gosnmp.NoError {
+		t.Fatalf("Get: %v %v", response, err)
+	}
+	if value, _ := response.Variables[0].Value.([]byte); string(value) != "v1.3.6.1.2.1.1.1.0" ||
+		response.Variables[1].Type != gosnmp.NoSuchObject || response.Variables[2].Type != gosnmp.NoSuchObject {
+		t.Errorf("Get: %v", response.Variables)
+	}
+
+	set := []gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "x"}}
+	if response, err := public.Set(set); err != nil || response.Error != gosnmp.NoAccess || response.ErrorIndex != 1 {
+		t.Errorf("read only Set: %v %v", response, err)
+	}
+	private := communityClient(t, port, gosnmp.Version2c, "private")
+	if response, err := private.Set(set); err != nil || response.Error != gosnmp.NoError {
+		t.Errorf("Set: %v %v", response, err)
+	}
+
+	// concurrent requests share the downstream client
+	var wg sync.WaitGroup
+	for id := 0; id < 4; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := udpClient(t, port, gosnmp.Version2c)
+			if err := client.Connect(); err != nil {
+				t.Error(err)
+				return
+			}
+			if walk, err := client.BulkWalkAll("1.3.6.1.2.1.1"); err != nil || len(walk) != 3 {
+				t.Errorf("concurrent walk: %v %v", pduNames(walk), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if drops := server.master.Metrics.proxyDrops.Load(); drops != 0 {
+		t.Errorf("%d drops", drops)
+	}
+}
+
+func TestProxyDownstreamDown(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing answers there
+	downstream := udpClient(t, uint16(conn.LocalAddr().(*net.UDPAddr).Port), gosnmp.Version2c)
+	defer conn.Close()
+	downstream.Timeout, downstream.Retries = 50*time.Millisecond, 0
+	server, port := serveUDP(t, proxyTestMaster(downstream))
+	client := communityClient(t, port, gosnmp.Version2c, "public")
+	client.Timeout = time.Second
+	response, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"})
+	if err != nil || response.Error != gosnmp.GenErr {
+		t.Errorf("Get: %v %v", response, err)
+	}
+	if drops := server.master.Metrics.proxyDrops.Load(); drops != 1 {
+		t.Errorf("%d drops", drops)
+	}
+}
+
+func TestProxyTrap(t *testing.T) {
+	receiver, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	target := udpClient(t, uint16(receiver.LocalAddr().(*net.UDPAddr).Port), gosnmp.Version1)
+	_, port := serveUDP(t, proxyTestMaster(proxyTestDownstream(t, SNMPV2c), target))
+	received := func() *gosnmp.SnmpPacket {
+		t.Helper()
+		receiver.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, DefaultMaxMessageSize)
+		count, err := receiver.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder := gosnmp.GoSNMP{Version: gosnmp.Version1, Logger: gosnmp.NewLogger(nil)}
+		trap, err := decoder.SnmpDecodePacket(buffer[:count])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return trap
+	}
+
+	client := communityClient(t, port, gosnmp.Version2c, "private")
+	trap := gosnmp.SnmpTrap{Variables: []gosnmp.SnmpPDU{
+		{Name: oidSnmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: "1.3.6.1.4.1.9.0.7"},
+		{Name: "1.3.6.1.2.1.2.2.1.1.1", Type: gosnmp.Integer, Value: 1},
+	}}
+	if _, err := client.SendTrap(trap); err != nil {
+		t.Fatal(err)
+	}
+	v1 := received()
+	if v1.PDUType != gosnmp.Trap || strings.TrimPrefix(v1.Enterprise, ".") != "1.3.6.1.4.1.9" ||
+		v1.GenericTrap != 6 || v1.SpecificTrap != 7 || v1.AgentAddress != "127.0.0.1" || len(v1.Variables) != 1 {
+		t.Errorf("trap forwarded as %v %v %d/%d from %v: %v", v1.PDUType, v1.Enterprise, v1.GenericTrap,
+			v1.SpecificTrap, v1.AgentAddress, v1.Variables)
+	}
+
+	// informs are acknowledged once forwarded
+	trap.IsInform = true
+	response, err := client.SendTrap(trap)
+	if err != nil || response.PDUType != gosnmp.GetResponse || response.Error != gosnmp.NoError {
+		t.Errorf("inform: %v %v", response, err)
+	}
+	if v1 := received(); v1.PDUType != gosnmp.Trap {
+		t.Errorf("inform forwarded as %v", v1.PDUType)
+	}
+}
@@ -0,0 +1,157 @@
+package GoSNMPServer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// rateLimitSweepSize is the number of buckets over which idle ones are dropped
+const rateLimitSweepSize = 4096
+
+// RateLimit is a token bucket: Rate requests per second on average, in bursts of up to Burst.
+//
+//	The zero RateLimit does not limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+// RateLimits protects the agent from managers sending too much, and from being used as a reflector.
+// Requests over a limit are dropped without response and counted in snmpSilentDrops.
+type RateLimits struct {
+	// PerIP limits the messages of each source address, before they are decoded
+	PerIP RateLimit
+	// PerCommunity limits the SNMPv1/v2c requests of each known community
+	PerCommunity RateLimit
+	// PerUser limits the SNMPv3 requests of each known user, before the keys are computed
+	PerUser RateLimit
+
+	// MaxAmplification limits SNMPv1/v2c responses to this multiple of the request size,
+	// as GetBulk requests with spoofed sources would amplify traffic. 0 for no limit
+	MaxAmplification int
+}
+
+// rateLimiter holds the buckets of one RateLimit by key
+type rateLimiter struct {
+	limit     RateLimit
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if !limit.enabled() {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token of key. nil limiter allows all
+func (l *rateLimiter) allow(key string) bool {
+	if l == nil {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buckets) >= rateLimitSweepSize && now.Sub(l.lastSweep) > time.Second {
+		l.sweep(now)
+	}
+	bucket, found := l.buckets[key]
+	if !found {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	l.refill(bucket, now)
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.limit.Rate
+	if burst := float64(l.limit.Burst); bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+}
+
+// sweep drops full buckets, which act as new ones
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimiters applies MasterAgent.RateLimits
+type rateLimiters struct {
+	perIP        *rateLimiter
+	perCommunity *rateLimiter
+	perUser      *rateLimiter
+}
+
+func newRateLimiters(limits RateLimits) *rateLimiters {
+	return &rateLimiters{
+		perIP:        newRateLimiter(limits.PerIP),
+		perCommunity: newRateLimiter(limits.PerCommunity),
+		perUser:      newRateLimiter(limits.PerUser),
+	}
+}
+
+// allowPeer takes a token of the source address of info. Unknown sources are not limited
+func (l *rateLimiters) allowPeer(info *RequestInfo) bool {
+	ip := info.peerIP()
+	if l == nil || ip == nil {
+		return true
+	}
+	return l.perIP.allow(ip.String())
+}
+
+// allowCommunity takes a token of community
+func (l *rateLimiters) allowCommunity(community string) bool {
+	return l == nil || l.perCommunity.allow(community)
+}
+
+// allowUser takes a token of the SNMPv3 user
+func (l *rateLimiters) allowUser(username string) bool {
+	return l == nil || l.perUser.allow(username)
+}
+
+// dropRequest drops a request over a limit
+func (t *MasterAgent) dropRequest(limit string) ([]byte, error) {
+	if t.Metrics != nil {
+		t.Metrics.silentDrops.Add(1)
+	}
+	return nil, errors.WithMessagef(ErrRequestDropped, "over %v rate limit", limit)
+}
+
+// maxAmplification caps limit to the MaxAmplification of requestBytes
+func (limits RateLimits) maxAmplification(limit, requestBytes int) int {
+	if limits.MaxAmplification <= 0 || requestBytes <= 0 {
+		return limit
+	}
+	if capped := limits.MaxAmplification * requestBytes; capped < limit {
+		return capped
+	}
+	return limit
+}
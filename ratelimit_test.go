@@ -0,0 +1,123 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if !(*rateLimiter)(nil).allow("any") || newRateLimiter(RateLimit{}) != nil {
+		t.Fatal("zero RateLimit limits")
+	}
+	limiter := newRateLimiter(RateLimit{Rate: 10, Burst: 3})
+	for id := 0; id < 3; id++ {
+		if !limiter.allow("a") {
+			t.Fatalf("request %d of the burst dropped", id)
+		}
+	}
+	if limiter.allow("a") {
+		t.Error("request over the burst allowed")
+	}
+	if !limiter.allow("b") {
+		t.Error("keys share their bucket")
+	}
+	// 100ms later, one token at 10 per second
+	limiter.buckets["a"].last = limiter.buckets["a"].last.Add(-100 * time.Millisecond)
+	if !limiter.allow("a") || limiter.allow("a") {
+		t.Error("bucket not refilled at Rate")
+	}
+	limiter.buckets["a"].last = limiter.buckets["a"].last.Add(-time.Hour)
+	limiter.refill(limiter.buckets["a"], time.Now())
+	if limiter.buckets["a"].tokens != 3 {
+		t.Errorf("%v tokens, expected Burst", limiter.buckets["a"].tokens)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Rate: 0.001, Burst: 1})
+	for id := 0; id < rateLimitSweepSize; id++ {
+		limiter.allow(fmt.Sprint(id))
+	}
+	limiter.buckets["0"].last = limiter.buckets["0"].last.Add(-time.Hour)
+	limiter.lastSweep = time.Now().Add(-time.Minute)
+	limiter.allow("new")
+	if _, found := limiter.buckets["0"]; found {
+		t.Error("full bucket not swept")
+	}
+	if _, found := limiter.buckets["1"]; !found {
+		t.Error("empty bucket swept")
+	}
+}
+
+func TestMaxAmplification(t *testing.T) {
+	for _, each := range []struct {
+		amplification, limit, requestBytes, expected int
+	}{
+		{0, 1500, 40, 1500},
+		{3, 1500, 40, 120},
+		{3, 100, 40, 100},
+		{3, 1500, 0, 1500},
+	} {
+		limits := RateLimits{MaxAmplification: each.amplification}
+		if got := limits.maxAmplification(each.limit, each.requestBytes); got != each.expected {
+			t.Errorf("%+v: got %d", each, got)
+		}
+	}
+}
+
+func TestRateLimitPerCommunity(t *testing.T) {
+	metrics := NewMetrics()
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		Metrics:        metrics,
+		RateLimits:     RateLimits{PerCommunity: RateLimit{Rate: 0.01, Burst: 3}},
+		SecurityConfig: SecurityConfig{CommunityACLs: []CommunityACL{{Community: "public"}, {Community: "private"}}},
+		SubAgents:      []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}},
+	}
+	_, port := serveUDP(t, master)
+	public := communityClient(t, port, gosnmp.Version2c, "public")
+	public.Retries = 0
+	answered := 0
+	for id := 0; id < 5; id++ {
+		if _, err := public.Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+			answered++
+		}
+	}
+	if answered != 3 {
+		t.Errorf("%d requests answered, expected the burst of 3", answered)
+	}
+	if drops := metrics.silentDrops.Load(); drops != 2 {
+		t.Errorf("snmpSilentDrops = %d, expected 2", drops)
+	}
+	if _, err := communityClient(t, port, gosnmp.Version2c, "private").Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Errorf("other community limited: %v", err)
+	}
+}
+
+func TestRateLimitMaxAmplification(t *testing.T) {
+	oids := make([]string, 50)
+	for id := range oids {
+		oids[id] = fmt.Sprintf("1.3.6.1.2.1.1.%d.0", id+1)
+	}
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		RateLimits:     RateLimits{MaxAmplification: 3},
+		SubAgents:      []*SubAgent{{OIDs: stringOIDs(oids...)}},
+	}
+	_, port := serveUDP(t, master)
+	client := communityClient(t, port, gosnmp.Version2c, "public")
+	response, err := client.GetBulk([]string{"1.3.6.1.2.1.1"}, 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each varbind takes about 40 octets of the 3 * ~45 octets allowed
+	if len(response.Variables) == 0 || len(response.Variables) >= 5 {
+		t.Errorf("%d varbinds answered", len(response.Variables))
+	}
+	if response.Error != gosnmp.NoError {
+		t.Errorf("truncated GetBulk answered %v", response.Error)
+	}
+}
@@ -0,0 +1,373 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+
+	"github.com/eriksejr/GoSNMPServer"
+)
+
+// Record is one variable of a recording
+type Record struct {
+	OID   string
+	Type  gosnmp.Asn1BER
+	Value interface{}
+	// Variation is the variation module of the value (VariationNumeric, VariationWriteCache).
+	// Empty for a static value
+	Variation string
+	// Params are the parameters of Variation, e.g. rate=10
+	Params map[string]string
+}
+
+// snmprecTypes are the BER tags of snmprec files
+var snmprecTypes = map[int]gosnmp.Asn1BER{
+	2:  gosnmp.Integer,
+	4:  gosnmp.OctetString,
+	5:  gosnmp.Null,
+	6:  gosnmp.ObjectIdentifier,
+	64: gosnmp.IPAddress,
+	65: gosnmp.Counter32,
+	66: gosnmp.Gauge32,
+	67: gosnmp.TimeTicks,
+	68: gosnmp.Opaque,
+	70: gosnmp.Counter64,
+}
+
+// ParseSnmprec reads records of the snmpsim .snmprec format:
+//
+//	OID|TAG|VALUE
+//	  TAG is the BER tag in decimal, e.g. 4 for OCTET STRING. A trailing x means VALUE is hex encoded.
+//	  TAG:MODULE selects a variation module, VALUE being its parameters: 65:numeric|rate=100,initial=5
+func ParseSnmprec(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := newLineScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		record, err := parseSnmprecLine(line)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "snmprec line %d", lineNo)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func parseSnmprecLine(line string) (Record, error) {
+	fields := strings.SplitN(line, "|", 3)
+	if len(fields) != 3 {
+		return Record{}, errors.Errorf("expects OID|TAG|VALUE: %q", line)
+	}
+	oid, err := GoSNMPServer.ParseOID(fields[0])
+	if err != nil {
+		return Record{}, err
+	}
+	record := Record{OID: oid.String()}
+	tag, module, _ := strings.Cut(fields[1], ":")
+	isHex := strings.HasSuffix(tag, "x")
+	tag = strings.TrimSuffix(tag, "x")
+	tagNum, err := strconv.Atoi(tag)
+	if err != nil {
+		return Record{}, errors.Errorf("bad tag %q", fields[1])
+	}
+	var found bool
+	if record.Type, found = snmprecTypes[tagNum]; !found {
+		return Record{}, errors.Errorf("unsupported tag %d", tagNum)
+	}
+	value := fields[2]
+	if module != "" {
+		record.Variation = module
+		record.Params = parseParams(value)
+		value = record.Params["value"]
+		if record.Variation == VariationNumeric {
+			value = record.Params["initial"]
+			if value == "" {
+				value = "0"
+			}
+		}
+	}
+	if isHex && record.Type != gosnmp.Null {
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return Record{}, errors.WithMessage(err, "bad hex value")
+		}
+		record.Value, err = hexValue(record.Type, data)
+		if err != nil {
+			return Record{}, err
+		}
+	} else if record.Value, err = parseValue(record.Type, value); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// parseParams parses key=value,key=value
+func parseParams(text string) map[string]string {
+	params := make(map[string]string)
+	for _, each := range strings.Split(text, ",") {
+		key, value, _ := strings.Cut(each, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			params[key] = strings.TrimSpace(value)
+		}
+	}
+	return params
+}
+
+// parseValue parses the text form of a value of typ
+func parseValue(typ gosnmp.Asn1BER, text string) (interface{}, error) {
+	switch typ {
+	case gosnmp.Integer:
+		value, err := strconv.ParseInt(strings.TrimSpace(text), 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("bad INTEGER %q", text)
+		}
+		return int(value), nil
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		value, err := strconv.ParseUint(strings.TrimSpace(text), 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("bad %v %q", typ, text)
+		}
+		return uint32(value), nil
+	case gosnmp.Counter64:
+		value, err := strconv.ParseUint(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("bad Counter64 %q", text)
+		}
+		return value, nil
+	case gosnmp.OctetString, gosnmp.Opaque:
+		return []byte(text), nil
+	case gosnmp.OpaqueFloat:
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 32)
+		if err != nil {
+			return nil, errors.Errorf("bad Float %q", text)
+		}
+		return float32(value), nil
+	case gosnmp.OpaqueDouble:
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, errors.Errorf("bad Double %q", text)
+		}
+		return value, nil
+	case gosnmp.Null:
+		return nil, nil
+	case gosnmp.ObjectIdentifier:
+		oid, err := GoSNMPServer.ParseOID(strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+		return "." + oid.String(), nil
+	case gosnmp.IPAddress:
+		ip := net.ParseIP(strings.TrimSpace(text)).To4()
+		if ip == nil {
+			return nil, errors.Errorf("bad IpAddress %q", text)
+		}
+		return []byte(ip), nil
+	}
+	return nil, errors.Errorf("unsupported type %v", typ)
+}
+
+// hexValue decodes the hex form of a value of typ
+func hexValue(typ gosnmp.Asn1BER, data []byte) (interface{}, error) {
+	switch typ {
+	case gosnmp.OctetString, gosnmp.Opaque:
+		return data, nil
+	case gosnmp.IPAddress:
+		if len(data) != net.IPv4len {
+			return nil, errors.Errorf("bad IpAddress %x", data)
+		}
+		return data, nil
+	}
+	return nil, errors.Errorf("hex value of %v is not supported", typ)
+}
+
+var (
+	// snmpwalkLine matches .1.3.6.1.2.1.1.1.0 = STRING: "text"
+	snmpwalkLine = regexp.MustCompile(`^(\.?[0-9]+(?:\.[0-9]+)*) = (.*)$`)
+	// snmpwalkNumber is the first number of a value, e.g. 1 of up(1) or 5 of "5 seconds"
+	snmpwalkNumber = regexp.MustCompile(`-?[0-9]+`)
+	// snmpwalkEnum is the number of an enumeration, e.g. up(1)
+	snmpwalkEnum = regexp.MustCompile(`\((-?[0-9]+)\)`)
+)
+
+// ParseSnmpwalk reads the output of snmpwalk -On (numeric OIDs), e.g.
+//
+//	.1.3.6.1.2.1.1.1.0 = STRING: "Linux router 5.10"
+//	.1.3.6.1.2.1.1.3.0 = Timeticks: (12345) 0:02:03.45
+//
+// Multi-line strings continue on the following lines. Varbinds without value
+// (No Such Object / No Such Instance / No more variables) are skipped.
+func ParseSnmpwalk(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := newLineScanner(r)
+	lineNo := 0
+	// continued is the record whose value goes on in the next lines
+	var continued *Record
+	var text strings.Builder
+	flush := func() error {
+		if continued == nil {
+			return nil
+		}
+		record := *continued
+		continued = nil
+		value, err := parseSnmpwalkValue(record.Type, text.String())
+		if err != nil {
+			return errors.WithMessagef(err, "snmpwalk oid %v", record.OID)
+		}
+		record.Value = value
+		records = append(records, record)
+		return nil
+	}
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		match := snmpwalkLine.FindStringSubmatch(line)
+		if match == nil {
+			if continued == nil {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				return nil, errors.Errorf("snmpwalk line %d: expects numeric OID = TYPE: VALUE (snmpwalk -On): %q", lineNo, line)
+			}
+			text.WriteString("\n")
+			text.WriteString(line)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		oid, err := GoSNMPServer.ParseOID(match[1])
+		if err != nil {
+			return nil, errors.WithMessagef(err, "snmpwalk line %d", lineNo)
+		}
+		typ, value, skip, err := splitSnmpwalkValue(match[2])
+		if err != nil {
+			return nil, errors.WithMessagef(err, "snmpwalk line %d", lineNo)
+		}
+		if skip {
+			continue
+		}
+		continued = &Record{OID: oid.String(), Type: typ}
+		text.Reset()
+		text.WriteString(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// splitSnmpwalkValue splits TYPE: VALUE
+func splitSnmpwalkValue(text string) (typ gosnmp.Asn1BER, value string, skip bool, err error) {
+	if strings.HasPrefix(text, "Wrong Type") {
+		// Wrong Type (should be Gauge32 or Unsigned32): INTEGER: 3
+		if _, rest, found := strings.Cut(text, "): "); found {
+			text = rest
+		}
+	}
+	switch {
+	case text == `""`:
+		return gosnmp.OctetString, `""`, false, nil
+	case text == "NULL":
+		return gosnmp.Null, "", false, nil
+	case strings.HasPrefix(text, "No Such Object"), strings.HasPrefix(text, "No Such Instance"),
+		strings.HasPrefix(text, "No more variables"):
+		return 0, "", true, nil
+	}
+	name, value, found := strings.Cut(text, ": ")
+	if !found {
+		name, value = strings.TrimSuffix(text, ":"), ""
+	}
+	switch name {
+	case "STRING":
+		return gosnmp.OctetString, value, false, nil
+	case "Hex-STRING", "BITS":
+		return gosnmp.OctetString, "hex:" + value, false, nil
+	case "INTEGER":
+		return gosnmp.Integer, value, false, nil
+	case "Counter32":
+		return gosnmp.Counter32, value, false, nil
+	case "Gauge32", "Unsigned32":
+		return gosnmp.Gauge32, value, false, nil
+	case "Counter64":
+		return gosnmp.Counter64, value, false, nil
+	case "Timeticks":
+		return gosnmp.TimeTicks, value, false, nil
+	case "OID":
+		return gosnmp.ObjectIdentifier, value, false, nil
+	case "IpAddress":
+		return gosnmp.IPAddress, value, false, nil
+	case "Network Address":
+		return gosnmp.IPAddress, "hex:" + value, false, nil
+	case "Opaque":
+		// Opaque: Float: 1.5
+		if number, isFloat := strings.CutPrefix(value, "Float: "); isFloat {
+			return gosnmp.OpaqueFloat, number, false, nil
+		}
+		if number, isDouble := strings.CutPrefix(value, "Double: "); isDouble {
+			return gosnmp.OpaqueDouble, number, false, nil
+		}
+		return gosnmp.Opaque, "hex:" + value, false, nil
+	}
+	return 0, "", false, errors.Errorf("unsupported type %q", name)
+}
+
+// parseSnmpwalkValue parses the value printed by snmpwalk for typ
+func parseSnmpwalkValue(typ gosnmp.Asn1BER, text string) (interface{}, error) {
+	if data, isHex := strings.CutPrefix(text, "hex:"); isHex {
+		decoded, err := hex.DecodeString(strings.Join(strings.Fields(data), ""))
+		if err != nil {
+			return nil, errors.WithMessage(err, "bad hex value")
+		}
+		return hexValue(typ, decoded)
+	}
+	switch typ {
+	case gosnmp.OctetString:
+		return []byte(unquote(text)), nil
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.Counter64:
+		number := snmpwalkNumber.FindString(text)
+		if enum := snmpwalkEnum.FindStringSubmatch(text); enum != nil {
+			number = enum[1]
+		}
+		return parseValue(typ, number)
+	case gosnmp.TimeTicks:
+		// (12345) 0:02:03.45
+		if enum := snmpwalkEnum.FindStringSubmatch(text); enum != nil {
+			return parseValue(typ, enum[1])
+		}
+		return parseValue(typ, snmpwalkNumber.FindString(text))
+	}
+	return parseValue(typ, text)
+}
+
+// unquote removes the quotes snmpwalk prints around strings
+func unquote(text string) string {
+	if len(text) >= 2 && strings.HasPrefix(text, `"`) && strings.HasSuffix(text, `"`) {
+		text = text[1 : len(text)-1]
+		return strings.ReplaceAll(text, `\"`, `"`)
+	}
+	return text
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return scanner
+}
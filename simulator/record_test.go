@@ -0,0 +1,98 @@
+package simulator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestParseSnmprec(t *testing.T) {
+	records, err := ParseSnmprec(strings.NewReader(`# comment
+1.3.6.1.2.1.1.1.0|4|Linux router
+.1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.8072
+1.3.6.1.2.1.1.3.0|67|12345
+
+1.3.6.1.2.1.1.5.0|4:writecache|value=router
+1.3.6.1.2.1.2.2.1.6.1|4x|00a0c9fffe01
+1.3.6.1.2.1.4.20.1.1.10.0.0.1|64|10.0.0.1
+1.3.6.1.2.1.2.2.1.10.1|65:numeric|initial=4294967290,rate=2
+1.3.6.1.2.1.31.1.1.1.6.1|70|18446744073709551000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Record{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Linux router")},
+		{OID: "1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.8072"},
+		{OID: "1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(12345)},
+		{OID: "1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("router"),
+			Variation: VariationWriteCache, Params: map[string]string{"value": "router"}},
+		{OID: "1.3.6.1.2.1.2.2.1.6.1", Type: gosnmp.OctetString, Value: []byte{0x00, 0xa0, 0xc9, 0xff, 0xfe, 0x01}},
+		{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: gosnmp.IPAddress, Value: []byte{10, 0, 0, 1}},
+		{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint32(4294967290),
+			Variation: VariationNumeric, Params: map[string]string{"initial": "4294967290", "rate": "2"}},
+		{OID: "1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(18446744073709551000)},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("records\n%+v\nexpected\n%+v", records, expected)
+	}
+}
+
+func TestParseSnmprecErrors(t *testing.T) {
+	for _, line := range []string{
+		"1.3.6.1.2.1.1.1.0|4",
+		"1.3.6.1.2.1.1.1.0|99|x",
+		"1.3.6.1.2.1.1.1.0|2|text",
+		"1.3.6.1.2.1.1.1.0|65|-1",
+		"1.3.6.1.2.1.1.1.0|4x|zz",
+		"1.3.6.1.2.1.1.1.0|64|10.0.0",
+		"a.b|4|text",
+	} {
+		if _, err := ParseSnmprec(strings.NewReader(line)); err == nil {
+			t.Errorf("%q parsed", line)
+		} else if !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%q: error without line: %v", line, err)
+		}
+	}
+}
+
+func TestParseSnmpwalk(t *testing.T) {
+	records, err := ParseSnmpwalk(strings.NewReader(`.1.3.6.1.2.1.1.1.0 = STRING: "Linux router
+second line"
+.1.3.6.1.2.1.1.2.0 = OID: .1.3.6.1.4.1.8072.3.2.10
+.1.3.6.1.2.1.1.3.0 = Timeticks: (12345) 0:02:03.45
+.1.3.6.1.2.1.1.4.0 = ""
+.1.3.6.1.2.1.2.2.1.6.1 = Hex-STRING: 00 A0 C9 FF FE 01
+.1.3.6.1.2.1.2.2.1.7.1 = INTEGER: up(1)
+.1.3.6.1.2.1.2.2.1.5.1 = Gauge32: 1000000000
+.1.3.6.1.2.1.2.2.1.8.1 = Wrong Type (should be INTEGER): Gauge32: 2
+.1.3.6.1.2.1.2.2.1.9.1 = No Such Instance currently exists at this OID
+.1.3.6.1.2.1.4.20.1.1.10.0.0.1 = IpAddress: 10.0.0.1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Record{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Linux router\nsecond line")},
+		{OID: "1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"},
+		{OID: "1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(12345)},
+		{OID: "1.3.6.1.2.1.1.4.0", Type: gosnmp.OctetString, Value: []byte{}},
+		{OID: "1.3.6.1.2.1.2.2.1.6.1", Type: gosnmp.OctetString, Value: []byte{0x00, 0xa0, 0xc9, 0xff, 0xfe, 0x01}},
+		{OID: "1.3.6.1.2.1.2.2.1.7.1", Type: gosnmp.Integer, Value: 1},
+		{OID: "1.3.6.1.2.1.2.2.1.5.1", Type: gosnmp.Gauge32, Value: uint32(1000000000)},
+		{OID: "1.3.6.1.2.1.2.2.1.8.1", Type: gosnmp.Gauge32, Value: uint32(2)},
+		{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: gosnmp.IPAddress, Value: []byte{10, 0, 0, 1}},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("records\n%+v\nexpected\n%+v", records, expected)
+	}
+}
+
+func TestParseSnmpwalkSymbolic(t *testing.T) {
+	_, err := ParseSnmpwalk(strings.NewReader("SNMPv2-MIB::sysDescr.0 = STRING: router"))
+	if err == nil || !strings.Contains(err.Error(), "snmpwalk -On") {
+		t.Errorf("symbolic OID: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Package simulator impersonates devices from recordings: snmpsim .snmprec files and snmpwalk -On output.
+//
+//	subAgents, err := simulator.LoadDir("recordings", simulator.Options{Writable: true})
+//	master := GoSNMPServer.MasterAgent{SubAgents: subAgents, ...}
+//
+// Each file is served as the community (SNMPv1/v2c) or context (SNMPv3) named after it:
+// recordings/switch/core.snmprec answers to community switch/core.
+package simulator
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/eriksejr/GoSNMPServer"
+)
+
+// Extensions of the recordings loaded
+const (
+	ExtSnmprec  = ".snmprec"
+	ExtSnmpwalk = ".snmpwalk"
+	ExtWalk     = ".walk"
+)
+
+// Options apply variations to every record, on top of the variation modules of snmprec records.
+type Options struct {
+	// Writable makes every cell writable, values set being kept in memory
+	Writable bool
+	// CounterRate increases every Counter32 / Counter64 by this average per second. 0 for static counters
+	CounterRate float64
+	// CounterDeviation adds a random increment of up to this on each read of a counter
+	CounterDeviation float64
+
+	// Seed seeds the random variations. 0 for a random seed
+	Seed int64
+	// Now returns the current time. if sets to nil, time.Now is used
+	Now func() time.Time
+}
+
+// Items returns the items serving records
+func Items(records []Record, opts Options) ([]*GoSNMPServer.PDUValueControlItem, error) {
+	sim := &simulation{now: opts.Now}
+	if sim.now == nil {
+		sim.now = time.Now
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	sim.rand = rand.New(rand.NewSource(seed))
+	start := sim.now()
+
+	items := make([]*GoSNMPServer.PDUValueControlItem, 0, len(records))
+	for _, record := range records {
+		c := &cell{sim: sim, typ: record.Type, value: record.Value, writable: opts.Writable}
+		switch record.Variation {
+		case "":
+			if isCounter(record.Type) && (opts.CounterRate > 0 || opts.CounterDeviation > 0) {
+				c.numeric = &numeric{initial: toFloat(record.Value), base: toUint(record.Value),
+					rate: opts.CounterRate, deviation: opts.CounterDeviation, start: start}
+			}
+		case VariationNumeric:
+			n, err := newNumeric(record.Type, record.Value, record.Params, start)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "oid %v", record.OID)
+			}
+			c.numeric = n
+		case VariationWriteCache:
+			c.writable = true
+		default:
+			return nil, errors.Errorf("oid %v: unsupported variation module %q", record.OID, record.Variation)
+		}
+		items = append(items, c.item(record.OID))
+	}
+	return items, nil
+}
+
+// item returns the item serving c
+func (c *cell) item(oid string) *GoSNMPServer.PDUValueControlItem {
+	item := &GoSNMPServer.PDUValueControlItem{
+		OID:      oid,
+		Type:     c.typ,
+		OnGet:    func() (interface{}, error) { return c.read(), nil },
+		Document: "simulated",
+	}
+	if c.writable {
+		item.OnSet = c.write
+	}
+	return item
+}
+
+// LoadFile reads a recording: .snmprec files as snmprec, others as snmpwalk -On output
+func LoadFile(path string, opts Options) ([]*GoSNMPServer.PDUValueControlItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []Record
+	if filepath.Ext(path) == ExtSnmprec {
+		records, err = ParseSnmprec(file)
+	} else {
+		records, err = ParseSnmpwalk(file)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, path)
+	}
+	items, err := Items(records, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, path)
+	}
+	return items, nil
+}
+
+// LoadDir returns a SubAgent for each recording (.snmprec, .snmpwalk, .walk) under dir.
+//
+//	The community / context of a SubAgent is the path of its file relative to dir, without extension.
+func LoadDir(dir string, opts Options) ([]*GoSNMPServer.SubAgent, error) {
+	var subAgents []*GoSNMPServer.SubAgent
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if ext != ExtSnmprec && ext != ExtSnmpwalk && ext != ExtWalk {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		items, err := LoadFile(path, opts)
+		if err != nil {
+			return err
+		}
+		subAgents = append(subAgents, &GoSNMPServer.SubAgent{
+			CommunityIDs: []string{filepath.ToSlash(strings.TrimSuffix(rel, ext))},
+			OIDs:         items,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(subAgents) == 0 {
+		return nil, errors.Errorf("no recording in %v", dir)
+	}
+	return subAgents, nil
+}
@@ -0,0 +1,204 @@
+package simulator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+
+	"github.com/eriksejr/GoSNMPServer"
+	"github.com/eriksejr/GoSNMPServer/snmptest"
+)
+
+// testClock is the time of Options.Now, advanced by the test
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func mustItems(t *testing.T, snmprec string, opts Options) map[string]*GoSNMPServer.PDUValueControlItem {
+	t.Helper()
+	records, err := ParseSnmprec(strings.NewReader(snmprec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := Items(records, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := make(map[string]*GoSNMPServer.PDUValueControlItem, len(items))
+	for _, item := range items {
+		ret[item.OID] = item
+	}
+	return ret
+}
+
+func read(t *testing.T, item *GoSNMPServer.PDUValueControlItem) interface{} {
+	t.Helper()
+	value, err := item.OnGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestNumericVariation(t *testing.T) {
+	clock := &testClock{time.Unix(1000, 0)}
+	items := mustItems(t, `1.1|65:numeric|initial=4294967290,rate=2
+1.2|2:numeric|initial=-5,rate=-1
+1.3|66:numeric|initial=50,deviation=10,min=45,max=55
+1.4|70|18446744073709551000
+1.5|65:numeric|initial=10,deviation=5
+1.6|4|static`, Options{CounterRate: 100, Seed: 1, Now: clock.Now})
+
+	clock.now = clock.now.Add(5 * time.Second)
+	// Counter32 wraps
+	if value := read(t, items["1.1"]); value != uint32(4) {
+		t.Errorf("Counter32 %v, expected 4", value)
+	}
+	if value := read(t, items["1.2"]); value != -10 {
+		t.Errorf("INTEGER %v, expected -10", value)
+	}
+	// Options.CounterRate applies to static counters
+	if value := read(t, items["1.4"]); value != uint64(18446744073709551500) {
+		t.Errorf("Counter64 %v", value)
+	}
+	if value := read(t, items["1.6"]); string(value.([]byte)) != "static" {
+		t.Errorf("OCTET STRING %v", value)
+	}
+	var last uint32
+	for id := 0; id < 100; id++ {
+		if gauge := read(t, items["1.3"]).(uint32); gauge < 45 || gauge > 55 {
+			t.Fatalf("Gauge32 %d beyond min / max", gauge)
+		}
+		counter := read(t, items["1.5"]).(uint32)
+		if counter < last {
+			t.Fatalf("counter decreased from %d to %d", last, counter)
+		}
+		last = counter
+	}
+	if last <= 10 {
+		t.Errorf("deviation never incremented the counter: %d", last)
+	}
+}
+
+func TestNumericVariationErrors(t *testing.T) {
+	for _, snmprec := range []string{
+		"1.1|4:numeric|initial=1",
+		"1.1|2:numeric|initial=1,rate=fast",
+		"1.1|2:unknown|value=1",
+	} {
+		records, err := ParseSnmprec(strings.NewReader(snmprec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Items(records, Options{}); err == nil || !strings.Contains(err.Error(), "1.1") {
+			t.Errorf("%q: %v", snmprec, err)
+		}
+	}
+}
+
+func TestWritable(t *testing.T) {
+	clock := &testClock{time.Unix(1000, 0)}
+	snmprec := "1.1|4|static\n1.2|4:writecache|value=cached\n1.3|65:numeric|initial=0,rate=1"
+	items := mustItems(t, snmprec, Options{Now: clock.Now})
+	if items["1.1"].OnSet != nil || items["1.3"].OnSet != nil || items["1.2"].OnSet == nil {
+		t.Fatal("only writecache cells writable")
+	}
+	if err := items["1.2"].OnSet([]byte("set")); err != nil || string(read(t, items["1.2"]).([]byte)) != "set" {
+		t.Errorf("writecache not set: %v", err)
+	}
+	if err := items["1.2"].OnSet(5); err == nil {
+		t.Error("INTEGER set to OCTET STRING")
+	}
+
+	items = mustItems(t, snmprec, Options{Writable: true, Now: clock.Now})
+	if items["1.1"].OnSet == nil {
+		t.Fatal("Options.Writable ignored")
+	}
+	clock.now = clock.now.Add(10 * time.Second)
+	if err := items["1.3"].OnSet(uint(100)); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(5 * time.Second)
+	if value := read(t, items["1.3"]); value != uint32(105) {
+		t.Errorf("counter %v, expected to go on from the value set", value)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "switch", "core.snmprec"),
+		"1.3.6.1.2.1.1.1.0|4|core switch\n1.3.6.1.2.1.1.5.0|4:writecache|value=core\n1.3.6.1.2.1.2.2.1.10.1|65|7\n")
+	writeFile(t, filepath.Join(dir, "host.walk"), `.1.3.6.1.2.1.1.1.0 = STRING: "host"
+.1.3.6.1.2.1.1.3.0 = Timeticks: (100) 0:00:01.00
+`)
+	writeFile(t, filepath.Join(dir, "README"), "not a recording")
+	subAgents, err := LoadDir(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := snmptest.NewAgent(t, GoSNMPServer.MasterAgent{AllowedVersion: GoSNMPServer.SNMPV2c, SubAgents: subAgents})
+
+	walks := map[string][]string{
+		"switch/core": {".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.2.2.1.10.1"},
+		"host":        {".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.3.0"},
+	}
+	for community, expected := range walks {
+		pdus, err := agent.Client(gosnmp.Version2c, community).BulkWalk("")
+		if err != nil {
+			t.Fatalf("%s: %v", community, err)
+		}
+		var names []string
+		for _, pdu := range pdus {
+			names = append(names, pdu.Name)
+		}
+		if strings.Join(names, " ") != strings.Join(expected, " ") {
+			t.Errorf("%s walked %v", community, names)
+		}
+	}
+
+	core := agent.Client(gosnmp.Version2c, "switch/core")
+	response, err := core.Set(
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: "renamed"})
+	if err != nil || response.Error != gosnmp.NoError {
+		t.Fatalf("set writecache: %v %v", response, err)
+	}
+	response, err = core.Set(
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint32(5)})
+	if err != nil || response.Error == gosnmp.NoError {
+		t.Errorf("static cell set: %v %v", response, err)
+	}
+	response, err = core.Get(".1.3.6.1.2.1.1.5.0")
+	if err != nil || string(response.Variables[0].Value.([]byte)) != "renamed" {
+		t.Errorf("writecache not kept: %v %v", response, err)
+	}
+	// kept apart from the other recordings
+	response, err = agent.Client(gosnmp.Version2c, "host").Get(".1.3.6.1.2.1.1.5.0")
+	if err != nil || response.Variables[0].Type == gosnmp.OctetString {
+		t.Errorf("value set in another recording: %v %v", response, err)
+	}
+}
+
+func TestLoadDirErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadDir(dir, Options{}); err == nil {
+		t.Error("empty directory loaded")
+	}
+	writeFile(t, filepath.Join(dir, "bad.snmprec"), "1.3.6.1.2.1.1.1.0|2|text\n")
+	if _, err := LoadDir(dir, Options{}); err == nil || !strings.Contains(err.Error(), "bad.snmprec") {
+		t.Errorf("bad recording: %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+
+	"github.com/eriksejr/GoSNMPServer"
+)
+
+// ExtJSON is the extension of JSON snapshots
+const ExtJSON = ".json"
+
+// Snapshot walks subAgent in-process, returning its variables in OID order.
+func Snapshot(subAgent *GoSNMPServer.SubAgent) ([]Record, error) {
+	var records []Record
+	err := subAgent.Walk("", func(pdu gosnmp.SnmpPDU) error {
+		record, err := recordOf(pdu)
+		records = append(records, record)
+		return err
+	})
+	return records, err
+}
+
+// SnapshotMaster walks master in-process as a SNMPv2c manager using community, returning the
+// variables in OID order. master shell be ReadyForWork.
+func SnapshotMaster(master *GoSNMPServer.MasterAgent, community string) ([]Record, error) {
+	var records []Record
+	err := master.Walk(community, "", func(pdu gosnmp.SnmpPDU) error {
+		record, err := recordOf(pdu)
+		records = append(records, record)
+		return err
+	})
+	return records, err
+}
+
+// recordOf converts a varbind as decoded / served to a record
+func recordOf(pdu gosnmp.SnmpPDU) (Record, error) {
+	oid, err := GoSNMPServer.ParseOID(pdu.Name)
+	if err != nil {
+		return Record{}, err
+	}
+	return recordable(Record{OID: oid.String(), Type: pdu.Type, Value: pdu.Value})
+}
+
+// recordable returns record as written to snapshots: of a snmprec type, its value normalized.
+//
+//	OpaqueFloat / OpaqueDouble become Opaque, encoded as in draft-perkins-opaque-01.
+func recordable(record Record) (Record, error) {
+	switch record.Type {
+	case gosnmp.OpaqueFloat:
+		value, ok := record.Value.(float32)
+		if !ok {
+			return Record{}, errors.Errorf("oid %v: %T for %v", record.OID, record.Value, record.Type)
+		}
+		data := []byte{0x9f, 0x78, 4, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(data[3:], math.Float32bits(value))
+		record.Type, record.Value = gosnmp.Opaque, data
+		return record, nil
+	case gosnmp.OpaqueDouble:
+		value, ok := record.Value.(float64)
+		if !ok {
+			return Record{}, errors.Errorf("oid %v: %T for %v", record.OID, record.Value, record.Type)
+		}
+		data := []byte{0x9f, 0x79, 8, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(data[3:], math.Float64bits(value))
+		record.Type, record.Value = gosnmp.Opaque, data
+		return record, nil
+	}
+	if _, found := snmprecTag(record.Type); !found {
+		return Record{}, errors.Errorf("oid %v: type %v could not be recorded", record.OID, record.Type)
+	}
+	if text, ok := record.Value.(string); ok && record.Type == gosnmp.ObjectIdentifier {
+		record.Value = "." + trimDot(text)
+	}
+	value, err := normalize(record.Type, record.Value)
+	if err != nil {
+		return Record{}, errors.WithMessagef(err, "oid %v", record.OID)
+	}
+	record.Value = value
+	return record, nil
+}
+
+func trimDot(oid string) string {
+	if len(oid) != 0 && oid[0] == '.' {
+		return oid[1:]
+	}
+	return oid
+}
+
+// snmprecTag returns the snmprec tag of typ
+func snmprecTag(typ gosnmp.Asn1BER) (int, bool) {
+	for tag, each := range snmprecTypes {
+		if each == typ {
+			return tag, true
+		}
+	}
+	return 0, false
+}
+
+// formatValue returns the text of the value of record, and whether it is hex encoded
+func formatValue(record Record) (string, bool, error) {
+	switch value := record.Value.(type) {
+	case nil:
+		return "", false, nil
+	case int:
+		return strconv.Itoa(value), false, nil
+	case uint32:
+		return strconv.FormatUint(uint64(value), 10), false, nil
+	case uint64:
+		return strconv.FormatUint(value, 10), false, nil
+	case string:
+		// ObjectIdentifier
+		return trimDot(value), false, nil
+	case []byte:
+		if record.Type == gosnmp.IPAddress && len(value) == net.IPv4len {
+			return net.IP(value).String(), false, nil
+		}
+		if record.Type == gosnmp.OctetString && printable(value) {
+			return string(value), false, nil
+		}
+		return hex.EncodeToString(value), true, nil
+	}
+	return "", false, errors.Errorf("oid %v: value %T could not be recorded", record.OID, record.Value)
+}
+
+// printable reports if data could be written as text in snmprec: UTF-8 without control characters
+func printable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if r < 0x20 || r == 0x7f || r == '|' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRecords returns records recordable, in OID order
+func sortRecords(records []Record) ([]Record, error) {
+	sorted := make([]Record, len(records))
+	oids := make(map[string]GoSNMPServer.OID, len(records))
+	for id, record := range records {
+		oid, err := GoSNMPServer.ParseOID(record.OID)
+		if err != nil {
+			return nil, err
+		}
+		record.OID = oid.String()
+		if sorted[id], err = recordable(record); err != nil {
+			return nil, err
+		}
+		oids[record.OID] = oid
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return oids[sorted[i].OID].Compare(oids[sorted[j].OID]) < 0
+	})
+	return sorted, nil
+}
+
+// WriteSnmprec writes records as a .snmprec file, in OID order.
+func WriteSnmprec(w io.Writer, records []Record) error {
+	sorted, err := sortRecords(records)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	for _, record := range sorted {
+		tag, _ := snmprecTag(record.Type)
+		text, isHex, err := formatValue(record)
+		if err != nil {
+			return err
+		}
+		suffix := ""
+		if isHex {
+			suffix = "x"
+		}
+		fmt.Fprintf(&b, "%s|%d%s|%s\n", record.OID, tag, suffix, text)
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// jsonRecord is a record of a JSON snapshot
+type jsonRecord struct {
+	OID   string `json:"oid"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Hex   bool   `json:"hex,omitempty"`
+}
+
+// WriteJSON writes records as an indented JSON array, in OID order.
+func WriteJSON(w io.Writer, records []Record) error {
+	sorted, err := sortRecords(records)
+	if err != nil {
+		return err
+	}
+	out := make([]jsonRecord, 0, len(sorted))
+	for _, record := range sorted {
+		text, isHex, err := formatValue(record)
+		if err != nil {
+			return err
+		}
+		out = append(out, jsonRecord{OID: record.OID, Type: record.Type.String(), Value: text, Hex: isHex})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// ParseJSON reads a snapshot written by WriteJSON
+func ParseJSON(r io.Reader) ([]Record, error) {
+	var in []jsonRecord
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(in))
+	for _, each := range in {
+		var typ gosnmp.Asn1BER
+		for _, known := range snmprecTypes {
+			if known.String() == each.Type {
+				typ = known
+			}
+		}
+		if typ == 0 {
+			return nil, errors.Errorf("oid %v: unsupported type %q", each.OID, each.Type)
+		}
+		record := Record{OID: each.OID, Type: typ}
+		var err error
+		if each.Hex {
+			var data []byte
+			if data, err = hex.DecodeString(each.Value); err == nil {
+				record.Value, err = hexValue(typ, data)
+			}
+		} else {
+			record.Value, err = parseValue(typ, each.Value)
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "oid %v", each.OID)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// ReadFile reads the records of a snapshot or recording: .json, .snmprec, or snmpwalk -On output
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []Record
+	switch filepath.Ext(path) {
+	case ExtJSON:
+		records, err = ParseJSON(file)
+	case ExtSnmprec:
+		records, err = ParseSnmprec(file)
+	default:
+		records, err = ParseSnmpwalk(file)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, path)
+	}
+	return records, nil
+}
+
+// Change kinds of Diff
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change is a difference between two snapshots
+type Change struct {
+	Kind string
+	OID  string
+	// Old is nil for ChangeAdded, New for ChangeRemoved
+	Old, New *Record
+}
+
+func (c Change) String() string {
+	describe := func(record *Record) string {
+		text, isHex, _ := formatValue(*record)
+		if isHex {
+			text = "0x" + text
+		}
+		return fmt.Sprintf("%v: %q", record.Type, text)
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %v = %v", c.OID, describe(c.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %v = %v", c.OID, describe(c.Old))
+	}
+	return fmt.Sprintf("~ %v = %v -> %v", c.OID, describe(c.Old), describe(c.New))
+}
+
+// Diff returns the OIDs added, removed and changed (type or value) from old to new, in OID order.
+func Diff(old, new []Record) ([]Change, error) {
+	old, err := sortRecords(old)
+	if err != nil {
+		return nil, err
+	}
+	if new, err = sortRecords(new); err != nil {
+		return nil, err
+	}
+	var changes []Change
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		var order int
+		switch {
+		case i == len(old):
+			order = 1
+		case j == len(new):
+			order = -1
+		default:
+			oldOID, _ := GoSNMPServer.ParseOID(old[i].OID)
+			newOID, _ := GoSNMPServer.ParseOID(new[j].OID)
+			order = oldOID.Compare(newOID)
+		}
+		switch {
+		case order < 0:
+			changes = append(changes, Change{Kind: ChangeRemoved, OID: old[i].OID, Old: &old[i]})
+			i++
+		case order > 0:
+			changes = append(changes, Change{Kind: ChangeAdded, OID: new[j].OID, New: &new[j]})
+			j++
+		default:
+			if !sameRecord(old[i], new[j]) {
+				changes = append(changes, Change{Kind: ChangeChanged, OID: new[j].OID, Old: &old[i], New: &new[j]})
+			}
+			i++
+			j++
+		}
+	}
+	return changes, nil
+}
+
+func sameRecord(a, b Record) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	textA, hexA, errA := formatValue(a)
+	textB, hexB, errB := formatValue(b)
+	return errA == nil && errB == nil && textA == textB && hexA == hexB
+}
@@ -0,0 +1,186 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+
+	"github.com/eriksejr/GoSNMPServer"
+)
+
+func snapshotTestMaster(t *testing.T) *GoSNMPServer.MasterAgent {
+	t.Helper()
+	values := []struct {
+		oid   string
+		typ   gosnmp.Asn1BER
+		value interface{}
+	}{
+		{"1.3.6.1.2.1.1.1.0", gosnmp.OctetString, "desc|x"},
+		{"1.3.6.1.2.1.1.2.0", gosnmp.ObjectIdentifier, "1.3.6.1.4.1.1"},
+		{"1.3.6.1.2.1.1.3.0", gosnmp.TimeTicks, uint32(5)},
+		{"1.3.6.1.2.1.2.1.0", gosnmp.Integer, 2},
+		{"1.3.6.1.2.1.2.2.1.10.1", gosnmp.Counter32, uint(7)},
+		{"1.3.6.1.2.1.4.1.0", gosnmp.IPAddress, net.ParseIP("10.1.2.3")},
+		{"1.3.6.1.4.1.1.1", gosnmp.OpaqueFloat, float32(1.5)},
+		{"1.3.6.1.4.1.1.2", gosnmp.Counter64, uint64(1 << 40)},
+		{"1.3.6.1.4.1.1.10", gosnmp.OctetString, []byte{0, 1, 255}},
+	}
+	var items []*GoSNMPServer.PDUValueControlItem
+	for _, each := range values {
+		value := each.value
+		items = append(items, &GoSNMPServer.PDUValueControlItem{
+			OID:   each.oid,
+			Type:  each.typ,
+			OnGet: func() (interface{}, error) { return value, nil },
+		})
+	}
+	master := &GoSNMPServer.MasterAgent{SubAgents: []*GoSNMPServer.SubAgent{{OIDs: items}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+const snapshotTestSnmprec = `1.3.6.1.2.1.1.1.0|4x|646573637c78
+1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.1
+1.3.6.1.2.1.1.3.0|67|5
+1.3.6.1.2.1.2.1.0|2|2
+1.3.6.1.2.1.2.2.1.10.1|65|7
+1.3.6.1.2.1.4.1.0|64|10.1.2.3
+1.3.6.1.4.1.1.1|68x|9f78043fc00000
+1.3.6.1.4.1.1.2|70|1099511627776
+1.3.6.1.4.1.1.10|4x|0001ff
+`
+
+func TestSnapshot(t *testing.T) {
+	master := snapshotTestMaster(t)
+	records, err := Snapshot(master.SubAgents[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snmprec bytes.Buffer
+	if err := WriteSnmprec(&snmprec, records); err != nil {
+		t.Fatal(err)
+	}
+	if snmprec.String() != snapshotTestSnmprec {
+		t.Errorf("snmprec\n%s", snmprec.String())
+	}
+
+	viaMaster, err := SnapshotMaster(master, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := Diff(records, viaMaster); err != nil || len(changes) != 0 {
+		t.Errorf("SnapshotMaster differs: %v %v", changes, err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	records, err := Snapshot(snapshotTestMaster(t).SubAgents[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snmprec, json bytes.Buffer
+	if err := WriteSnmprec(&snmprec, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteJSON(&json, records); err != nil {
+		t.Fatal(err)
+	}
+	fromSnmprec, err := ParseSnmprec(&snmprec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ParseJSON(&json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, parsed := range map[string][]Record{"snmprec": fromSnmprec, "json": fromJSON} {
+		if changes, err := Diff(records, parsed); err != nil || len(changes) != 0 {
+			t.Errorf("%s round trip: %v %v", name, changes, err)
+		}
+	}
+
+	// served back, a snapshot is the same
+	items, err := Items(fromSnmprec, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := &GoSNMPServer.MasterAgent{SubAgents: []*GoSNMPServer.SubAgent{{OIDs: items}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	served, err := Snapshot(master.SubAgents[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := Diff(records, served); err != nil || len(changes) != 0 {
+		t.Errorf("served snapshot differs: %v %v", changes, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, err := ParseSnmprec(bytes.NewBufferString(snapshotTestSnmprec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new := append([]Record(nil), old...)
+	new[0] = Record{OID: new[0].OID, Type: gosnmp.OctetString, Value: []byte("other")}
+	new = append(new[:3], new[4:]...)
+	// unordered
+	new = append([]Record{{OID: "1.3.6.1.9", Type: gosnmp.Null}}, new...)
+	changes, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`~ 1.3.6.1.2.1.1.1.0 = OctetString: "0x646573637c78" -> OctetString: "other"`,
+		`- 1.3.6.1.2.1.2.1.0 = Integer: "2"`,
+		`+ 1.3.6.1.9 = Null: ""`,
+	}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("changes\n%v\nexpected\n%v", changes, expected)
+	}
+	if _, err := Diff(old, []Record{{OID: "1.3", Type: gosnmp.EndOfMibView}}); err == nil {
+		t.Error("EndOfMibView diffed")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	records, err := ParseSnmprec(bytes.NewBufferString(snapshotTestSnmprec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var json bytes.Buffer
+	if err := WriteJSON(&json, records); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"golden.snmprec": snapshotTestSnmprec,
+		"golden.json":    json.String(),
+		"golden.walk":    ".1.3.6.1.2.1.1.3.0 = Timeticks: (5) 0:00:00.05\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, expected := range map[string][]Record{"golden.snmprec": records, "golden.json": records, "golden.walk": records[2:3]} {
+		read, err := ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changes, err := Diff(expected, read); err != nil || len(changes) != 0 {
+			t.Errorf("%s: %v %v", name, changes, err)
+		}
+	}
+	if _, err := ReadFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file read")
+	}
+}
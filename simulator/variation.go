@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// Variation modules of snmprec records
+const (
+	// VariationNumeric changes a number with time: initial, rate (per second), deviation (random),
+	// min, max. Counters only increase, the deviation adding a random increment on each read.
+	VariationNumeric = "numeric"
+	// VariationWriteCache makes the cell writable, starting from value. Values set are kept in memory.
+	VariationWriteCache = "writecache"
+)
+
+// cell is the simulated value of one record
+type cell struct {
+	sim      *simulation
+	mu       sync.Mutex
+	typ      gosnmp.Asn1BER
+	value    interface{}
+	numeric  *numeric
+	writable bool
+}
+
+// numeric is a number changing with time
+type numeric struct {
+	initial    float64
+	base       uint64 // initial of counters, which wrap
+	rate       float64
+	deviation  float64
+	min, max   float64
+	start      time.Time
+	increments float64 // random increments of counters
+}
+
+// simulation is the state shared by the cells of one Items call
+type simulation struct {
+	now  func() time.Time
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (s *simulation) random() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64()
+}
+
+func isCounter(typ gosnmp.Asn1BER) bool {
+	return typ == gosnmp.Counter32 || typ == gosnmp.Counter64
+}
+
+func isNumber(typ gosnmp.Asn1BER) bool {
+	switch typ {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32, gosnmp.Counter64:
+		return true
+	}
+	return false
+}
+
+// newNumeric makes the numeric variation of params, starting from initial
+func newNumeric(typ gosnmp.Asn1BER, initial interface{}, params map[string]string, now time.Time) (*numeric, error) {
+	if !isNumber(typ) {
+		return nil, errors.Errorf("%v variation of %v", VariationNumeric, typ)
+	}
+	n := &numeric{initial: toFloat(initial), base: toUint(initial), start: now, min: minOf(typ), max: maxOf(typ)}
+	for key, target := range map[string]*float64{"rate": &n.rate, "deviation": &n.deviation, "min": &n.min, "max": &n.max} {
+		text, found := params[key]
+		if !found {
+			continue
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, errors.Errorf("bad %v %q", key, text)
+		}
+		*target = value
+	}
+	return n, nil
+}
+
+// read returns the value of the cell now
+func (c *cell) read() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.numeric == nil {
+		return c.value
+	}
+	n := c.numeric
+	elapsed := c.sim.now().Sub(n.start).Seconds()
+	if isCounter(c.typ) {
+		if n.deviation > 0 {
+			n.increments += c.sim.random() * n.deviation
+		}
+		total := n.base + uint64(math.Max(0, n.rate*elapsed+n.increments))
+		if c.typ == gosnmp.Counter32 {
+			return uint32(total)
+		}
+		return total
+	}
+	value := n.initial + n.rate*elapsed
+	if n.deviation > 0 {
+		value += (c.sim.random()*2 - 1) * n.deviation
+	}
+	return fromFloat(c.typ, math.Max(n.min, math.Min(n.max, value)))
+}
+
+// write sets the value of the cell, a numeric cell going on from value
+func (c *cell) write(value interface{}) error {
+	value, err := normalize(c.typ, value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.numeric != nil {
+		c.numeric.initial = toFloat(value)
+		c.numeric.base = toUint(value)
+		c.numeric.start = c.sim.now()
+		c.numeric.increments = 0
+		return nil
+	}
+	c.value = value
+	return nil
+}
+
+// normalize checks value set is of typ, converting it as served
+func normalize(typ gosnmp.Asn1BER, value interface{}) (interface{}, error) {
+	switch typ {
+	case gosnmp.Integer:
+		if v, ok := value.(int); ok {
+			return v, nil
+		}
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		switch v := value.(type) {
+		case uint:
+			return uint32(v), nil
+		case uint32:
+			return v, nil
+		}
+	case gosnmp.Counter64:
+		if v, ok := value.(uint64); ok {
+			return v, nil
+		}
+	case gosnmp.OctetString, gosnmp.Opaque:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	case gosnmp.ObjectIdentifier:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case gosnmp.IPAddress:
+		switch v := value.(type) {
+		case string:
+			return parseValue(typ, v)
+		case net.IP:
+			if ip := v.To4(); ip != nil {
+				return []byte(ip), nil
+			}
+		case []byte:
+			return hexValue(typ, v)
+		}
+	case gosnmp.OpaqueFloat:
+		if v, ok := value.(float32); ok {
+			return v, nil
+		}
+	case gosnmp.OpaqueDouble:
+		if v, ok := value.(float64); ok {
+			return v, nil
+		}
+	case gosnmp.Null:
+		return nil, nil
+	}
+	return nil, errors.Errorf("wrongType: %T for %v", value, typ)
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return 0
+}
+
+func toUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	}
+	return 0
+}
+
+// fromFloat converts value, within the range of typ, to typ
+func fromFloat(typ gosnmp.Asn1BER, value float64) interface{} {
+	if typ == gosnmp.Integer {
+		return int(value)
+	}
+	return uint32(value)
+}
+
+func minOf(typ gosnmp.Asn1BER) float64 {
+	if typ == gosnmp.Integer {
+		return math.MinInt32
+	}
+	return 0
+}
+
+func maxOf(typ gosnmp.Asn1BER) float64 {
+	switch typ {
+	case gosnmp.Integer:
+		return math.MaxInt32
+	case gosnmp.Counter64:
+		return math.MaxUint64
+	}
+	return math.MaxUint32
+}
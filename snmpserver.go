@@ -1,17 +1,57 @@
 package GoSNMPServer
 
 import (
+	"crypto/tls"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net"
+	"os"
 	"reflect"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 )
 
 type SNMPServer struct {
-	wconnStream ISnmpServerListener
-	master      MasterAgent
-	logger      *log.Logger
+	mu        sync.Mutex
+	listeners []*serverListener
+	master    MasterAgent
+	logger    *slog.Logger
+	serving   *serveGroup // nil unless ServeForever is running
+}
+
+// serveGroup is the listeners served by one ServeForever, guarded by SNMPServer.mu
+type serveGroup struct {
+	running int
+	err     error
+	done    chan struct{}
+}
+
+// serverListener is a listener of a SNMPServer, with its counters
+type serverListener struct {
+	listener ISnmpServerListener
+	logger   *slog.Logger
+
+	received    atomic.Uint64
+	sent        atomic.Uint64
+	unanswered  atomic.Uint64
+	replyErrors atomic.Uint64
+}
+
+// ListenerStats counts the messages of one listener of a SNMPServer
+type ListenerStats struct {
+	Address net.Addr
+	// Received counts the messages received
+	Received uint64
+	// Sent counts the responses sent
+	Sent uint64
+	// Unanswered counts the messages without response: traps, requests dropped or not decoded
+	Unanswered uint64
+	// ReplyErrors counts the responses which could not be sent
+	ReplyErrors uint64
 }
 
 func NewSNMPServer(master MasterAgent) *SNMPServer {
@@ -20,58 +60,229 @@ func NewSNMPServer(master MasterAgent) *SNMPServer {
 		panic(err)
 	}
 	ret.master = master
-	ret.logger = master.Logger
+	ret.logger = master.priv.logger
 	return ret
 }
 
+// ListenUDP adds a UDP listener on address. Listeners are served together by ServeForever.
 func (server *SNMPServer) ListenUDP(l3proto, address string) error {
-	if server.wconnStream != nil {
-		return errors.New("Listened")
-	}
 	i, err := NewUDPListener(l3proto, address)
 	if err != nil {
 		return err
 	}
-	server.logger.Printf("ListenUDP: l3proto=%s, address=%s\n", l3proto, address)
-	i.SetupLogger(server.logger)
-	server.wconnStream = i
+	i.(*UDPListener).SetBufferSize(server.master.MaxMessageSize)
+	server.logger.Info("ListenUDP", "l3proto", l3proto, "address", address)
+	server.addListener(i)
 	return nil
 }
 
+// ListenUnix adds a Unix socket listener on path, network "unixgram" or "unix". See NewUnixListener.
+func (server *SNMPServer) ListenUnix(network, path string, perm os.FileMode) error {
+	i, err := NewUnixListener(network, path, perm)
+	if err != nil {
+		return err
+	}
+	i.(interface{ SetBufferSize(int) }).SetBufferSize(server.master.MaxMessageSize)
+	server.logger.Info("ListenUnix", "network", network, "path", path)
+	server.addListener(i)
+	return nil
+}
+
+// ListenTLS adds a TLS listener on address, for the SNMPV3 Transport Security Model. See NewTLSListener.
+func (server *SNMPServer) ListenTLS(network, address string, config *tls.Config) error {
+	i, err := NewTLSListener(network, address, config)
+	if err != nil {
+		return err
+	}
+	i.(*StreamListener).SetBufferSize(server.master.MaxMessageSize)
+	server.logger.Info("ListenTLS", "network", network, "address", i.Address().String())
+	server.addListener(i)
+	return nil
+}
+
+// ListenDTLS adds a DTLS listener on address, for the SNMPV3 Transport Security Model. See NewDTLSListener.
+func (server *SNMPServer) ListenDTLS(network, address string, config *tls.Config) error {
+	i, err := NewDTLSListener(network, address, config)
+	if err != nil {
+		return err
+	}
+	i.(*StreamListener).SetBufferSize(server.master.MaxMessageSize)
+	server.logger.Info("ListenDTLS", "network", network, "address", i.Address().String())
+	server.addListener(i)
+	return nil
+}
+
+// Listen adds listener, as a MemoryListener. Listeners are served together by ServeForever.
+func (server *SNMPServer) Listen(listener ISnmpServerListener) error {
+	if listener == nil {
+		return errors.New("nil listener")
+	}
+	server.logger.Info("Listen", "network", listener.Address().Network(), "address", listener.Address().String())
+	server.addListener(listener)
+	return nil
+}
+
+func (server *SNMPServer) addListener(listener ISnmpServerListener) {
+	if l, ok := listener.(IStructuredLoggerListener); ok {
+		l.SetupStructuredLogger(server.logger)
+	} else if server.master.Logger != nil {
+		listener.SetupLogger(server.master.Logger)
+	} else {
+		listener.SetupLogger(log.New(io.Discard, "", 0))
+	}
+	l := &serverListener{
+		listener: listener,
+		logger:   server.logger.With("listener", listener.Address().String()),
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.listeners = append(server.listeners, l)
+	if server.serving != nil {
+		server.serve(server.serving, l)
+	}
+}
+
+// getListeners returns a snapshot of the listeners
+func (server *SNMPServer) getListeners() []*serverListener {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]*serverListener(nil), server.listeners...)
+}
+
+// Address returns the address of the first listener, nil if none
 func (server *SNMPServer) Address() net.Addr {
-	return server.wconnStream.Address()
+	listeners := server.getListeners()
+	if len(listeners) == 0 {
+		return nil
+	}
+	return listeners[0].listener.Address()
+}
+
+// Addresses returns the addresses of the listeners, in the order they were added
+func (server *SNMPServer) Addresses() []net.Addr {
+	listeners := server.getListeners()
+	ret := make([]net.Addr, 0, len(listeners))
+	for _, l := range listeners {
+		ret = append(ret, l.listener.Address())
+	}
+	return ret
 }
 
+// ListenerStats returns the counters of each listener, in the order they were added
+func (server *SNMPServer) ListenerStats() []ListenerStats {
+	listeners := server.getListeners()
+	ret := make([]ListenerStats, 0, len(listeners))
+	for _, l := range listeners {
+		ret = append(ret, ListenerStats{
+			Address:     l.listener.Address(),
+			Received:    l.received.Load(),
+			Sent:        l.sent.Load(),
+			Unanswered:  l.unanswered.Load(),
+			ReplyErrors: l.replyErrors.Load(),
+		})
+	}
+	return ret
+}
+
+// Metrics returns the counters of the MasterAgent served. nil unless MasterAgent.Metrics is set
+func (server *SNMPServer) Metrics() *Metrics {
+	return server.master.Metrics
+}
+
+// Shutdown closes every listener, so ServeForever returns
 func (server *SNMPServer) Shutdown() {
 	if server.logger != nil {
-		server.logger.Println("Shutdown server")
+		server.logger.Info("Shutdown server")
 	}
-	if server.wconnStream != nil {
-		server.wconnStream.Shutdown()
+	for _, l := range server.getListeners() {
+		l.listener.Shutdown()
 	}
 }
 
+// ServeForever serves every listener concurrently, each one request after another, listeners
+// added meanwhile included. It returns once all listeners stopped, with the first error which
+// is not the listener being shut down.
 func (server *SNMPServer) ServeForever() error {
-	if server.wconnStream == nil {
+	server.mu.Lock()
+	if len(server.listeners) == 0 {
+		server.mu.Unlock()
 		return errors.New("Not Listen")
 	}
+	if server.serving != nil {
+		server.mu.Unlock()
+		return errors.New("Already serving")
+	}
+	group := &serveGroup{done: make(chan struct{})}
+	server.serving = group
+	for _, l := range server.listeners {
+		server.serve(group, l)
+	}
+	server.mu.Unlock()
 
+	<-group.done
+	return group.err
+}
+
+// serve serves l in group until it is shut down. server.mu shell be held
+func (server *SNMPServer) serve(group *serveGroup, l *serverListener) {
+	group.running++
+	go func() {
+		err := server.serveListener(l)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if err != nil && group.err == nil {
+			group.err = err
+		}
+		group.running--
+		if group.running == 0 {
+			server.serving = nil
+			close(group.done)
+		}
+	}()
+}
+
+// serveListener serves l until it is shut down
+func (server *SNMPServer) serveListener(l *serverListener) error {
 	for {
-		err := server.ServeNextRequest()
+		err := server.serveNext(l)
 		if err != nil {
 			var opError *net.OpError
 			if errors.As(err, &opError) {
-				server.logger.Printf("ServeForever: break because of serveNextRequest error %v\n", opError)
+				l.logger.Info("ServeForever: break because of serveNextRequest error", "err", opError)
 				return nil
 			}
 
-			server.logger.Printf("ServeForever: ServeNextRequest error %v [type %v]\n", err, reflect.TypeOf(err))
+			l.logger.Error("ServeForever: ServeNextRequest error", "err", err, "type", reflect.TypeOf(err).String())
 			return errors.Wrap(err, "ServeNextRequest")
 		}
 	}
 }
 
-func (server *SNMPServer) ServeNextRequest() (err error) {
+// ServeNextRequest serves the next request of the first listener
+func (server *SNMPServer) ServeNextRequest() error {
+	listeners := server.getListeners()
+	if len(listeners) == 0 {
+		return errors.New("Not Listen")
+	}
+	return server.serveNext(listeners[0])
+}
+
+// requestInfoOf tells what replyer knows of the manager
+func requestInfoOf(replyer IReplyer) *RequestInfo {
+	info := new(RequestInfo)
+	if r, ok := replyer.(ITLSReplyer); ok {
+		info.TLS = r.TLSConnectionState()
+	}
+	if r, ok := replyer.(IRemoteAddrReplyer); ok {
+		info.Peer = r.RemoteAddr()
+	}
+	if r, ok := replyer.(IPeerCredentialsReplyer); ok {
+		info.Credentials = r.PeerCredentials()
+	}
+	return info
+}
+
+func (server *SNMPServer) serveNext(l *serverListener) (err error) {
 	defer func() {
 		if err := recover(); err != nil {
 			switch err.(type) {
@@ -80,28 +291,33 @@ func (server *SNMPServer) ServeNextRequest() (err error) {
 			default:
 				err = errors.Errorf("ServeNextRequest fails with panic. err(type %v)=%v", reflect.TypeOf(err), err)
 			}
-			server.logger.Printf("ServeNextRequest error: %+v\n", err)
+			l.logger.Error("ServeNextRequest error", "err", fmt.Sprintf("%+v", err))
 			return
 		}
 	}()
-	bytePDU, replyer, err := server.wconnStream.NextSnmp()
+	bytePDU, replyer, err := l.listener.NextSnmp()
 	if err != nil {
 		return err
 	}
-	result, err := server.master.ResponseForBuffer(bytePDU)
+	l.received.Add(1)
+	result, err := server.master.ResponseForBufferFrom(bytePDU, requestInfoOf(replyer))
 	if err != nil {
 		v := "with"
 		if len(result) == 0 {
 			v = "without"
 		}
-		server.logger.Printf("ResponseForBuffer Error: %v. %s result\n", err, v)
+		l.logger.Debug("ResponseForBuffer Error", "err", err, "result", v)
 	}
-	if len(result) != 0 {
+	if len(result) == 0 {
+		l.unanswered.Add(1)
+	} else {
 		if errreply := replyer.ReplyPDU(result); errreply != nil {
-			server.logger.Printf("Reply PDU meet err: %s\n", errreply)
+			l.replyErrors.Add(1)
+			l.logger.Warn("Reply PDU meet err", "err", errreply)
 			replyer.Shutdown()
 			return nil
 		}
+		l.sent.Add(1)
 	}
 	if err != nil {
 		replyer.Shutdown()
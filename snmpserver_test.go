@@ -0,0 +1,124 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// serveUDP serves master on a loopback UDP port until the test ends
+func serveUDP(tb testing.TB, master MasterAgent) (*SNMPServer, uint16) {
+	tb.Helper()
+	server := NewSNMPServer(master)
+	if err := server.ListenUDP("udp", "127.0.0.1:0"); err != nil {
+		tb.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeForever()
+	}()
+	tb.Cleanup(func() {
+		server.Shutdown()
+		<-done
+	})
+	return server, uint16(server.Address().(*net.UDPAddr).Port)
+}
+
+// udpClient returns a gosnmp client of the agent on port, closed when the test ends
+func udpClient(tb testing.TB, port uint16, version gosnmp.SnmpVersion) *gosnmp.GoSNMP {
+	tb.Helper()
+	client := &gosnmp.GoSNMP{
+		Target:         "127.0.0.1",
+		Port:           port,
+		Version:        version,
+		Community:      "public",
+		Timeout:        time.Second,
+		MaxRepetitions: 4,
+	}
+	if version == gosnmp.Version3 {
+		client.SecurityModel = gosnmp.UserSecurityModel
+	}
+	tb.Cleanup(func() {
+		if client.Conn != nil {
+			client.Conn.Close()
+		}
+	})
+	return client
+}
+
+// stringOIDs returns read-write OctetString items, each valued "v" + its OID
+func stringOIDs(oids ...string) []*PDUValueControlItem {
+	var ret []*PDUValueControlItem
+	for _, oid := range oids {
+		value := "v" + oid
+		ret = append(ret, &PDUValueControlItem{
+			OID:   oid,
+			Type:  gosnmp.OctetString,
+			OnGet: func() (interface{}, error) { return value, nil },
+			OnSet: func(interface{}) error { return nil },
+		})
+	}
+	return ret
+}
+
+// exchangeGet sends a SNMPv2c Get of oid through conn, failing the test without response
+func exchangeGet(t *testing.T, conn *MemoryConn, oid string) {
+	t.Helper()
+	request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "public", PDUType: gosnmp.GetRequest,
+		RequestID: 1, Variables: []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Null}}}
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if response, err := conn.Exchange(ctx, raw); err != nil || response == nil {
+		t.Fatalf("%v: no response: %v", conn.LocalAddr(), err)
+	}
+}
+
+func TestListenWhileServing(t *testing.T) {
+	server := NewSNMPServer(MasterAgent{AllowedVersion: SNMPV2c, SubAgents: []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}}})
+	first := NewMemoryListener(t.Name() + "/first")
+	if err := server.Listen(first); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.ServeForever() }()
+	exchangeGet(t, first.Dial(), "1.3.6.1.2.1.1.1.0")
+	if err := server.ServeForever(); err == nil {
+		t.Error("served twice")
+	}
+
+	added := NewMemoryListener(t.Name() + "/added")
+	if err := server.Listen(added); err != nil {
+		t.Fatal(err)
+	}
+	exchangeGet(t, added.Dial(), "1.3.6.1.2.1.1.1.0")
+	if err := server.ListenUDP("udp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	client := communityClient(t, uint16(server.Addresses()[2].(*net.UDPAddr).Port), gosnmp.Version2c, "public")
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Errorf("UDP listener added while serving: %v", err)
+	}
+
+	server.Shutdown()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeForever still running once every listener is shut down")
+	}
+	for _, stats := range server.ListenerStats() {
+		if stats.Sent != 1 {
+			t.Errorf("%v sent %d", stats.Address, stats.Sent)
+		}
+	}
+}
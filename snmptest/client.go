@@ -0,0 +1,319 @@
+package snmptest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+
+	"github.com/eriksejr/GoSNMPServer"
+)
+
+// DefaultTimeout is the time a Client waits for a response, if Timeout sets to 0
+const DefaultTimeout = 5 * time.Second
+
+// DefaultMaxRepetitions is the max-repetitions of BulkWalk, if MaxRepetitions sets to 0
+const DefaultMaxRepetitions = 10
+
+// ErrNoResponse is returned when the agent replied nothing to a confirmed request, as when it is dropped
+var ErrNoResponse = errors.New("snmptest: no response")
+
+// StatusError is the error-status of a response, Index being the 1-based varbind in error
+type StatusError struct {
+	Status gosnmp.SNMPError
+	Index  uint8
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("snmptest: error-status %v at index %d", e.Status, e.Index)
+}
+
+// ReportError is returned with a Report answering a SNMPv3 request, as for wrong digests
+type ReportError struct {
+	OID   string
+	Value interface{}
+}
+
+func (e *ReportError) Error() string {
+	return fmt.Sprintf("snmptest: report %v = %v", e.OID, e.Value)
+}
+
+// Client is a manager of an Agent. Responses are returned decoded, with their error-status and
+// error-index, so tests could assert on them. It is safe for concurrent use.
+type Client struct {
+	Version   gosnmp.SnmpVersion
+	Community string
+
+	// User, MsgFlags and ContextName are the security of SNMPv3 requests
+	User        *gosnmp.UsmSecurityParameters
+	MsgFlags    gosnmp.SnmpV3MsgFlags
+	ContextName string
+
+	// Timeout of each request. if sets to 0, DefaultTimeout is used
+	Timeout time.Duration
+	// MaxRepetitions of BulkWalk. if sets to 0, DefaultMaxRepetitions is used
+	MaxRepetitions uint32
+
+	conn      *GoSNMPServer.MemoryConn
+	requestID atomic.Uint32
+
+	mu         sync.Mutex
+	localized  *gosnmp.UsmSecurityParameters // User with the keys of the engine discovered
+	discovered time.Time
+}
+
+// Client returns a SNMPv1 / SNMPv2c manager using community
+func (a *Agent) Client(version gosnmp.SnmpVersion, community string) *Client {
+	return &Client{Version: version, Community: community, conn: a.Listener.Dial()}
+}
+
+// ClientV3 returns a SNMPv3 manager using user at the security level of flags. The engine of the
+// agent is discovered on the first request.
+func (a *Agent) ClientV3(user *gosnmp.UsmSecurityParameters, flags gosnmp.SnmpV3MsgFlags, contextName string) *Client {
+	return &Client{
+		Version:     gosnmp.Version3,
+		User:        user.Copy().(*gosnmp.UsmSecurityParameters),
+		MsgFlags:    flags,
+		ContextName: contextName,
+		conn:        a.Listener.Dial(),
+	}
+}
+
+func nullPDUs(oids []string) []gosnmp.SnmpPDU {
+	pdus := make([]gosnmp.SnmpPDU, 0, len(oids))
+	for _, oid := range oids {
+		pdus = append(pdus, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Null})
+	}
+	return pdus
+}
+
+func (c *Client) packet(pduType gosnmp.PDUType, pdus []gosnmp.SnmpPDU) *gosnmp.SnmpPacket {
+	return &gosnmp.SnmpPacket{
+		Version:   c.Version,
+		Community: c.Community,
+		PDUType:   pduType,
+		Variables: pdus,
+	}
+}
+
+// Get sends a GetRequest of oids
+func (c *Client) Get(oids ...string) (*gosnmp.SnmpPacket, error) {
+	return c.Send(c.packet(gosnmp.GetRequest, nullPDUs(oids)))
+}
+
+// GetNext sends a GetNextRequest of oids
+func (c *Client) GetNext(oids ...string) (*gosnmp.SnmpPacket, error) {
+	return c.Send(c.packet(gosnmp.GetNextRequest, nullPDUs(oids)))
+}
+
+// GetBulk sends a GetBulkRequest of oids
+func (c *Client) GetBulk(nonRepeaters uint8, maxRepetitions uint32, oids ...string) (*gosnmp.SnmpPacket, error) {
+	request := c.packet(gosnmp.GetBulkRequest, nullPDUs(oids))
+	request.NonRepeaters, request.MaxRepetitions = nonRepeaters, maxRepetitions
+	return c.Send(request)
+}
+
+// Set sends a SetRequest of pdus
+func (c *Client) Set(pdus ...gosnmp.SnmpPDU) (*gosnmp.SnmpPacket, error) {
+	return c.Send(c.packet(gosnmp.SetRequest, pdus))
+}
+
+// SendTrap sends trap as a Trap (SNMPv1), SNMPv2-Trap or InformRequest, with its variables as given.
+// The response is returned for informs, nil otherwise once the agent served the trap.
+func (c *Client) SendTrap(trap gosnmp.SnmpTrap) (*gosnmp.SnmpPacket, error) {
+	request := c.packet(gosnmp.SNMPv2Trap, trap.Variables)
+	switch {
+	case c.Version == gosnmp.Version1:
+		request.PDUType = gosnmp.Trap
+		request.SnmpTrap = trap
+	case trap.IsInform:
+		request.PDUType = gosnmp.InformRequest
+	}
+	return c.Send(request)
+}
+
+// Walk returns the variables under root ("" for all) as a GetNext walk sees them
+func (c *Client) Walk(root string) ([]gosnmp.SnmpPDU, error) {
+	return c.walk(root, func(name string) (*gosnmp.SnmpPacket, error) {
+		return c.GetNext(name)
+	})
+}
+
+// BulkWalk returns the variables under root ("" for all) as a GetBulk walk sees them
+func (c *Client) BulkWalk(root string) ([]gosnmp.SnmpPDU, error) {
+	maxRepetitions := c.MaxRepetitions
+	if maxRepetitions == 0 {
+		maxRepetitions = DefaultMaxRepetitions
+	}
+	return c.walk(root, func(name string) (*gosnmp.SnmpPacket, error) {
+		return c.GetBulk(0, maxRepetitions, name)
+	})
+}
+
+func (c *Client) walk(root string, next func(name string) (*gosnmp.SnmpPacket, error)) ([]gosnmp.SnmpPDU, error) {
+	var prefix GoSNMPServer.OID
+	if root != "" {
+		var err error
+		if prefix, err = GoSNMPServer.ParseOID(root); err != nil {
+			return nil, err
+		}
+	}
+	name, last := "."+prefix.String(), prefix
+	if len(prefix) == 0 {
+		// the least OID marshalled
+		name = ".0.0"
+	}
+	var pdus []gosnmp.SnmpPDU
+	for {
+		response, err := next(name)
+		if err != nil {
+			return pdus, err
+		}
+		if c.Version == gosnmp.Version1 && response.Error == gosnmp.NoSuchName {
+			// end of the MIB view of SNMPv1
+			return pdus, nil
+		}
+		if response.Error != gosnmp.NoError {
+			return pdus, &StatusError{Status: response.Error, Index: response.ErrorIndex}
+		}
+		if len(response.Variables) == 0 {
+			return pdus, errors.Errorf("snmptest: walk %v: no variable returned", name)
+		}
+		for _, pdu := range response.Variables {
+			if pdu.Type == gosnmp.EndOfMibView {
+				return pdus, nil
+			}
+			oid, err := GoSNMPServer.ParseOID(pdu.Name)
+			if err != nil {
+				return pdus, err
+			}
+			if !oid.HasPrefix(prefix) {
+				return pdus, nil
+			}
+			if oid.Compare(last) <= 0 {
+				return pdus, errors.Errorf("snmptest: walk %v: oid %v not increasing", name, pdu.Name)
+			}
+			pdus = append(pdus, pdu)
+			name, last = pdu.Name, oid
+		}
+	}
+}
+
+// Send sends request, filling its request-id and, for SNMPv3, its security. It returns the response
+// decoded, nil for traps which are not answered.
+func (c *Client) Send(request *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var usm *gosnmp.UsmSecurityParameters
+	if request.Version == gosnmp.Version3 {
+		var err error
+		if usm, err = c.security(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+	return c.exchange(ctx, request, usm)
+}
+
+// exchange sends request, decoding a SNMPv3 response with the keys of usm
+func (c *Client) exchange(ctx context.Context, request *gosnmp.SnmpPacket, usm *gosnmp.UsmSecurityParameters) (*gosnmp.SnmpPacket, error) {
+	request.RequestID = c.requestID.Add(1) & 0x7fffffff
+	request.MsgID = request.RequestID
+	out, err := request.MarshalMsg()
+	if err != nil {
+		return nil, errors.WithMessage(err, "snmptest: marshal")
+	}
+	in, err := c.conn.Exchange(ctx, out)
+	if err != nil {
+		return nil, err
+	}
+	if request.PDUType == gosnmp.Trap || request.PDUType == gosnmp.SNMPv2Trap {
+		// unconfirmed, whatever the agent replied
+		return nil, nil
+	}
+	if in == nil {
+		return nil, ErrNoResponse
+	}
+	decoder := gosnmp.GoSNMP{Version: request.Version, SecurityModel: request.SecurityModel}
+	if usm != nil {
+		decoder.SecurityParameters = usm.Copy()
+	}
+	response, err := decoder.SnmpDecodePacket(in)
+	if err != nil {
+		return nil, errors.WithMessage(err, "snmptest: decode")
+	}
+	if request.Version == gosnmp.Version3 && response.MsgID != request.MsgID {
+		// reports to messages not decoded carry no request-id
+		return response, errors.Errorf("snmptest: msgID %v answered with %v", request.MsgID, response.MsgID)
+	}
+	if request.Version != gosnmp.Version3 && response.RequestID != request.RequestID {
+		return response, errors.Errorf("snmptest: request-id %v answered with %v", request.RequestID, response.RequestID)
+	}
+	if response.PDUType == gosnmp.Report {
+		report := &ReportError{}
+		if len(response.Variables) != 0 {
+			report.OID, report.Value = response.Variables[0].Name, response.Variables[0].Value
+		}
+		return response, report
+	}
+	return response, nil
+}
+
+// security sets the SNMPv3 security of request, discovering the engine of the agent first
+func (c *Client) security(ctx context.Context, request *gosnmp.SnmpPacket) (*gosnmp.UsmSecurityParameters, error) {
+	if c.User == nil {
+		return nil, errors.New("snmptest: SNMPv3 without User")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.localized == nil {
+		probe := &gosnmp.SnmpPacket{
+			Version:            gosnmp.Version3,
+			MsgFlags:           gosnmp.Reportable | gosnmp.NoAuthNoPriv,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{},
+			PDUType:            gosnmp.GetRequest,
+		}
+		response, err := c.exchange(ctx, probe, &gosnmp.UsmSecurityParameters{UserName: c.User.UserName})
+		var report *ReportError
+		if !errors.As(err, &report) {
+			return nil, errors.Errorf("snmptest: engine discovery answered with %v", err)
+		}
+		engine, ok := response.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if !ok || engine.AuthoritativeEngineID == "" {
+			return nil, errors.New("snmptest: engine discovery answered without engine")
+		}
+		localized := c.User.Copy().(*gosnmp.UsmSecurityParameters)
+		localized.AuthoritativeEngineID = engine.AuthoritativeEngineID
+		localized.AuthoritativeEngineBoots = engine.AuthoritativeEngineBoots
+		localized.AuthoritativeEngineTime = engine.AuthoritativeEngineTime
+		if err := localized.InitSecurityKeys(); err != nil {
+			return nil, errors.WithMessage(err, "snmptest")
+		}
+		c.localized, c.discovered = localized, time.Now()
+	}
+
+	usm := c.localized.Copy().(*gosnmp.UsmSecurityParameters)
+	usm.AuthoritativeEngineTime += uint32(time.Since(c.discovered).Seconds())
+	request.MsgFlags = c.MsgFlags
+	if request.PDUType != gosnmp.SNMPv2Trap && request.PDUType != gosnmp.GetResponse {
+		request.MsgFlags |= gosnmp.Reportable
+	}
+	request.SecurityModel = gosnmp.UserSecurityModel
+	request.SecurityParameters = usm
+	request.ContextEngineID = usm.AuthoritativeEngineID
+	request.ContextName = c.ContextName
+	// salts are allocated by the localized user, so that they are not reused
+	if err := c.localized.InitPacket(request); err != nil {
+		return nil, errors.WithMessage(err, "snmptest")
+	}
+	return usm, nil
+}
@@ -0,0 +1,57 @@
+// Package snmptest serves a MasterAgent in-process for tests, through a GoSNMPServer.MemoryListener:
+//
+//	agent := snmptest.NewAgent(t, master)
+//	client := agent.Client(gosnmp.Version2c, "public")
+//	response, err := client.Get("1.3.6.1.2.1.1.1.0")
+//
+// No socket is bound, so tests run hermetically and in parallel.
+package snmptest
+
+import (
+	"testing"
+
+	"github.com/eriksejr/GoSNMPServer"
+)
+
+// Agent serves a MasterAgent until the test ends
+type Agent struct {
+	Server   *GoSNMPServer.SNMPServer
+	Listener *GoSNMPServer.MemoryListener
+
+	stopped chan struct{}
+}
+
+// NewAgent serves master until tb and its subtests complete. The test fails if master is not ReadyForWork.
+func NewAgent(tb testing.TB, master GoSNMPServer.MasterAgent) *Agent {
+	tb.Helper()
+	if err := master.ReadyForWork(); err != nil {
+		tb.Fatalf("snmptest: %v", err)
+	}
+	agent := &Agent{
+		Server:   GoSNMPServer.NewSNMPServer(master),
+		Listener: GoSNMPServer.NewMemoryListener(tb.Name()),
+		stopped:  make(chan struct{}),
+	}
+	if err := agent.Server.Listen(agent.Listener); err != nil {
+		tb.Fatalf("snmptest: %v", err)
+	}
+	go func() {
+		defer close(agent.stopped)
+		if err := agent.Server.ServeForever(); err != nil {
+			tb.Errorf("snmptest: %v", err)
+		}
+	}()
+	tb.Cleanup(agent.Close)
+	return agent
+}
+
+// Close stops serving, waiting for the request being served
+func (a *Agent) Close() {
+	a.Server.Shutdown()
+	<-a.stopped
+}
+
+// Metrics returns the counters of the MasterAgent served. nil unless MasterAgent.Metrics is set
+func (a *Agent) Metrics() *GoSNMPServer.Metrics {
+	return a.Server.Metrics()
+}
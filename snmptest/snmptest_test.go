@@ -0,0 +1,191 @@
+package snmptest_test
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+
+	"github.com/eriksejr/GoSNMPServer"
+	"github.com/eriksejr/GoSNMPServer/snmptest"
+)
+
+var testOIDs = []string{
+	"1.3.6.1.2.1.1.1.0",
+	"1.3.6.1.2.1.1.2.0",
+	"1.3.6.1.2.1.1.3.0",
+	"1.3.6.1.2.1.2.1.0",
+	"1.3.6.1.2.1.2.2.1.1.1",
+	"1.3.6.1.2.1.2.2.1.1.2",
+}
+
+func testUser() *gosnmp.UsmSecurityParameters {
+	return &gosnmp.UsmSecurityParameters{
+		UserName:                 "admin",
+		AuthenticationProtocol:   gosnmp.SHA256,
+		AuthenticationPassphrase: "authpass123",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privpass123",
+	}
+}
+
+// testMaster serves testOIDs read-write, and counts the traps of 1.3.6.1.4.1.1.1
+func testMaster(traps *atomic.Int32) GoSNMPServer.MasterAgent {
+	var items []*GoSNMPServer.PDUValueControlItem
+	for _, oid := range testOIDs {
+		value := "v" + oid
+		items = append(items, &GoSNMPServer.PDUValueControlItem{
+			OID:   oid,
+			Type:  gosnmp.OctetString,
+			OnGet: func() (interface{}, error) { return value, nil },
+			OnSet: func(interface{}) error { return nil },
+		})
+	}
+	items = append(items, &GoSNMPServer.PDUValueControlItem{
+		OID:  "1.3.6.1.4.1.1.1",
+		Type: gosnmp.OctetString,
+		OnTrap: func(isInform bool, trapdata gosnmp.SnmpPDU) (interface{}, error) {
+			traps.Add(1)
+			return "ok", nil
+		},
+	})
+	master := GoSNMPServer.MasterAgent{
+		AllowedVersion: GoSNMPServer.SNMPV1 | GoSNMPServer.SNMPV2c | GoSNMPServer.SNMPV3,
+		SubAgents:      []*GoSNMPServer.SubAgent{{CommunityIDs: []string{"public"}, OIDs: items}},
+		SecurityConfig: GoSNMPServer.SecurityConfig{AuthoritativeEngineBoots: 1},
+	}
+	master.SecurityConfig.Users = make([]gosnmp.UsmSecurityParameters, 1)
+	user := testUser()
+	master.SecurityConfig.Users[0].UserName = user.UserName
+	master.SecurityConfig.Users[0].AuthenticationProtocol = user.AuthenticationProtocol
+	master.SecurityConfig.Users[0].AuthenticationPassphrase = user.AuthenticationPassphrase
+	master.SecurityConfig.Users[0].PrivacyProtocol = user.PrivacyProtocol
+	master.SecurityConfig.Users[0].PrivacyPassphrase = user.PrivacyPassphrase
+	return master
+}
+
+func names(pdus []gosnmp.SnmpPDU) []string {
+	ret := make([]string, 0, len(pdus))
+	for _, pdu := range pdus {
+		ret = append(ret, pdu.Name)
+	}
+	return ret
+}
+
+func TestAgent(t *testing.T) {
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c, gosnmp.Version3} {
+		version := version
+		t.Run(version.String(), func(t *testing.T) {
+			t.Parallel()
+			var traps atomic.Int32
+			agent := snmptest.NewAgent(t, testMaster(&traps))
+			client := agent.Client(version, "public")
+			if version == gosnmp.Version3 {
+				client = agent.ClientV3(testUser(), gosnmp.AuthPriv, "public")
+			}
+
+			response, err := client.Get("1.3.6.1.2.1.1.1.0", "1.3.6.1.9")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version == gosnmp.Version1 {
+				if response.Error != gosnmp.NoSuchName || response.ErrorIndex != 2 {
+					t.Errorf("v1 Get of a missing OID: %v at %d", response.Error, response.ErrorIndex)
+				}
+			} else if response.Error != gosnmp.NoError || response.Variables[1].Type != gosnmp.NoSuchObject ||
+				string(response.Variables[0].Value.([]byte)) != "v1.3.6.1.2.1.1.1.0" {
+				t.Errorf("Get: %v %v", response.Error, response.Variables)
+			}
+
+			walk, err := client.Walk("1.3.6.1.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := fmt.Sprint(names(walk))
+			if len(walk) != len(testOIDs) {
+				t.Errorf("walked %v", expected)
+			}
+			if version != gosnmp.Version1 {
+				bulk, err := client.BulkWalk("")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(names(bulk)) != expected {
+					t.Errorf("bulk walked %v, walked %v", names(bulk), expected)
+				}
+			}
+
+			response, err = client.Set(gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("x")})
+			if err != nil || response.Error != gosnmp.NoError {
+				t.Errorf("Set: %v %v", response, err)
+			}
+
+			trap := gosnmp.SnmpTrap{Variables: []gosnmp.SnmpPDU{{Name: "1.3.6.1.4.1.1.1", Type: gosnmp.OctetString, Value: "t"}}}
+			if version == gosnmp.Version1 {
+				trap.Enterprise, trap.AgentAddress = "1.3.6.1.4.1.1", "127.0.0.1"
+			}
+			// served before SendTrap returns
+			if response, err := client.SendTrap(trap); err != nil || response != nil || traps.Load() != 1 {
+				t.Errorf("trap: %v %v, %d served", response, err, traps.Load())
+			}
+			if version != gosnmp.Version1 {
+				trap.IsInform = true
+				response, err := client.SendTrap(trap)
+				if err != nil || response.PDUType != gosnmp.GetResponse || traps.Load() != 2 {
+					t.Fatalf("inform: %v %v, %d served", response, err, traps.Load())
+				}
+				if string(response.Variables[0].Value.([]byte)) != "ok" {
+					t.Errorf("inform answered %v", response.Variables)
+				}
+			}
+		})
+	}
+}
+
+func TestAgentWrongDigest(t *testing.T) {
+	var traps atomic.Int32
+	agent := snmptest.NewAgent(t, testMaster(&traps))
+	user := testUser()
+	user.AuthenticationPassphrase, user.PrivacyProtocol, user.PrivacyPassphrase = "wrongpass123", gosnmp.NoPriv, ""
+	_, err := agent.ClientV3(user, gosnmp.AuthNoPriv, "public").Get("1.3.6.1.2.1.1.1.0")
+	var report *snmptest.ReportError
+	if !errors.As(err, &report) || report.OID != ".1.3.6.1.6.3.15.1.1.5.0" {
+		t.Errorf("wrong digest: %v", err)
+	}
+}
+
+func TestAgentNoResponse(t *testing.T) {
+	var traps atomic.Int32
+	master := testMaster(&traps)
+	master.RateLimits.PerCommunity = GoSNMPServer.RateLimit{Rate: 0.001, Burst: 1}
+	agent := snmptest.NewAgent(t, master)
+	client := agent.Client(gosnmp.Version2c, "public")
+	if _, err := client.Get("1.3.6.1.2.1.1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get("1.3.6.1.2.1.1.1.0"); err != snmptest.ErrNoResponse {
+		t.Errorf("dropped request: %v", err)
+	}
+	agent.Close()
+	if _, err := client.Get("1.3.6.1.2.1.1.1.0"); err == nil {
+		t.Error("answered once closed")
+	}
+}
+
+func TestAgentWalkStatusError(t *testing.T) {
+	var traps atomic.Int32
+	master := testMaster(&traps)
+	master.SubAgents[0].UserErrorMarkPacket = true
+	master.SubAgents[0].OIDs[2].OnGet = func() (interface{}, error) { return nil, errors.New("backend down") }
+	agent := snmptest.NewAgent(t, master)
+	walk, err := agent.Client(gosnmp.Version2c, "public").Walk("")
+	var status *snmptest.StatusError
+	if !errors.As(err, &status) || status.Status != gosnmp.GenErr || status.Index != 1 {
+		t.Fatalf("walk error %v", err)
+	}
+	if len(walk) != 2 {
+		t.Errorf("walked %v before the error", names(walk))
+	}
+}
@@ -0,0 +1,65 @@
+package GoSNMPServer
+
+import (
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// v1ErrorFromV2 maps an SNMPv2 error-status to the SNMPv1 set. See RFC3584 section 4.4
+func v1ErrorFromV2(err gosnmp.SNMPError) gosnmp.SNMPError {
+	switch err {
+	case gosnmp.NoError, gosnmp.TooBig, gosnmp.NoSuchName, gosnmp.BadValue, gosnmp.GenErr:
+		return err
+	case gosnmp.WrongValue, gosnmp.WrongEncoding, gosnmp.WrongType, gosnmp.WrongLength, gosnmp.InconsistentValue:
+		return gosnmp.BadValue
+	case gosnmp.ReadOnly, gosnmp.NoAccess, gosnmp.NotWritable, gosnmp.NoCreation,
+		gosnmp.InconsistentName, gosnmp.AuthorizationError:
+		return gosnmp.NoSuchName
+	default:
+		// ResourceUnavailable, CommitFailed, UndoFailed
+		return gosnmp.GenErr
+	}
+}
+
+// isV1Exception reports if a varbind could not be carried by a SNMPv1 response
+func isV1Exception(pdu *gosnmp.SnmpPDU) bool {
+	switch pdu.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Counter64:
+		return true
+	default:
+		return false
+	}
+}
+
+// responseForV1 translates the result of serving a SNMPv1 request as RFC3584 section 4.2 / 4.4 asks:
+//
+//	v2 error-status are mapped to the v1 set.
+//	noSuchObject / noSuchInstance / endOfMibView and Counter64 varbinds become noSuchName.
+//	error responses carry the variable bindings of the request.
+func (t *MasterAgent) responseForV1(request, response *gosnmp.SnmpPacket, err error) (*gosnmp.SnmpPacket, error) {
+	if response == nil || errors.Is(err, ErrRequestDropped) {
+		return nil, err
+	}
+	ret := copySnmpPacket(request)
+	if err != nil {
+		t.priv.logger.Debug("v1 response for error", "err", err)
+		if errFill := t.fillErrorPkt(err, &ret); errFill != nil {
+			return nil, errors.WithStack(errFill)
+		}
+	} else {
+		ret = *response
+		for id := range ret.Variables {
+			if ret.Error != gosnmp.NoError {
+				break
+			}
+			if isV1Exception(&ret.Variables[id]) {
+				setErrorStatus(&ret, gosnmp.NoSuchName, id+1)
+			}
+		}
+	}
+	ret.Error = v1ErrorFromV2(ret.Error)
+	if ret.Error != gosnmp.NoError {
+		ret.Variables = request.Variables
+	}
+	return &ret, nil
+}
@@ -0,0 +1,50 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestErrorIndexBeyondOctet(t *testing.T) {
+	var oids []string
+	for id := 1; id <= 300; id++ {
+		oids = append(oids, fmt.Sprintf("1.3.6.1.4.1.1.%d.0", id))
+	}
+	items := stringOIDs(oids...)
+	master := MasterAgent{SubAgents: []*SubAgent{{OIDs: items}}}
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	applied := 0
+	for _, item := range items {
+		item.OnSet = func(interface{}) error {
+			applied++
+			return nil
+		}
+	}
+	set := func(count, readOnly int) *gosnmp.SnmpPacket {
+		onSet := items[readOnly].OnSet
+		items[readOnly].OnSet = nil
+		defer func() { items[readOnly].OnSet = onSet }()
+		applied = 0
+		request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "public", PDUType: gosnmp.SetRequest}
+		for _, oid := range oids[:count] {
+			request.Variables = append(request.Variables, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.OctetString, Value: "x"})
+		}
+		ret, err := master.SubAgents[0].Serve(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	if ret := set(255, 254); ret.Error != gosnmp.ReadOnly || ret.ErrorIndex != 255 {
+		t.Errorf("error %v index %d, expected readOnly at 255", ret.Error, ret.ErrorIndex)
+	}
+	// refused before any is set
+	if ret := set(300, 279); ret.Error != gosnmp.TooBig || ret.ErrorIndex != 0 || len(ret.Variables) != 0 || applied != 0 {
+		t.Errorf("error %v index %d with %d varbinds, %d set, expected an empty tooBig", ret.Error, ret.ErrorIndex,
+			len(ret.Variables), applied)
+	}
+}
@@ -0,0 +1,244 @@
+package GoSNMPServer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// streamMessage is a message read from a connection of a StreamListener
+type streamMessage struct {
+	data    []byte
+	replyer *StreamReplyer
+}
+
+// StreamListener accepts stream connections (Unix, TLS), each sending SNMP messages one after another.
+// See NewUnixListener and NewTLSListener.
+type StreamListener struct {
+	listener net.Listener
+	logger   *slog.Logger
+	maxSize  int
+	messages chan streamMessage
+	// open prepares the replyer of a connection accepted, and refuses it on error
+	open func(conn net.Conn) (*StreamReplyer, error)
+	// datagrams tells each read of a replyer connection returns one whole message, as over DTLS
+	datagrams bool
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	connections map[net.Conn]struct{}
+}
+
+// newStreamListener serves the connections of listener, which open prepares
+func newStreamListener(listener net.Listener, open func(conn net.Conn) (*StreamReplyer, error)) *StreamListener {
+	ret := &StreamListener{
+		listener:    listener,
+		logger:      NewDiscardLogger(),
+		maxSize:     DefaultMaxMessageSize,
+		messages:    make(chan streamMessage),
+		open:        open,
+		closed:      make(chan struct{}),
+		connections: make(map[net.Conn]struct{}),
+	}
+	go ret.accept()
+	return ret
+}
+
+func (l *StreamListener) SetupLogger(i *log.Logger) {
+	l.logger = loggerFromLog(i)
+}
+
+func (l *StreamListener) SetupStructuredLogger(i *slog.Logger) {
+	l.logger = i
+}
+
+// SetBufferSize sets the largest message accepted. Connections sending larger messages are closed.
+func (l *StreamListener) SetBufferSize(size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxSize = size
+}
+
+func (l *StreamListener) Address() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *StreamListener) accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			select {
+			case <-l.closed:
+			default:
+				l.logger.Warn("stream accept failed", "err", err)
+				l.Shutdown()
+			}
+			return
+		}
+		l.mu.Lock()
+		l.connections[conn] = struct{}{}
+		maxSize := l.maxSize
+		l.mu.Unlock()
+		go l.read(conn, maxSize)
+	}
+}
+
+// read passes the messages of conn to NextSnmp, until conn is closed or sends something else
+func (l *StreamListener) read(conn net.Conn, maxSize int) {
+	defer func() {
+		conn.Close()
+		l.mu.Lock()
+		delete(l.connections, conn)
+		l.mu.Unlock()
+	}()
+	replyer, err := l.open(conn)
+	if err != nil {
+		l.logger.Debug("stream connection refused", "peer", conn.RemoteAddr(), "err", err)
+		return
+	}
+	defer replyer.conn.Close()
+	next := streamReader(replyer.conn, maxSize)
+	if l.datagrams {
+		next = datagramReader(replyer.conn, maxSize)
+	}
+	for {
+		msg, err := next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				l.logger.Debug("stream connection closed", "peer", conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+		select {
+		case l.messages <- streamMessage{data: msg, replyer: replyer}:
+		case <-l.closed:
+			return
+		}
+	}
+}
+
+// streamReader returns the messages of conn one after another
+func streamReader(conn net.Conn, maxSize int) func() ([]byte, error) {
+	reader := bufio.NewReader(conn)
+	return func() ([]byte, error) {
+		return readBERMessage(reader, maxSize)
+	}
+}
+
+// datagramReader returns the messages of conn, one per read of up to maxSize bytes
+func datagramReader(conn net.Conn, maxSize int) func() ([]byte, error) {
+	buffer := make([]byte, maxSize)
+	return func() ([]byte, error) {
+		count, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), buffer[:count]...), nil
+	}
+}
+
+// readBERMessage reads one message of a stream: a BER SEQUENCE of up to maxSize bytes
+func readBERMessage(r *bufio.Reader, maxSize int) ([]byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x30 {
+		return nil, errors.Errorf("message starts with tag %#x", tag)
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	header := []byte{tag, first}
+	length := int(first)
+	if first&0x80 != 0 {
+		octets := int(first & 0x7f)
+		if octets == 0 || octets > 4 {
+			return nil, errors.Errorf("message length of %d octets", octets)
+		}
+		length = 0
+		for i := 0; i < octets; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			header = append(header, b)
+			length = length<<8 | int(b)
+		}
+	}
+	if length < 0 || len(header)+length > maxSize {
+		return nil, errors.Errorf("message of %d bytes exceeds %d", len(header)+length, maxSize)
+	}
+	msg := make([]byte, len(header)+length)
+	copy(msg, header)
+	if _, err := io.ReadFull(r, msg[len(header):]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (l *StreamListener) NextSnmp() ([]byte, IReplyer, error) {
+	select {
+	case msg := <-l.messages:
+		l.logger.Debug("stream request", "peer", msg.replyer.RemoteAddr(), "size", len(msg.data))
+		return msg.data, msg.replyer, nil
+	case <-l.closed:
+		addr := l.listener.Addr()
+		return nil, nil, &net.OpError{Op: "read", Net: addr.Network(), Addr: addr, Err: net.ErrClosed}
+	}
+}
+
+func (l *StreamListener) Shutdown() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.listener.Close()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for conn := range l.connections {
+			conn.Close()
+		}
+	})
+}
+
+// StreamReplyer replies on a stream connection
+type StreamReplyer struct {
+	mu          sync.Mutex
+	conn        net.Conn
+	credentials *PeerCredentials
+	tlsState    *tls.ConnectionState
+}
+
+func (r *StreamReplyer) ReplyPDU(i []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.conn.Write(i); err != nil {
+		return errors.Wrap(err, "Write")
+	}
+	return nil
+}
+
+func (r *StreamReplyer) RemoteAddr() net.Addr {
+	return r.conn.RemoteAddr()
+}
+
+func (r *StreamReplyer) PeerCredentials() *PeerCredentials {
+	return r.credentials
+}
+
+func (r *StreamReplyer) TLSConnectionState() *tls.ConnectionState {
+	return r.tlsState
+}
+
+// Shutdown closes the connection, as its messages could not be served
+func (r *StreamReplyer) Shutdown() {
+	r.conn.Close()
+}
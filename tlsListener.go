@@ -0,0 +1,77 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tlsHandshakeTimeout bounds the TLS handshake of a connection accepted
+const tlsHandshakeTimeout = 10 * time.Second
+
+// NewTLSListener listens for SNMP over TLS (RFC6353) on a TCP address, messages being sent one after
+// another. Managers shall present a certificate, mapped to a tmSecurityName by SecurityConfig.CertToNames.
+//
+//	config shall hold the certificate of the agent. Client certificates are always required. Their
+//	chain is verified against config.ClientCAs when set, so CertToNameEntry may name CA fingerprints.
+//	TLS older than 1.2 is refused.
+//
+// See NewDTLSListener for DTLS over UDP.
+func NewTLSListener(network, address string, config *tls.Config) (ISnmpServerListener, error) {
+	if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil) {
+		return nil, errors.New("TLS listener without certificate")
+	}
+	config = config.Clone()
+	// chains are verified once connected, so that certificates known by their fingerprint need no CA.
+	// CAs are not advertised either, as clients would withhold certificates of other issuers.
+	roots := config.ClientCAs
+	config.ClientAuth, config.ClientCAs = tls.RequireAnyClientCert, nil
+	if config.MinVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "TLS Listen Error")
+	}
+	return newStreamListener(tls.NewListener(listener, config), func(conn net.Conn) (*StreamReplyer, error) {
+		return openTLS(conn, roots)
+	}), nil
+}
+
+// openTLS completes the handshake of conn, so its replyer tells the certificates of the manager.
+// Their chain is verified against roots, if any.
+func openTLS(conn net.Conn, roots *x509.CertPool) (*StreamReplyer, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, errors.Errorf("%T is not a TLS connection", conn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "TLS handshake")
+	}
+	state := tlsConn.ConnectionState()
+	verifyClientChain(&state, roots)
+	return &StreamReplyer{conn: conn, tlsState: &state}, nil
+}
+
+// verifyClientChain sets the VerifiedChains of state, when its client certificate chains to roots
+func verifyClientChain(state *tls.ConnectionState, roots *x509.CertPool) {
+	if roots == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	// an unverified chain is no error: the client certificate may be known by its fingerprint
+	state.VerifiedChains, _ = state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
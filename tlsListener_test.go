@@ -0,0 +1,219 @@
+package GoSNMPServer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pion/dtls/v2"
+)
+
+// tlsTestCerts are the certificates of the agent and of its managers
+type tlsTestCerts struct {
+	ca, agent *testCert
+	// manager is self signed, known by its fingerprint. byCA is signed by ca, known by the fingerprint
+	// of ca. stranger is unknown.
+	manager, byCA, stranger *testCert
+}
+
+func newTLSTestCerts(t *testing.T) *tlsTestCerts {
+	ca := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true}, nil)
+	return &tlsTestCerts{
+		ca:       ca,
+		agent:    newTestCert(t, &x509.Certificate{DNSNames: []string{"localhost"}}, ca),
+		manager:  newTestCert(t, &x509.Certificate{DNSNames: []string{"Mgr.Example.COM"}}, nil),
+		byCA:     newTestCert(t, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}, ca),
+		stranger: newTestCert(t, &x509.Certificate{DNSNames: []string{"stranger.example.com"}}, nil),
+	}
+}
+
+// master maps manager to "mgr.example.com", read-write, and byCA to "0A000001", limited to 1.3.6.1.2.1.1
+func (c *tlsTestCerts) master(prefix string, audit AuditSink) MasterAgent {
+	return MasterAgent{
+		AllowedVersion: SNMPV3,
+		AuditSink:      audit,
+		SubAgents:      []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.1.0")}},
+		SecurityConfig: SecurityConfig{
+			CertToNames: []CertToNameEntry{
+				{Fingerprint: TLSFingerprint(c.manager.cert), MapType: CertMapSANDNSName},
+				{Fingerprint: TLSFingerprint(c.ca.cert), MapType: CertMapSANIPAddress},
+			},
+			AccessPolicies: []AccessPolicy{
+				{SecurityName: prefix + "mgr.example.com", ReadWrite: true},
+				{SecurityName: prefix + "0A000001", View: OIDView{"1.3.6.1.2.1.1"}},
+			},
+			TSMUsePrefix: prefix != "",
+		},
+	}
+}
+
+func (c *tlsTestCerts) agentConfig() *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(c.ca.cert)
+	return &tls.Config{Certificates: []tls.Certificate{c.agent.tls()}, ClientCAs: roots}
+}
+
+// tlsServe serves master on the listener listen adds, until the test ends
+func tlsServe(t *testing.T, master MasterAgent, listen func(*SNMPServer) error) *SNMPServer {
+	t.Helper()
+	server := NewSNMPServer(master)
+	if err := listen(server); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeForever()
+	}()
+	t.Cleanup(func() {
+		server.Shutdown()
+		<-done
+	})
+	return server
+}
+
+// tsmRequest returns a SNMPv3 request of the Transport Security Model, of type pduType
+func tsmRequest(pduType gosnmp.PDUType, variables ...gosnmp.SnmpPDU) *gosnmp.SnmpPacket {
+	return &gosnmp.SnmpPacket{Version: gosnmp.Version3, MsgID: 3, MsgMaxSize: 65000, MsgFlags: gosnmp.AuthPriv | gosnmp.Reportable,
+		SecurityModel: tsmSecurityModel, PDUType: pduType, RequestID: 7, Variables: variables}
+}
+
+// tsmExchange sends request through conn, returning the response of server
+func tsmExchange(t *testing.T, server *SNMPServer, conn net.Conn, request *gosnmp.SnmpPacket) (*gosnmp.SnmpPacket, error) {
+	t.Helper()
+	raw, err := marshalTSM(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(raw); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	raw, err = readBERMessage(bufio.NewReader(conn), DefaultMaxMessageSize)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := parseTSMMessage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := server.master.decodeTSMRequest(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, nil
+}
+
+func tlsDial(t *testing.T, server *SNMPServer, client *testCert) net.Conn {
+	t.Helper()
+	conn, err := tls.Dial("tcp", server.Address().String(), &tls.Config{
+		Certificates: []tls.Certificate{client.tls()}, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func dtlsDial(t *testing.T, server *SNMPServer, client *testCert) net.Conn {
+	t.Helper()
+	conn, err := dtls.Dial("udp", server.Address().(*net.UDPAddr), &dtls.Config{
+		Certificates: []tls.Certificate{client.tls()}, InsecureSkipVerify: true,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// testTSMTransport serves managers over the transport of listen, dial connecting a manager
+func testTSMTransport(t *testing.T, listen func(*SNMPServer, *tls.Config) error, dial func(*testing.T, *SNMPServer, *testCert) net.Conn) {
+	certs := newTLSTestCerts(t)
+	server := tlsServe(t, certs.master("", nil), func(server *SNMPServer) error {
+		return listen(server, certs.agentConfig())
+	})
+	get := tsmRequest(gosnmp.GetRequest,
+		gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.Null},
+		gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.2.1.0", Type: gosnmp.Null})
+
+	conn := dial(t, server, certs.manager)
+	response, err := tsmExchange(t, server, conn, get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.PDUType != gosnmp.GetResponse || response.MsgID != get.MsgID || response.Error != gosnmp.NoError ||
+		len(response.Variables) != 2 || string(response.Variables[1].Value.([]byte)) != "v1.3.6.1.2.1.2.1.0" {
+		t.Errorf("manager Get: %v %v %v", response.PDUType, response.Error, response.Variables)
+	}
+	// several requests over a session
+	set := tsmRequest(gosnmp.SetRequest, gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "x"})
+	if response, err := tsmExchange(t, server, conn, set); err != nil || response.Error != gosnmp.NoError {
+		t.Errorf("manager Set: %v %v", response, err)
+	}
+
+	// the view of the names mapped by the CA
+	response, err = tsmExchange(t, server, dial(t, server, certs.byCA), get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != gosnmp.NoError || response.Variables[0].Type != gosnmp.OctetString ||
+		response.Variables[1].Type != gosnmp.NoSuchObject {
+		t.Errorf("Get by CA: %v %v", response.Error, response.Variables)
+	}
+
+	// unknown certificates are refused, and their session closed
+	if response, err := tsmExchange(t, server, dial(t, server, certs.stranger), get); err == nil {
+		t.Errorf("unknown certificate answered %v", response)
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	testTSMTransport(t, func(server *SNMPServer, config *tls.Config) error {
+		return server.ListenTLS("tcp", "127.0.0.1:0", config)
+	}, tlsDial)
+}
+
+func TestDTLSListener(t *testing.T) {
+	testTSMTransport(t, func(server *SNMPServer, config *tls.Config) error {
+		return server.ListenDTLS("udp", "127.0.0.1:0", config)
+	}, dtlsDial)
+}
+
+func TestTLSListenerConfig(t *testing.T) {
+	if _, err := NewTLSListener("tcp", "127.0.0.1:0", &tls.Config{}); err == nil {
+		t.Error("TLS listener without certificate")
+	}
+	if _, err := NewDTLSListener("udp", "127.0.0.1:0", nil); err == nil {
+		t.Error("DTLS listener without certificate")
+	}
+}
+
+func TestTSMUsePrefix(t *testing.T) {
+	certs := newTLSTestCerts(t)
+	for _, each := range []struct {
+		prefix string
+		listen func(*SNMPServer) error
+		dial   func(*testing.T, *SNMPServer, *testCert) net.Conn
+	}{
+		{"tls:", func(server *SNMPServer) error { return server.ListenTLS("tcp", "127.0.0.1:0", certs.agentConfig()) }, tlsDial},
+		{"dtls:", func(server *SNMPServer) error { return server.ListenDTLS("udp", "127.0.0.1:0", certs.agentConfig()) }, dtlsDial},
+	} {
+		audit := new(InMemoryAuditSink)
+		server := tlsServe(t, certs.master(each.prefix, audit), each.listen)
+		set := tsmRequest(gosnmp.SetRequest, gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "x"})
+		response, err := tsmExchange(t, server, each.dial(t, server, certs.manager), set)
+		if err != nil || response.Error != gosnmp.NoError {
+			t.Fatalf("%s Set: %v %v", each.prefix, response, err)
+		}
+		records := audit.Records()
+		if len(records) != 1 || records[0].SecurityName != each.prefix+"mgr.example.com" {
+			t.Errorf("%s audit records %+v", each.prefix, records)
+		}
+	}
+}
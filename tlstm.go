@@ -0,0 +1,221 @@
+package GoSNMPServer
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tmSecurityNameMaxLength is the longest tmSecurityName, a SnmpAdminString (SIZE(1..32))
+const tmSecurityNameMaxLength = 32
+
+// CertMapType selects how a CertToNameEntry derives the tmSecurityName from the client certificate.
+// The values are the identities of SNMP-TLS-TM-MIB.
+type CertMapType int
+
+const (
+	// CertMapSpecified uses CertToNameEntry.Data (snmpTlstmCertSpecified)
+	CertMapSpecified CertMapType = iota + 1
+	// CertMapSANRFC822Name uses the first rfc822Name, its host part lower cased (snmpTlstmCertSANRFC822Name)
+	CertMapSANRFC822Name
+	// CertMapSANDNSName uses the first dNSName, lower cased (snmpTlstmCertSANDNSName)
+	CertMapSANDNSName
+	// CertMapSANIPAddress uses the first ipAddress, as upper case hexadecimal octets (snmpTlstmCertSANIpAddress)
+	CertMapSANIPAddress
+	// CertMapSANAny uses the first of rfc822Name, dNSName and ipAddress present (snmpTlstmCertSANAny)
+	CertMapSANAny
+	// CertMapCommonName uses the CommonName of the subject (snmpTlstmCertCommonName)
+	CertMapCommonName
+)
+
+func (m CertMapType) String() string {
+	switch m {
+	case CertMapSpecified:
+		return "specified"
+	case CertMapSANRFC822Name:
+		return "san_rfc822_name"
+	case CertMapSANDNSName:
+		return "san_dns_name"
+	case CertMapSANIPAddress:
+		return "san_ip_address"
+	case CertMapSANAny:
+		return "san_any"
+	case CertMapCommonName:
+		return "common_name"
+	default:
+		return fmt.Sprintf("CertMapType(%d)", int(m))
+	}
+}
+
+// CertToNameEntry maps client certificates to a tmSecurityName, as a snmpTlstmCertToTSNEntry
+// of SNMP-TLS-TM-MIB (RFC6353) does. Entries are tried in order, as by snmpTlstmCertToTSNID:
+// the first whose fingerprint matches and whose MapType yields a name is used.
+type CertToNameEntry struct {
+	// Fingerprint is the hash of the client certificate, or of a CA certificate of its verified chain,
+	// as "SHA256:AB:CD:..." (snmpTlstmCertToTSNFingerprint). See TLSFingerprint
+	Fingerprint string
+	// MapType selects how the name is derived (snmpTlstmCertToTSNMapType)
+	MapType CertMapType
+	// Data is the tmSecurityName of CertMapSpecified (snmpTlstmCertToTSNData)
+	Data string
+
+	hash   crypto.Hash
+	digest []byte
+}
+
+// fingerprintHashes are the hashes of SnmpTLSFingerprint allowed, MD5 is not.
+var fingerprintHashes = map[string]crypto.Hash{
+	"SHA1":   crypto.SHA1,
+	"SHA224": crypto.SHA224,
+	"SHA256": crypto.SHA256,
+	"SHA384": crypto.SHA384,
+	"SHA512": crypto.SHA512,
+}
+
+// TLSFingerprint returns the SHA256 fingerprint of cert, as CertToNameEntry.Fingerprint expects
+func TLSFingerprint(cert *x509.Certificate) string {
+	return formatFingerprint(crypto.SHA256, fingerprint(crypto.SHA256, cert))
+}
+
+func fingerprint(hash crypto.Hash, cert *x509.Certificate) []byte {
+	h := hash.New()
+	h.Write(cert.Raw)
+	return h.Sum(nil)
+}
+
+func formatFingerprint(hash crypto.Hash, digest []byte) string {
+	name := strings.ReplaceAll(hash.String(), "-", "")
+	encoded := strings.ToUpper(hex.EncodeToString(digest))
+	parts := make([]string, 0, len(digest))
+	for i := 0; i < len(encoded); i += 2 {
+		parts = append(parts, encoded[i:i+2])
+	}
+	return name + ":" + strings.Join(parts, ":")
+}
+
+func (e *CertToNameEntry) syncConfig() error {
+	name, value, found := strings.Cut(e.Fingerprint, ":")
+	if !found {
+		return errors.Errorf("cert to name: fingerprint %q without hash algorithm", e.Fingerprint)
+	}
+	hash, found := fingerprintHashes[strings.ToUpper(strings.ReplaceAll(name, "-", ""))]
+	if !found {
+		return errors.Errorf("cert to name: unsupported fingerprint algorithm %q", name)
+	}
+	digest, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+	if err != nil || len(digest) != hash.Size() {
+		return errors.Errorf("cert to name: fingerprint %q is not a %v digest", e.Fingerprint, hash)
+	}
+	switch e.MapType {
+	case CertMapSpecified:
+		if e.Data == "" || len(e.Data) > tmSecurityNameMaxLength {
+			return errors.Errorf("cert to name: specified name %q shall have 1 to %d octets", e.Data, tmSecurityNameMaxLength)
+		}
+	case CertMapSANRFC822Name, CertMapSANDNSName, CertMapSANIPAddress, CertMapSANAny, CertMapCommonName:
+	default:
+		return errors.Errorf("cert to name: unsupported map type %v", e.MapType)
+	}
+	e.hash, e.digest = hash, digest
+	return nil
+}
+
+// matches reports if the fingerprint of the entry is one of certs
+func (e *CertToNameEntry) matches(certs []*x509.Certificate) bool {
+	for _, cert := range certs {
+		if bytes.Equal(fingerprint(e.hash, cert), e.digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// name derives the tmSecurityName of client, "" if the entry yields none
+func (e *CertToNameEntry) name(client *x509.Certificate) string {
+	var name string
+	switch e.MapType {
+	case CertMapSpecified:
+		name = e.Data
+	case CertMapSANRFC822Name:
+		name = sanRFC822Name(client)
+	case CertMapSANDNSName:
+		name = sanDNSName(client)
+	case CertMapSANIPAddress:
+		name = sanIPAddress(client)
+	case CertMapSANAny:
+		if name = sanRFC822Name(client); name == "" {
+			if name = sanDNSName(client); name == "" {
+				name = sanIPAddress(client)
+			}
+		}
+	case CertMapCommonName:
+		name = client.Subject.CommonName
+	}
+	if len(name) > tmSecurityNameMaxLength {
+		return ""
+	}
+	return name
+}
+
+func sanRFC822Name(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) == 0 {
+		return ""
+	}
+	local, host, found := strings.Cut(cert.EmailAddresses[0], "@")
+	if !found {
+		return cert.EmailAddresses[0]
+	}
+	return local + "@" + strings.ToLower(host)
+}
+
+func sanDNSName(cert *x509.Certificate) string {
+	if len(cert.DNSNames) == 0 {
+		return ""
+	}
+	return strings.ToLower(cert.DNSNames[0])
+}
+
+func sanIPAddress(cert *x509.Certificate) string {
+	if len(cert.IPAddresses) == 0 {
+		return ""
+	}
+	ip := cert.IPAddresses[0]
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return strings.ToUpper(hex.EncodeToString(ip))
+}
+
+// certToName maps the client certificate of a TLS session to its tmSecurityName.
+//
+//	CA certificates only match when the chain was verified, against tls.Config.ClientCAs.
+//	returns ErrNoPermission if no entry maps the certificate.
+func (v *SecurityConfig) certToName(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return "", errors.WithMessage(ErrNoPermission, "no client certificate")
+	}
+	client := state.PeerCertificates[0]
+	certs := []*x509.Certificate{client}
+	for _, chain := range state.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	for id := range v.CertToNames {
+		entry := &v.CertToNames[id]
+		if !entry.matches(certs) {
+			continue
+		}
+		if name := entry.name(client); name != "" {
+			return name, nil
+		}
+	}
+	return "", errors.WithMessagef(ErrNoPermission, "no tmSecurityName for certificate %v (%v)",
+		client.Subject, TLSFingerprint(client))
+}
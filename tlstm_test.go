@@ -0,0 +1,174 @@
+package GoSNMPServer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testCert is a certificate generated for the tests, with its key
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert generates a certificate of template, signed by parent or self signed when parent is nil
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	template.KeyUsage |= x509.KeyUsageDigitalSignature
+	template.BasicConstraintsValid = true
+	if template.IsCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// verifiedState is the TLS session of client, its chain verified against roots
+func verifiedState(client *testCert, roots ...*testCert) *tls.ConnectionState {
+	pool := x509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root.cert)
+	}
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client.cert}}
+	if len(roots) != 0 {
+		verifyClientChain(state, pool)
+	}
+	return state
+}
+
+func TestTLSFingerprint(t *testing.T) {
+	cert := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "c"}}, nil)
+	digest := TLSFingerprint(cert.cert)
+	if !strings.HasPrefix(digest, "SHA256:") || len(digest) != len("SHA256:")+32*3-1 {
+		t.Fatalf("fingerprint %q", digest)
+	}
+	// other hashes and spellings of the same
+	sha512 := formatFingerprint(crypto.SHA512, fingerprint(crypto.SHA512, cert.cert))
+	for _, each := range []string{
+		digest,
+		strings.ToLower(digest),
+		"SHA-256:" + strings.ReplaceAll(digest[len("SHA256:"):], ":", ""),
+		sha512,
+	} {
+		entry := CertToNameEntry{Fingerprint: each, MapType: CertMapCommonName}
+		if err := entry.syncConfig(); err != nil {
+			t.Errorf("%q: %v", each, err)
+			continue
+		}
+		if !entry.matches([]*x509.Certificate{cert.cert}) {
+			t.Errorf("%q does not match", each)
+		}
+	}
+	for _, each := range []string{
+		"AB:CD",
+		"MD5:" + strings.Repeat("00:", 15) + "00",
+		"SHA256:" + strings.Repeat("00:", 20) + "00",
+		"SHA256:zz",
+	} {
+		entry := CertToNameEntry{Fingerprint: each, MapType: CertMapCommonName}
+		if err := entry.syncConfig(); err == nil {
+			t.Errorf("%q accepted", each)
+		}
+	}
+	entry := CertToNameEntry{Fingerprint: digest, MapType: CertMapSpecified}
+	if err := entry.syncConfig(); err == nil {
+		t.Error("specified map type without data accepted")
+	}
+}
+
+func TestCertToName(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true}, nil)
+	client := newTestCert(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "manager"},
+		EmailAddresses: []string{"Ops@Example.COM"},
+		DNSNames:       []string{"Mgr.Example.COM"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}, ca)
+	ipOnly := newTestCert(t, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("2001:db8::1")}}, ca)
+	for _, each := range []struct {
+		mapType CertMapType
+		cert    *testCert
+		name    string
+	}{
+		{CertMapSpecified, client, "monitoring"},
+		{CertMapSANRFC822Name, client, "Ops@example.com"},
+		{CertMapSANDNSName, client, "mgr.example.com"},
+		{CertMapSANIPAddress, client, "0A000001"},
+		{CertMapSANAny, client, "Ops@example.com"},
+		{CertMapSANAny, ipOnly, "20010DB8000000000000000000000001"},
+		{CertMapCommonName, client, "manager"},
+	} {
+		config := SecurityConfig{CertToNames: []CertToNameEntry{
+			{Fingerprint: TLSFingerprint(each.cert.cert), MapType: each.mapType, Data: "monitoring"},
+		}}
+		if err := config.CertToNames[0].syncConfig(); err != nil {
+			t.Fatal(err)
+		}
+		if name, err := config.certToName(verifiedState(each.cert)); err != nil || name != each.name {
+			t.Errorf("%v: %q %v, expected %q", each.mapType, name, err, each.name)
+		}
+	}
+
+	// entries yielding no name are skipped, CA fingerprints match verified chains only
+	config := SecurityConfig{CertToNames: []CertToNameEntry{
+		{Fingerprint: TLSFingerprint(ca.cert), MapType: CertMapSANRFC822Name},
+		{Fingerprint: TLSFingerprint(ca.cert), MapType: CertMapSANIPAddress},
+	}}
+	for id := range config.CertToNames {
+		if err := config.CertToNames[id].syncConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if name, err := config.certToName(verifiedState(ipOnly, ca)); err != nil || name != "20010DB8000000000000000000000001" {
+		t.Errorf("by CA: %q %v", name, err)
+	}
+	if name, err := config.certToName(verifiedState(ipOnly)); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("by CA, not verified: %q %v", name, err)
+	}
+	other := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, IsCA: true}, nil)
+	if name, err := config.certToName(verifiedState(ipOnly, other)); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("by CA, other root: %q %v", name, err)
+	}
+	if name, err := config.certToName(&tls.ConnectionState{}); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("without certificate: %q %v", name, err)
+	}
+}
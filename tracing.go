@@ -0,0 +1,196 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SpanAttribute is a key / value describing a span, e.g. snmp.oid
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr makes a SpanAttribute
+func Attr(key string, value interface{}) SpanAttribute {
+	return SpanAttribute{Key: key, Value: value}
+}
+
+// Span is a timed operation of request handling.
+type Span interface {
+	SetAttributes(attrs ...SpanAttribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans around request handling. Adapt it to OpenTelemetry or another tracing system.
+//
+//	Spans started:
+//	  snmp.request   ResponseForBuffer
+//	  snmp.decode    each decode pass (snmp.decode.pass 1, and 2 with the user keys for SNMPv3)
+//	  snmp.usm       SNMPv3 key localization, digest and time window checks
+//	  snmp.access    access policy checks
+//	  snmp.serve     SubAgent serving the pdu
+//	  snmp.callback  each OnGet / OnSet / OnTrap / BatchValueProvider call, with snmp.oid and snmp.error_status
+//	  snmp.marshal   encoding the response
+//
+//	Start returns ctx carrying the span, children are started from it.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...SpanAttribute) {}
+func (noopSpan) RecordError(err error)                {}
+func (noopSpan) End()                                 {}
+
+// startSpan starts a span of tracer. nil tracer starts nothing.
+func startSpan(ctx context.Context, tracer Tracer, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, name, attrs...)
+}
+
+// scopedSpan restores the context of the scope once ended
+type scopedSpan struct {
+	Span
+	scope *requestScope
+	prev  context.Context
+}
+
+func (s *scopedSpan) End() {
+	s.scope.ctx = s.prev
+	s.Span.End()
+}
+
+// span starts a child span of the request. Spans started until it ends are its children.
+func (s *requestScope) span(name string, attrs ...SpanAttribute) Span {
+	if s == nil || s.tracer == nil {
+		return noopSpan{}
+	}
+	ctx, span := startSpan(s.ctx, s.tracer, name, attrs...)
+	scoped := &scopedSpan{Span: span, scope: s, prev: s.ctx}
+	s.ctx = ctx
+	return scoped
+}
+
+// callbackSpan is the span of one user callback on item
+type callbackSpan struct {
+	Span
+}
+
+func (t *SubAgent) callbackSpan(scope *requestScope, callback string, item *PDUValueControlItem) callbackSpan {
+	return callbackSpan{scope.span("snmp.callback", Attr("snmp.callback", callback), Attr("snmp.oid", item.OID))}
+}
+
+// end ends the span with the error-status of the varbind
+func (s callbackSpan) end(errret gosnmp.SNMPError) {
+	s.SetAttributes(Attr("snmp.error_status", errret.String()))
+	s.End()
+}
+
+// RecordedSpan is a span ended, as recorded by InMemoryTracer
+type RecordedSpan struct {
+	Name       string
+	ID         uint64
+	ParentID   uint64 // 0 for a root span
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Errors     []error
+}
+
+// InMemoryTracer records spans in memory, for tests and debugging.
+type InMemoryTracer struct {
+	mu     sync.Mutex
+	lastID uint64
+	spans  []RecordedSpan
+}
+
+type inMemorySpanKey struct{}
+
+type inMemorySpan struct {
+	tracer *InMemoryTracer
+	mu     sync.Mutex
+	record RecordedSpan
+	ended  bool
+}
+
+// Start starts a span, child of the span in ctx if any
+func (t *InMemoryTracer) Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	t.mu.Lock()
+	t.lastID++
+	id := t.lastID
+	t.mu.Unlock()
+	span := &inMemorySpan{tracer: t, record: RecordedSpan{
+		Name:       name,
+		ID:         id,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}}
+	if parent, ok := ctx.Value(inMemorySpanKey{}).(*inMemorySpan); ok {
+		span.record.ParentID = parent.record.ID
+	}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, inMemorySpanKey{}, span), span
+}
+
+// Spans returns the spans ended, in the order they ended
+func (t *InMemoryTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+// Reset drops the spans recorded
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+func (s *inMemorySpan) SetAttributes(attrs ...SpanAttribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, each := range attrs {
+		s.record.Attributes[each.Key] = each.Value
+	}
+}
+
+func (s *inMemorySpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record.Errors = append(s.record.Errors, err)
+}
+
+func (s *inMemorySpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.record.End = time.Now()
+	record := s.record
+	record.Attributes = make(map[string]interface{}, len(s.record.Attributes))
+	for key, value := range s.record.Attributes {
+		record.Attributes[key] = value
+	}
+	record.Errors = append([]error(nil), s.record.Errors...)
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, record)
+}
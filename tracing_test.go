@@ -0,0 +1,130 @@
+package GoSNMPServer
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// spansNamed returns the spans of tracer named name, in the order they ended
+func spansNamed(tracer *InMemoryTracer, name string) []RecordedSpan {
+	var ret []RecordedSpan
+	for _, span := range tracer.Spans() {
+		if span.Name == name {
+			ret = append(ret, span)
+		}
+	}
+	return ret
+}
+
+func TestTracerRequestSpans(t *testing.T) {
+	tracer := new(InMemoryTracer)
+	items := stringOIDs("1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.77.1")
+	items[1].OnGet = func() (interface{}, error) { panic("boom") }
+	master := MasterAgent{
+		AllowedVersion: SNMPV2c,
+		Tracer:         tracer,
+		SubAgents:      []*SubAgent{{OIDs: items, UserErrorMarkPacket: true}},
+	}
+	_, port := serveUDP(t, master)
+	if _, err := communityClient(t, port, gosnmp.Version2c, "public").Get([]string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.77.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := spansNamed(tracer, "snmp.request")
+	if len(requests) != 1 {
+		t.Fatalf("%d request spans", len(requests))
+	}
+	request := requests[0]
+	if request.ParentID != 0 || request.End.Before(request.Start) {
+		t.Errorf("request span %+v", request)
+	}
+	for key, expected := range map[string]interface{}{
+		"snmp.version":  "2c",
+		"snmp.pdu_type": "GetRequest",
+	} {
+		if request.Attributes[key] != expected {
+			t.Errorf("request %s = %v, expected %v", key, request.Attributes[key], expected)
+		}
+	}
+	if request.Attributes["net.peer"] == nil || request.Attributes["snmp.request_bytes"] == nil {
+		t.Errorf("request attributes %v", request.Attributes)
+	}
+
+	parents := map[string]uint64{"snmp.decode": request.ID, "snmp.access": request.ID, "snmp.serve": request.ID, "snmp.marshal": request.ID}
+	for name, parent := range parents {
+		spans := spansNamed(tracer, name)
+		if len(spans) != 1 || spans[0].ParentID != parent {
+			t.Errorf("%s spans %+v, expected one child of %d", name, spans, parent)
+		}
+	}
+	serve := spansNamed(tracer, "snmp.serve")[0]
+	if serve.Attributes["snmp.varbinds"] != 2 || serve.Attributes["snmp.error_status"] != gosnmp.GenErr.String() {
+		t.Errorf("serve attributes %v", serve.Attributes)
+	}
+
+	callbacks := spansNamed(tracer, "snmp.callback")
+	if len(callbacks) != 2 {
+		t.Fatalf("%d callback spans", len(callbacks))
+	}
+	for id, callback := range callbacks {
+		if callback.ParentID != serve.ID || callback.Attributes["snmp.callback"] != "OnGet" || callback.Attributes["snmp.oid"] != items[id].OID {
+			t.Errorf("callback span %+v", callback)
+		}
+	}
+	if callbacks[0].Attributes["snmp.error_status"] != gosnmp.NoError.String() || len(callbacks[0].Errors) != 0 {
+		t.Errorf("callback of %s: %v %v", items[0].OID, callbacks[0].Attributes, callbacks[0].Errors)
+	}
+	if callbacks[1].Attributes["snmp.error_status"] != gosnmp.GenErr.String() || len(callbacks[1].Errors) != 1 {
+		t.Errorf("callback of the panic: %v %v", callbacks[1].Attributes, callbacks[1].Errors)
+	}
+}
+
+func TestTracerUSMSpans(t *testing.T) {
+	tracer := new(InMemoryTracer)
+	user := usmTestUser{gosnmp.SHA, gosnmp.AES}
+	master := usmTestMaster(user)
+	master.Tracer = tracer
+	_, port := serveUDP(t, master)
+	client := usmTestClient(t, port, user, nil)
+	// engine discovery first
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	tracer.Reset()
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	usm := spansNamed(tracer, "snmp.usm")
+	if len(usm) != 1 {
+		t.Fatalf("%d usm spans", len(usm))
+	}
+	for key, expected := range map[string]interface{}{
+		"snmp.usm.user":           user.name(),
+		"snmp.usm.flags":          int(gosnmp.AuthPriv | gosnmp.Reportable),
+		"snmp.usm.authentic":      true,
+		"snmp.usm.in_time_window": true,
+	} {
+		if usm[0].Attributes[key] != expected {
+			t.Errorf("usm %s = %v, expected %v", key, usm[0].Attributes[key], expected)
+		}
+	}
+	decodes := spansNamed(tracer, "snmp.decode")
+	if len(decodes) != 2 || decodes[0].Attributes["snmp.decode.pass"] != 1 || decodes[1].Attributes["snmp.decode.pass"] != 2 {
+		t.Fatalf("decode spans %+v", decodes)
+	}
+	// the first pass cannot decrypt, its error is not recorded for SNMPv3
+	if len(decodes[0].Errors) != 0 || len(decodes[1].Errors) != 0 {
+		t.Errorf("decode errors %v %v", decodes[0].Errors, decodes[1].Errors)
+	}
+	request := spansNamed(tracer, "snmp.request")
+	if len(request) != 1 || request[0].Attributes["snmp.version"] != "3" || len(request[0].Errors) != 0 {
+		t.Errorf("request spans %+v", request)
+	}
+	for _, span := range append(usm, decodes...) {
+		if span.ParentID != request[0].ID {
+			t.Errorf("%s not a child of the request", span.Name)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package GoSNMPServer
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync/atomic"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// tsmSecurityModel is the msgSecurityModel of the Transport Security Model (RFC5591)
+const tsmSecurityModel gosnmp.SnmpV3SecurityModel = 4
+
+// tsmPrefixTLS and tsmPrefixDTLS are the prefixes of tmSecurityNames learnt over TLS and DTLS, with
+// SecurityConfig.TSMUsePrefix. See RFC6353
+const (
+	tsmPrefixTLS  = "tls:"
+	tsmPrefixDTLS = "dtls:"
+)
+
+// tsmStats counts SNMPv3 messages refused by the Transport Security Model (snmpTsmStats)
+// and TLS sessions refused by the TLS Transport Model (snmpTlstmSessionStats).
+type tsmStats struct {
+	invalidCaches             atomic.Uint32
+	invalidClientCertificates atomic.Uint32
+}
+
+// tsmMessage is a SNMPv3 message of the Transport Security Model, its scopedPDU in plain text.
+type tsmMessage struct {
+	msgID           uint32
+	msgMaxSize      uint32
+	msgFlags        gosnmp.SnmpV3MsgFlags
+	contextEngineID string
+	contextName     string
+	pdu             []byte // BER encoded PDU
+}
+
+// berNext splits the first BER value of b from the rest
+func berNext(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("truncated BER value")
+	}
+	tag = b[0]
+	length, offset := int(b[1]), 2
+	if b[1]&0x80 != 0 {
+		octets := int(b[1] & 0x7f)
+		if octets == 0 || octets > 4 || len(b) < 2+octets {
+			return 0, nil, nil, errors.Errorf("BER length of %d octets", octets)
+		}
+		length = 0
+		for _, each := range b[2 : 2+octets] {
+			length = length<<8 | int(each)
+		}
+		offset += octets
+	}
+	if length < 0 || len(b)-offset < length {
+		return 0, nil, nil, errors.New("truncated BER value")
+	}
+	return tag, b[offset : offset+length], b[offset+length:], nil
+}
+
+// berExpect splits the first BER value of b, which shall be of tag
+func berExpect(b []byte, tag byte, what string) (content, rest []byte, err error) {
+	got, content, rest, err := berNext(b)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, what)
+	}
+	if got != tag {
+		return nil, nil, errors.Errorf("%v: tag %#x, expected %#x", what, got, tag)
+	}
+	return content, rest, nil
+}
+
+// berUint32 decodes an INTEGER of 0..2^32-1
+func berUint32(content []byte, what string) (uint32, error) {
+	if len(content) == 0 || len(content) > 5 || content[0]&0x80 != 0 || (len(content) == 5 && content[0] != 0) {
+		return 0, errors.Errorf("%v: INTEGER out of range", what)
+	}
+	var ret uint32
+	for _, each := range content {
+		ret = ret<<8 | uint32(each)
+	}
+	return ret, nil
+}
+
+// berAppend appends a BER value of tag and content to dst
+func berAppend(dst []byte, tag byte, content []byte) []byte {
+	dst = append(dst, tag)
+	if n := len(content); n < 0x80 {
+		dst = append(dst, byte(n))
+	} else {
+		size := berLengthSize(n) - 1
+		dst = append(dst, 0x80|byte(size))
+		for i := size - 1; i >= 0; i-- {
+			dst = append(dst, byte(n>>(8*i)))
+		}
+	}
+	return append(dst, content...)
+}
+
+// berAppendUint32 appends an INTEGER of v to dst
+func berAppendUint32(dst []byte, v uint32) []byte {
+	content := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	for len(content) > 1 && content[0] == 0 && content[1]&0x80 == 0 {
+		content = content[1:]
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return berAppend(dst, byte(gosnmp.Integer), content)
+}
+
+// parseTSMMessage parses a SNMPv3 message of the Transport Security Model. See RFC3412 section 6
+func parseTSMMessage(b []byte) (*tsmMessage, error) {
+	message, _, err := berExpect(b, byte(gosnmp.Sequence), "message")
+	if err != nil {
+		return nil, err
+	}
+	content, message, err := berExpect(message, byte(gosnmp.Integer), "msgVersion")
+	if err != nil {
+		return nil, err
+	}
+	if version, err := berUint32(content, "msgVersion"); err != nil || version != 3 {
+		return nil, errors.New("msgVersion is not SNMPv3")
+	}
+	global, message, err := berExpect(message, byte(gosnmp.Sequence), "msgGlobalData")
+	if err != nil {
+		return nil, err
+	}
+	ret := new(tsmMessage)
+	if content, global, err = berExpect(global, byte(gosnmp.Integer), "msgID"); err != nil {
+		return nil, err
+	}
+	if ret.msgID, err = berUint32(content, "msgID"); err != nil {
+		return nil, err
+	}
+	if content, global, err = berExpect(global, byte(gosnmp.Integer), "msgMaxSize"); err != nil {
+		return nil, err
+	}
+	if ret.msgMaxSize, err = berUint32(content, "msgMaxSize"); err != nil {
+		return nil, err
+	}
+	if content, global, err = berExpect(global, byte(gosnmp.OctetString), "msgFlags"); err != nil {
+		return nil, err
+	}
+	if len(content) != 1 {
+		return nil, errors.Errorf("msgFlags of %d octets", len(content))
+	}
+	ret.msgFlags = gosnmp.SnmpV3MsgFlags(content[0])
+	if content, _, err = berExpect(global, byte(gosnmp.Integer), "msgSecurityModel"); err != nil {
+		return nil, err
+	}
+	if model, err := berUint32(content, "msgSecurityModel"); err != nil || model != uint32(tsmSecurityModel) {
+		return nil, errors.New("msgSecurityModel is not the Transport Security Model")
+	}
+	// msgSecurityParameters is empty for the Transport Security Model
+	if _, message, err = berExpect(message, byte(gosnmp.OctetString), "msgSecurityParameters"); err != nil {
+		return nil, err
+	}
+	// the scopedPDU is never encrypted by the security model, the transport protects it
+	scoped, _, err := berExpect(message, byte(gosnmp.Sequence), "scopedPDU")
+	if err != nil {
+		return nil, err
+	}
+	if content, scoped, err = berExpect(scoped, byte(gosnmp.OctetString), "contextEngineID"); err != nil {
+		return nil, err
+	}
+	ret.contextEngineID = string(content)
+	if content, scoped, err = berExpect(scoped, byte(gosnmp.OctetString), "contextName"); err != nil {
+		return nil, err
+	}
+	ret.contextName = string(content)
+	_, _, rest, err := berNext(scoped)
+	if err != nil {
+		return nil, errors.WithMessage(err, "PDU")
+	}
+	ret.pdu = scoped[:len(scoped)-len(rest)]
+	return ret, nil
+}
+
+// decodeTSMRequest decodes the PDU of msg, through gosnmp as the PDU of a SNMPv2c message
+func (t *MasterAgent) decodeTSMRequest(msg *tsmMessage) (*gosnmp.SnmpPacket, error) {
+	var v2c []byte
+	v2c = berAppendUint32(v2c, uint32(gosnmp.Version2c))
+	v2c = berAppend(v2c, byte(gosnmp.OctetString), nil)
+	v2c = append(v2c, msg.pdu...)
+	vhandle := gosnmp.GoSNMP{Logger: newGosnmpLogger(t.priv.logger)}
+	request, err := vhandle.SnmpDecodePacket(berAppend(nil, byte(gosnmp.Sequence), v2c))
+	if err != nil {
+		return nil, err
+	}
+	request.Version = gosnmp.Version3
+	request.Community = ""
+	request.MsgID = msg.msgID
+	request.MsgMaxSize = msg.msgMaxSize
+	request.MsgFlags = msg.msgFlags
+	request.SecurityModel = tsmSecurityModel
+	request.ContextEngineID = msg.contextEngineID
+	request.ContextName = msg.contextName
+	return request, nil
+}
+
+// marshalTSM marshals a SNMPv3 message of the Transport Security Model, its PDU encoded by gosnmp
+func marshalTSM(pkt *gosnmp.SnmpPacket) ([]byte, error) {
+	v2c := copySnmpPacket(pkt)
+	v2c.Version = gosnmp.Version2c
+	v2c.Community = ""
+	v2c.SecurityParameters = nil
+	out, err := v2c.MarshalMsg()
+	if err != nil {
+		return nil, err
+	}
+	message, _, err := berExpect(out, byte(gosnmp.Sequence), "message")
+	if err != nil {
+		return nil, err
+	}
+	// skip version and community
+	for i := 0; i < 2; i++ {
+		if _, _, message, err = berNext(message); err != nil {
+			return nil, err
+		}
+	}
+
+	var global []byte
+	global = berAppendUint32(global, pkt.MsgID)
+	global = berAppendUint32(global, pkt.MsgMaxSize)
+	global = berAppend(global, byte(gosnmp.OctetString), []byte{byte(pkt.MsgFlags)})
+	global = berAppendUint32(global, uint32(tsmSecurityModel))
+
+	var scoped []byte
+	scoped = berAppend(scoped, byte(gosnmp.OctetString), []byte(pkt.ContextEngineID))
+	scoped = berAppend(scoped, byte(gosnmp.OctetString), []byte(pkt.ContextName))
+	scoped = append(scoped, message...)
+
+	var ret []byte
+	ret = berAppendUint32(ret, uint32(gosnmp.Version3))
+	ret = berAppend(ret, byte(gosnmp.Sequence), global)
+	ret = berAppend(ret, byte(gosnmp.OctetString), nil)
+	ret = berAppend(ret, byte(gosnmp.Sequence), scoped)
+	return berAppend(nil, byte(gosnmp.Sequence), ret), nil
+}
+
+// marshalMessage marshals pkt, through gosnmp unless it is of the Transport Security Model
+func marshalMessage(pkt *gosnmp.SnmpPacket) ([]byte, error) {
+	if pkt.Version == gosnmp.Version3 && pkt.SecurityModel == tsmSecurityModel {
+		return marshalTSM(pkt)
+	}
+	return pkt.MarshalMsg()
+}
+
+// tsmPrefix returns the prefix of the tmSecurityNames of the managers like info: DTLS ones are over UDP
+func tsmPrefix(info *RequestInfo) string {
+	if _, ok := info.Peer.(*net.UDPAddr); ok {
+		return tsmPrefixDTLS
+	}
+	return tsmPrefixTLS
+}
+
+// responseForTSM serves a SNMPv3 message of the Transport Security Model (RFC5591), its security
+// name being the tmSecurityName the TLS session maps to. It returns the request decoded.
+//
+//	Messages without TLS session are dropped (snmpTsmInvalidCaches). Sessions whose certificate
+//	maps to no tmSecurityName get ErrNoPermission, which closes them.
+func (t *MasterAgent) responseForTSM(ctx context.Context, i []byte, info *RequestInfo, logger *slog.Logger) (*gosnmp.SnmpPacket, []byte, error) {
+	msg, err := parseTSMMessage(i)
+	if err != nil {
+		if t.Metrics != nil {
+			t.Metrics.inASNParseErrs.Add(1)
+		}
+		return nil, nil, errors.WithMessagef(ErrUnsupportedPacketData, "TSM message: %v", err)
+	}
+	_, decodeSpan := startSpan(ctx, t.Tracer, "snmp.decode", Attr("snmp.decode.pass", 2))
+	request, err := t.decodeTSMRequest(msg)
+	decodeSpan.RecordError(err)
+	decodeSpan.End()
+	if err != nil {
+		if t.Metrics != nil {
+			t.Metrics.inASNParseErrs.Add(1)
+		}
+		return nil, nil, errors.WithMessagef(ErrUnsupportedPacketData, "GoSNMP Returns %v", err)
+	}
+
+	if info == nil || info.TLS == nil {
+		// only TLS sessions tell a tmSecurityName
+		t.priv.tsmStats.invalidCaches.Add(1)
+		logger.Debug("tsm message without secure transport")
+		return request, nil, errors.WithMessage(ErrNoPermission, "Transport Security Model without TLS")
+	}
+	securityName, err := t.SecurityConfig.certToName(info.TLS)
+	if err != nil {
+		t.priv.tsmStats.invalidClientCertificates.Add(1)
+		logger.Debug("tls client certificate refused", "err", err)
+		return request, nil, err
+	}
+	if t.SecurityConfig.TSMUsePrefix {
+		securityName = tsmPrefix(info) + securityName
+	}
+	logger = logger.With("security_name", securityName)
+	if !t.priv.rateLimiters.allowUser(securityName) {
+		logger.Debug("security name over rate limit")
+		out, err := t.dropRequest("user")
+		return request, out, err
+	}
+
+	if oid, counter := t.checkContext(request); counter != nil {
+		logger.Debug("context refused", "context", request.ContextName, "report", oid)
+		out, err := t.tsmReport(request, oid, counter)
+		return request, out, err
+	}
+
+	scope := t.scopeForUser(request, securityName)
+	scope.logger = withPDU(logger, request)
+	scope.ctx, scope.tracer, scope.info, scope.audit = ctx, t.Tracer, info, t.AuditSink
+	scope.requestBytes = len(i)
+	val, err := t.responseForPkt(request, scope)
+	if val == nil {
+		// unconfirmed requests, as traps, and PDUs not served are not answered
+		return request, nil, err
+	}
+	val.SecurityModel = tsmSecurityModel
+	val.SecurityParameters = nil
+	val.MsgFlags &^= gosnmp.Reportable
+	val.MsgMaxSize = uint32(t.MaxMessageSize)
+	out, err := t.marshalResponse(request, val, err, scope)
+	return request, out, err
+}
+
+// tsmReport builds a REPORT pdu for request carrying a single counter, at the security level
+// of the request, as the session is authenticated. Unreportable requests are dropped.
+func (t *MasterAgent) tsmReport(request *gosnmp.SnmpPacket, oid string, counter *atomic.Uint32) ([]byte, error) {
+	value := counter.Add(1)
+	if request.MsgFlags&gosnmp.Reportable == 0 {
+		return nil, errors.WithMessagef(ErrNoSNMPInstance, "unreportable %v", oid)
+	}
+	ret := copySnmpPacket(request)
+	ret.PDUType = gosnmp.Report
+	ret.MsgFlags &^= gosnmp.Reportable
+	ret.MsgMaxSize = uint32(t.MaxMessageSize)
+	ret.ContextEngineID = string(t.SecurityConfig.AuthoritativeEngineID.Marshal())
+	ret.Error = gosnmp.NoError
+	ret.ErrorIndex = 0
+	ret.NonRepeaters = 0
+	ret.MaxRepetitions = 0
+	ret.Variables = []gosnmp.SnmpPDU{{
+		Name:  oid,
+		Type:  gosnmp.Counter32,
+		Value: value,
+	}}
+	t.priv.logger.Debug("tsm report", "oid", oid, "value", value)
+	return marshalTSM(&ret)
+}
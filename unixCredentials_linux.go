@@ -0,0 +1,58 @@
+//go:build linux
+
+package GoSNMPServer
+
+import (
+	"net"
+	"syscall"
+)
+
+// unixCredentialsSpace is the out-of-band room for the SCM_CREDENTIALS of a datagram
+var unixCredentialsSpace = syscall.CmsgSpace(syscall.SizeofUcred)
+
+// enablePassCred asks the kernel for the SCM_CREDENTIALS of each datagram received on conn
+func enablePassCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// unixPeerCredentials returns the SO_PEERCRED of a stream connection, nil if unknown
+func unixPeerCredentials(conn *net.UnixConn) *PeerCredentials {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var ucred *syscall.Ucred
+	if err := raw.Control(func(fd uintptr) {
+		ucred, _ = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || ucred == nil {
+		return nil
+	}
+	return &PeerCredentials{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}
+}
+
+// parseUnixCredentials returns the SCM_CREDENTIALS of the out-of-band data of a datagram, nil if none
+func parseUnixCredentials(oob []byte) *PeerCredentials {
+	if len(oob) == 0 {
+		return nil
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for i := range messages {
+		if ucred, err := syscall.ParseUnixCredentials(&messages[i]); err == nil {
+			return &PeerCredentials{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package GoSNMPServer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// unixCredentialsMaster answers community "me" to the current user only, "other" to another one
+func unixCredentialsMaster(audit AuditSink) MasterAgent {
+	uid := uint32(os.Getuid())
+	master := unixTestMaster()
+	master.AuditSink = audit
+	master.SecurityConfig.CommunityACLs = []CommunityACL{
+		{Community: "me", UIDs: []uint32{uid}, ReadWrite: true},
+		{Community: "other", UIDs: []uint32{uid + 1}},
+	}
+	return master
+}
+
+func TestUnixgramCredentials(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snmp.sock")
+	unixServe(t, unixCredentialsMaster(nil), "unixgram", path, 0)
+	if response := unixgramExchange(t, dir, path, unixGetMessage(t, "me")); response == nil {
+		t.Error("community of the user not answered")
+	}
+	if response := unixgramExchange(t, dir, path, unixGetMessage(t, "other")); response != nil {
+		t.Error("community of another user answered")
+	}
+}
+
+func TestUnixStreamCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snmp.sock")
+	audit := new(InMemoryAuditSink)
+	unixServe(t, unixCredentialsMaster(audit), "unix", path, 0)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(unixGetMessage(t, "me")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBERMessage(bufio.NewReader(conn), DefaultMaxMessageSize); err != nil {
+		t.Fatalf("community of the user: %v", err)
+	}
+
+	// refused communities close the connection
+	if _, err := conn.Write(unixGetMessage(t, "other")); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("community of another user answered %d octets", count)
+	}
+}
+
+func TestUnixAuditPeerUID(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snmp.sock")
+	audit := new(InMemoryAuditSink)
+	unixServe(t, unixCredentialsMaster(audit), "unixgram", path, 0)
+	request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "me", PDUType: gosnmp.SetRequest, RequestID: 7,
+		Variables: []gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "set"}}}
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := unixgramExchange(t, dir, path, raw); response == nil {
+		t.Fatal("set not answered")
+	}
+	records := audit.Records()
+	if len(records) != 1 || records[0].PeerUID == nil || *records[0].PeerUID != uint32(os.Getuid()) {
+		t.Errorf("audit records %+v", records)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package GoSNMPServer
+
+import "net"
+
+// unixCredentialsSpace is the out-of-band room for credentials, not received on this platform
+var unixCredentialsSpace = 0
+
+func enablePassCred(conn *net.UnixConn) error {
+	return nil
+}
+
+// unixPeerCredentials returns nil: peer credentials are only known on Linux
+func unixPeerCredentials(conn *net.UnixConn) *PeerCredentials {
+	return nil
+}
+
+func parseUnixCredentials(oob []byte) *PeerCredentials {
+	return nil
+}
@@ -0,0 +1,155 @@
+package GoSNMPServer
+
+import (
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// NewUnixListener listens on the Unix socket path, for local management tools:
+//
+//	network "unixgram" receives datagrams, as UDP does. Managers shall bind an address to get responses.
+//	network "unix" accepts streams, messages being sent one after another (RFC3430).
+//
+// The socket file gets the permissions perm, unless 0. A stale socket file at path is removed. The
+// replyer tells the credentials of the manager (SO_PEERCRED) on Linux.
+func NewUnixListener(network, path string, perm os.FileMode) (ISnmpServerListener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "Remove stale socket")
+		}
+	}
+	addr := &net.UnixAddr{Name: path, Net: network}
+	var ret ISnmpServerListener
+	switch network {
+	case "unixgram":
+		conn, err := net.ListenUnixgram(network, addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unix Listen Error")
+		}
+		if err := enablePassCred(conn); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "SO_PASSCRED")
+		}
+		ret = &UnixgramListener{
+			conn:   conn,
+			path:   path,
+			logger: NewDiscardLogger(),
+			buffer: make([]byte, DefaultMaxMessageSize),
+			oob:    make([]byte, unixCredentialsSpace),
+		}
+	case "unix":
+		listener, err := net.ListenUnix(network, addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unix Listen Error")
+		}
+		ret = newStreamListener(listener, func(conn net.Conn) (*StreamReplyer, error) {
+			return &StreamReplyer{conn: conn, credentials: unixPeerCredentials(conn.(*net.UnixConn))}, nil
+		})
+	default:
+		return nil, errors.Errorf("unsupported unix network %q", network)
+	}
+	if perm != 0 && !isAbstractUnix(path) {
+		if err := os.Chmod(path, perm); err != nil {
+			ret.Shutdown()
+			return nil, errors.Wrap(err, "Chmod socket")
+		}
+	}
+	return ret, nil
+}
+
+// UnixgramListener receives SNMP messages as Unix datagrams
+type UnixgramListener struct {
+	mu     sync.Mutex
+	conn   *net.UnixConn
+	path   string
+	logger *slog.Logger
+	buffer []byte
+	oob    []byte
+}
+
+func (l *UnixgramListener) SetupLogger(i *log.Logger) {
+	l.logger = loggerFromLog(i)
+}
+
+func (l *UnixgramListener) SetupStructuredLogger(i *slog.Logger) {
+	l.logger = i
+}
+
+// SetBufferSize sets the size of the receive buffer, the largest datagram accepted.
+func (l *UnixgramListener) SetBufferSize(size int) {
+	l.buffer = make([]byte, size)
+}
+
+func (l *UnixgramListener) Address() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unixgram"}
+}
+
+func (l *UnixgramListener) NextSnmp() ([]byte, IReplyer, error) {
+	l.mu.Lock()
+	conn := l.conn
+	l.mu.Unlock()
+	if conn == nil {
+		return nil, nil, errors.New("Connection Not Listen")
+	}
+	counts, oobn, _, addr, err := conn.ReadMsgUnix(l.buffer, l.oob)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unix Read Error")
+	}
+	replyer := &UnixgramReplyer{conn: conn, target: addr, credentials: parseUnixCredentials(l.oob[:oobn])}
+	l.logger.Debug("unix request", "peer", replyer.RemoteAddr(), "size", counts)
+	msg := make([]byte, counts)
+	copy(msg, l.buffer[:counts])
+	return msg, replyer, nil
+}
+
+func (l *UnixgramListener) Shutdown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+		if !isAbstractUnix(l.path) {
+			os.Remove(l.path)
+		}
+	}
+}
+
+// UnixgramReplyer replies to the manager of a Unix datagram
+type UnixgramReplyer struct {
+	conn        *net.UnixConn
+	target      *net.UnixAddr
+	credentials *PeerCredentials
+}
+
+func (r *UnixgramReplyer) ReplyPDU(i []byte) error {
+	if r.target == nil || r.target.Name == "" {
+		return errors.New("unix datagram from an unbound socket could not be replied")
+	}
+	if _, err := r.conn.WriteToUnix(i, r.target); err != nil {
+		return errors.Wrap(err, "WriteToUnix")
+	}
+	return nil
+}
+
+func (r *UnixgramReplyer) RemoteAddr() net.Addr {
+	if r.target == nil {
+		return nil
+	}
+	return r.target
+}
+
+func (r *UnixgramReplyer) PeerCredentials() *PeerCredentials {
+	return r.credentials
+}
+
+func (r *UnixgramReplyer) Shutdown() {}
+
+// isAbstractUnix reports if path names a socket of the Linux abstract namespace, without file
+func isAbstractUnix(path string) bool {
+	return len(path) > 0 && path[0] == '@'
+}
@@ -0,0 +1,170 @@
+package GoSNMPServer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// unixGetMessage returns a SNMPv2c Get of 1.3.6.1.2.1.1.1.0 using community
+func unixGetMessage(t *testing.T, community string) []byte {
+	t.Helper()
+	request := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: community, PDUType: gosnmp.GetRequest,
+		RequestID: 7, Variables: []gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.Null}}}
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// unixServe serves master on the Unix sockets of network at path, until the test ends
+func unixServe(t *testing.T, master MasterAgent, network, path string, perm os.FileMode) *SNMPServer {
+	t.Helper()
+	server := NewSNMPServer(master)
+	if err := server.ListenUnix(network, path, perm); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeForever()
+	}()
+	t.Cleanup(func() {
+		server.Shutdown()
+		<-done
+	})
+	return server
+}
+
+// unixgramExchange sends request from a socket bound in dir, returning the response or nil without one
+func unixgramExchange(t *testing.T, dir, path string, request []byte) []byte {
+	t.Helper()
+	local := &net.UnixAddr{Name: filepath.Join(dir, "client.sock"), Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", local, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(local.Name)
+	defer conn.Close()
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	buffer := make([]byte, DefaultMaxMessageSize)
+	count, err := conn.Read(buffer)
+	if err != nil {
+		return nil
+	}
+	return buffer[:count]
+}
+
+func unixTestMaster() MasterAgent {
+	return MasterAgent{AllowedVersion: SNMPV2c, SubAgents: []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}}}
+}
+
+func TestUnixgramListener(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snmp.sock")
+	server := unixServe(t, unixTestMaster(), "unixgram", path, 0660)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0660 {
+		t.Errorf("socket file mode %v", info.Mode())
+	}
+	if response := unixgramExchange(t, dir, path, unixGetMessage(t, "public")); response == nil {
+		t.Fatal("no response")
+	}
+
+	// an unbound manager could not be answered
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(unixGetMessage(t, "public")); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); server.ListenerStats()[0].ReplyErrors == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v", server.ListenerStats())
+		}
+	}
+
+	server.Shutdown()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file kept after Shutdown: %v", err)
+	}
+}
+
+func TestUnixStreamListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snmp.sock")
+	unixServe(t, unixTestMaster(), "unix", path, 0600)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	message := unixGetMessage(t, "public")
+	// two messages in one write, then one in two writes
+	if _, err := conn.Write(append(append([]byte(nil), message...), message...)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(message[:5])
+	time.Sleep(20 * time.Millisecond)
+	conn.Write(message[5:])
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	for id := 0; id < 3; id++ {
+		raw, err := readBERMessage(reader, DefaultMaxMessageSize)
+		if err != nil {
+			t.Fatalf("response %d: %v", id, err)
+		}
+		decoder := gosnmp.GoSNMP{Version: gosnmp.Version2c, Logger: gosnmp.NewLogger(nil)}
+		response, err := decoder.SnmpDecodePacket(raw)
+		if err != nil || response.Error != gosnmp.NoError || len(response.Variables) != 1 {
+			t.Fatalf("response %d: %v %v", id, response, err)
+		}
+	}
+}
+
+func TestUnixListenerPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snmp.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if listener, err := NewUnixListener("unixgram", path, 0); err == nil {
+		listener.Shutdown()
+		t.Fatal("listening over a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("regular file removed: %v", err)
+	}
+	os.Remove(path)
+
+	// a socket file left by a process which died
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	listener, err := NewUnixListener("unix", path, 0)
+	if err != nil {
+		t.Fatalf("stale socket file: %v", err)
+	}
+	listener.Shutdown()
+
+	if _, err := NewUnixListener("unixpacket", path, 0); err == nil {
+		t.Error("unixpacket listened")
+	}
+}
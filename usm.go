@@ -1,9 +1,38 @@
 package GoSNMPServer
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"sync/atomic"
+
 	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// usmTimeWindow is the number of seconds a message may drift from the local
+// engine time before it is rejected. See RFC3414 section 3.2 step 7.
+const usmTimeWindow = 150
+
+// usmStatsUnsupportedSecLevels and friends are the SNMP-USER-BASED-SM-MIB
+// usmStats counters carried back in REPORT pdus.
+const (
+	oidUsmStatsUnsupportedSecLevels = "1.3.6.1.6.3.15.1.1.1.0"
+	oidUsmStatsNotInTimeWindows     = "1.3.6.1.6.3.15.1.1.2.0"
+	oidUsmStatsUnknownUserNames     = "1.3.6.1.6.3.15.1.1.3.0"
+	oidUsmStatsUnknownEngineIDs     = "1.3.6.1.6.3.15.1.1.4.0"
+	oidUsmStatsWrongDigests         = "1.3.6.1.6.3.15.1.1.5.0"
+	oidUsmStatsDecryptionErrors     = "1.3.6.1.6.3.15.1.1.6.0"
 )
 
+type usmStats struct {
+	unsupportedSecLevels atomic.Uint32
+	notInTimeWindows     atomic.Uint32
+	unknownUserNames     atomic.Uint32
+	unknownEngineIDs     atomic.Uint32
+	wrongDigests         atomic.Uint32
+	decryptionErrors     atomic.Uint32
+}
+
 func GenKeys(sp *gosnmp.UsmSecurityParameters) {
 	err := sp.InitSecurityKeys()
 	if err != nil {
@@ -21,3 +50,183 @@ func GenSalt(sp *gosnmp.UsmSecurityParameters) {
 		panic(err)
 	}
 }
+
+// usmAuthParamLength returns the length of msgAuthenticationParameters for a
+// protocol: 12 octets for HMAC-MD5-96 / HMAC-SHA-96 (RFC3414) and the
+// truncated HMAC-SHA-2 lengths of RFC7860.
+func usmAuthParamLength(proto gosnmp.SnmpV3AuthProtocol) int {
+	switch proto {
+	case gosnmp.MD5, gosnmp.SHA:
+		return 12
+	case gosnmp.SHA224:
+		return 16
+	case gosnmp.SHA256:
+		return 24
+	case gosnmp.SHA384:
+		return 32
+	case gosnmp.SHA512:
+		return 48
+	default:
+		return 0
+	}
+}
+
+// usmAuthEnabled reports if a user is configured with an authentication protocol.
+//
+//	The zero value is treated as NoAuth.
+func usmAuthEnabled(user *gosnmp.UsmSecurityParameters) bool {
+	return user.AuthenticationProtocol > gosnmp.NoAuth
+}
+
+// usmPrivEnabled reports if a user is configured with a privacy protocol.
+//
+//	The zero value is treated as NoPriv.
+func usmPrivEnabled(user *gosnmp.UsmSecurityParameters) bool {
+	return user.PrivacyProtocol > gosnmp.NoPriv
+}
+
+// VerifyUsmUser checks that a user only selects protocols this server implements:
+//
+//	auth: MD5, SHA, SHA224, SHA256, SHA384, SHA512
+//	priv: DES, AES, AES192, AES256, AES192C, AES256C
+//
+// A privacy protocol requires an authentication protocol.
+func VerifyUsmUser(user *gosnmp.UsmSecurityParameters) error {
+	if user.UserName == "" {
+		return errors.New("usm user: empty UserName")
+	}
+	if user.AuthenticationProtocol > gosnmp.SHA512 {
+		return errors.Errorf("usm user %v: unsupported AuthenticationProtocol %v", user.UserName, user.AuthenticationProtocol)
+	}
+	if user.PrivacyProtocol > gosnmp.AES256C {
+		return errors.Errorf("usm user %v: unsupported PrivacyProtocol %v", user.UserName, user.PrivacyProtocol)
+	}
+	if usmPrivEnabled(user) && !usmAuthEnabled(user) {
+		return errors.Errorf("usm user %v: PrivacyProtocol %v requires an AuthenticationProtocol", user.UserName, user.PrivacyProtocol)
+	}
+	if usmAuthEnabled(user) && user.AuthenticationPassphrase == "" && len(user.SecretKey) == 0 {
+		return errors.Errorf("usm user %v: empty AuthenticationPassphrase", user.UserName)
+	}
+	if usmPrivEnabled(user) && user.PrivacyPassphrase == "" && len(user.PrivacyKey) == 0 {
+		return errors.Errorf("usm user %v: empty PrivacyPassphrase", user.UserName)
+	}
+	return nil
+}
+
+// usmCheckSecurityLevel checks the msgFlags of a request against what user is configured for
+func usmCheckSecurityLevel(flags gosnmp.SnmpV3MsgFlags, user *gosnmp.UsmSecurityParameters) bool {
+	if flags&gosnmp.AuthNoPriv != 0 && !usmAuthEnabled(user) {
+		return false
+	}
+	if flags&gosnmp.AuthPriv == gosnmp.AuthPriv && !usmPrivEnabled(user) {
+		return false
+	}
+	return true
+}
+
+// usmAuthParams locates msgAuthenticationParameters in a raw SNMPv3 message, parsing the message
+// down to its msgSecurityParameters. See RFC3412 section 6 and RFC3414 section 2.4
+//
+//	returns the offset of the digest in raw, and the digest.
+func usmAuthParams(raw []byte) (int, []byte, error) {
+	message, _, err := berExpect(raw, byte(gosnmp.Sequence), "message")
+	if err != nil {
+		return 0, nil, err
+	}
+	// skip msgVersion and msgGlobalData
+	for i := 0; i < 2; i++ {
+		if _, _, message, err = berNext(message); err != nil {
+			return 0, nil, err
+		}
+	}
+	parameters, _, err := berExpect(message, byte(gosnmp.OctetString), "msgSecurityParameters")
+	if err != nil {
+		return 0, nil, err
+	}
+	usm, _, err := berExpect(parameters, byte(gosnmp.Sequence), "UsmSecurityParameters")
+	if err != nil {
+		return 0, nil, err
+	}
+	// skip msgAuthoritativeEngineID, msgAuthoritativeEngineBoots, msgAuthoritativeEngineTime and msgUserName
+	for i := 0; i < 4; i++ {
+		if _, _, usm, err = berNext(usm); err != nil {
+			return 0, nil, err
+		}
+	}
+	digest, _, err := berExpect(usm, byte(gosnmp.OctetString), "msgAuthenticationParameters")
+	if err != nil {
+		return 0, nil, err
+	}
+	// digest slices raw up to its end: their capacities tell where it starts
+	return cap(raw) - cap(digest), digest, nil
+}
+
+// usmIsAuthentic verifies msgAuthenticationParameters of a raw message.
+//
+//	user shall have keys localized to the local engine (see GenKeys)
+func usmIsAuthentic(raw []byte, received *gosnmp.UsmSecurityParameters, user *gosnmp.UsmSecurityParameters) bool {
+	paramLength := usmAuthParamLength(user.AuthenticationProtocol)
+	offset, digest, err := usmAuthParams(raw)
+	if err != nil || paramLength == 0 || len(digest) != paramLength ||
+		!bytes.Equal(digest, []byte(received.AuthenticationParameters)) {
+		return false
+	}
+	// zero the digest as the sender did
+	msg := make([]byte, len(raw))
+	copy(msg, raw)
+	for k := offset; k < offset+paramLength; k++ {
+		msg[k] = 0
+	}
+	mac := hmac.New(user.AuthenticationProtocol.HashType().New, user.SecretKey)
+	mac.Write(msg)
+	return hmac.Equal(mac.Sum(nil)[:paramLength], digest)
+}
+
+// usmInTimeWindow checks msgAuthoritativeEngineBoots / msgAuthoritativeEngineTime
+// of an authenticated request against the local engine.
+func (t *MasterAgent) usmInTimeWindow(received *gosnmp.UsmSecurityParameters) bool {
+	boots := t.SecurityConfig.AuthoritativeEngineBoots
+	if boots == 1<<31-1 || received.AuthoritativeEngineBoots != boots {
+		return false
+	}
+	now := int64(t.SecurityConfig.OnGetAuthoritativeEngineTime())
+	diff := now - int64(received.AuthoritativeEngineTime)
+	return diff <= usmTimeWindow && diff >= -usmTimeWindow
+}
+
+// usmReport builds a REPORT pdu for request carrying a single usmStats counter.
+//
+//	user is nil for an unauthenticated report; Otherwise the report is sent authNoPriv as the user.
+//	Requests without the reportableFlag are only counted, as RFC3412 section 7.2 asks.
+func (t *MasterAgent) usmReport(request *gosnmp.SnmpPacket, oid string, counter *atomic.Uint32,
+	user *gosnmp.UsmSecurityParameters) ([]byte, error) {
+	value := counter.Add(1)
+	if request.MsgFlags&gosnmp.Reportable == 0 {
+		return nil, errors.WithMessagef(ErrNoPermission, "%v: message not reportable", oid)
+	}
+	ret := copySnmpPacket(request)
+	ret.PDUType = gosnmp.Report
+	ret.MsgFlags = gosnmp.NoAuthNoPriv
+	ret.ContextEngineID = string(t.SecurityConfig.AuthoritativeEngineID.Marshal())
+	ret.Error = gosnmp.NoError
+	ret.ErrorIndex = 0
+	ret.NonRepeaters = 0
+	ret.MaxRepetitions = 0
+	ret.Variables = []gosnmp.SnmpPDU{{
+		Name:  oid,
+		Type:  gosnmp.Counter32,
+		Value: value,
+	}}
+	if user != nil && usmAuthEnabled(user) {
+		ret.MsgFlags = gosnmp.AuthNoPriv
+		ret.SecurityParameters = user
+	} else {
+		mb, _ := t.getUsmSecurityParametersFromUser("")
+		if received, ok := request.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+			mb.UserName = received.UserName
+		}
+		ret.SecurityParameters = mb
+	}
+	t.priv.logger.Debug("usm report", "oid", oid, "value", value)
+	return ret.MarshalMsg()
+}
@@ -0,0 +1,239 @@
+package GoSNMPServer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+var (
+	usmTestAuths = []gosnmp.SnmpV3AuthProtocol{gosnmp.MD5, gosnmp.SHA, gosnmp.SHA224, gosnmp.SHA256, gosnmp.SHA384, gosnmp.SHA512}
+	usmTestPrivs = []gosnmp.SnmpV3PrivProtocol{gosnmp.NoPriv, gosnmp.DES, gosnmp.AES, gosnmp.AES192, gosnmp.AES256, gosnmp.AES192C, gosnmp.AES256C}
+)
+
+// usmTestUser selects the protocols of a user, named after them
+type usmTestUser struct {
+	auth gosnmp.SnmpV3AuthProtocol
+	priv gosnmp.SnmpV3PrivProtocol
+}
+
+func (u usmTestUser) name() string {
+	return fmt.Sprintf("%v-%v", u.auth, u.priv)
+}
+
+// fill sets user as u, its passphrases being right
+func (u usmTestUser) fill(user *gosnmp.UsmSecurityParameters) {
+	user.UserName = u.name()
+	user.AuthenticationProtocol, user.PrivacyProtocol = u.auth, u.priv
+	if u.auth != gosnmp.NoAuth {
+		user.AuthenticationPassphrase = "authpassphrase"
+	}
+	if u.priv != gosnmp.NoPriv {
+		user.PrivacyPassphrase = "privpassphrase"
+	}
+}
+
+func (u usmTestUser) flags() gosnmp.SnmpV3MsgFlags {
+	switch {
+	case u.auth == gosnmp.NoAuth:
+		return gosnmp.NoAuthNoPriv
+	case u.priv == gosnmp.NoPriv:
+		return gosnmp.AuthNoPriv
+	default:
+		return gosnmp.AuthPriv
+	}
+}
+
+func usmTestMaster(users ...usmTestUser) MasterAgent {
+	master := MasterAgent{
+		AllowedVersion: SNMPV3,
+		SecurityConfig: SecurityConfig{AuthoritativeEngineBoots: 1},
+		SubAgents:      []*SubAgent{{OIDs: stringOIDs("1.3.6.1.2.1.1.1.0")}},
+	}
+	master.SecurityConfig.Users = make([]gosnmp.UsmSecurityParameters, len(users))
+	for id, user := range users {
+		user.fill(&master.SecurityConfig.Users[id])
+	}
+	return master
+}
+
+// usmTestClient returns a gosnmp client of user, who discovers the engine on its first request.
+// change, if any, alters the user before.
+func usmTestClient(t *testing.T, port uint16, user usmTestUser, change func(*gosnmp.UsmSecurityParameters)) *gosnmp.GoSNMP {
+	client := udpClient(t, port, gosnmp.Version3)
+	client.MsgFlags = user.flags()
+	parameters := new(gosnmp.UsmSecurityParameters)
+	user.fill(parameters)
+	if change != nil {
+		change(parameters)
+	}
+	client.SecurityParameters = parameters
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestUSMRoundTrip(t *testing.T) {
+	users := []usmTestUser{{gosnmp.NoAuth, gosnmp.NoPriv}}
+	for _, auth := range usmTestAuths {
+		for _, priv := range usmTestPrivs {
+			users = append(users, usmTestUser{auth, priv})
+		}
+	}
+	server, port := serveUDP(t, usmTestMaster(users...))
+	for _, user := range users {
+		user := user
+		t.Run(user.name(), func(t *testing.T) {
+			res, err := usmTestClient(t, port, user, nil).Get([]string{"1.3.6.1.2.1.1.1.0"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Variables) != 1 || res.Variables[0].Type != gosnmp.OctetString ||
+				string(res.Variables[0].Value.([]byte)) != "v1.3.6.1.2.1.1.1.0" {
+				t.Fatalf("unexpected response %+v", res.Variables)
+			}
+			if user.auth == gosnmp.NoAuth {
+				return
+			}
+			before := server.master.priv.usmStats.wrongDigests.Load()
+			wrong := func(parameters *gosnmp.UsmSecurityParameters) {
+				parameters.AuthenticationPassphrase = "wrongpassphrase"
+			}
+			if _, err := usmTestClient(t, port, user, wrong).Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+				t.Fatal("wrong passphrase accepted")
+			}
+			if server.master.priv.usmStats.wrongDigests.Load() == before {
+				t.Error("usmStatsWrongDigests not counted")
+			}
+		})
+	}
+}
+
+func TestUSMSecurityLevel(t *testing.T) {
+	server, port := serveUDP(t, usmTestMaster(usmTestUser{gosnmp.SHA256, gosnmp.NoPriv}))
+	user := usmTestUser{gosnmp.SHA256, gosnmp.AES}
+	named := func(parameters *gosnmp.UsmSecurityParameters) { parameters.UserName = "SHA256-NoPriv" }
+	if _, err := usmTestClient(t, port, user, named).Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+		t.Fatal("authPriv accepted for an authNoPriv user")
+	}
+	if server.master.priv.usmStats.unsupportedSecLevels.Load() == 0 {
+		t.Error("usmStatsUnsupportedSecLevels not counted")
+	}
+}
+
+func TestUSMUnknownUserName(t *testing.T) {
+	server, port := serveUDP(t, usmTestMaster(usmTestUser{gosnmp.SHA256, gosnmp.AES}))
+	if _, err := usmTestClient(t, port, usmTestUser{gosnmp.SHA512, gosnmp.AES}, nil).Get([]string{"1.3.6.1.2.1.1.1.0"}); err == nil {
+		t.Fatal("unknown user accepted")
+	}
+	if server.master.priv.usmStats.unknownUserNames.Load() == 0 {
+		t.Error("usmStatsUnknownUserNames not counted")
+	}
+}
+
+func TestUSMTimeWindow(t *testing.T) {
+	user := usmTestUser{gosnmp.SHA384, gosnmp.AES256C}
+	server, port := serveUDP(t, usmTestMaster(user))
+	client := usmTestClient(t, port, user, nil)
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	// out of the time window, the client learns the engine time from the report and retries
+	client.SecurityParameters.(*gosnmp.UsmSecurityParameters).AuthoritativeEngineTime += 10 * usmTimeWindow
+	if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if server.master.priv.usmStats.notInTimeWindows.Load() != 1 {
+		t.Errorf("usmStatsNotInTimeWindows = %d, expected 1", server.master.priv.usmStats.notInTimeWindows.Load())
+	}
+}
+
+func TestUSMIsAuthentic(t *testing.T) {
+	master := usmTestMaster(usmTestUser{gosnmp.SHA256, gosnmp.NoPriv})
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	user, err := master.getUsmSecurityParametersFromUser("SHA256-NoPriv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	GenKeys(user)
+	request := &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           gosnmp.AuthNoPriv | gosnmp.Reportable,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: user.Copy(),
+		MsgID:              1,
+		RequestID:          1,
+		MsgMaxSize:         65507,
+		PDUType:            gosnmp.GetRequest,
+		Variables:          []gosnmp.SnmpPDU{{Name: "1.3.6.1.2.1.1.1.0", Type: gosnmp.Null}},
+	}
+	raw, err := request.MarshalMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, digest, err := usmAuthParams(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digest) != usmAuthParamLength(gosnmp.SHA256) || &raw[offset] != &digest[0] {
+		t.Fatalf("digest at %d of %d octets", offset, len(digest))
+	}
+	received := &gosnmp.UsmSecurityParameters{AuthenticationParameters: string(digest)}
+	if !usmIsAuthentic(raw, received, user) {
+		t.Fatal("message not authentic")
+	}
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-3] ^= 1
+	if usmIsAuthentic(tampered, received, user) {
+		t.Error("tampered message authentic")
+	}
+	if usmIsAuthentic(raw[:offset], received, user) {
+		t.Error("truncated message authentic")
+	}
+}
+
+func TestUSMReportReportable(t *testing.T) {
+	master := usmTestMaster(usmTestUser{gosnmp.SHA256, gosnmp.AES})
+	if err := master.ReadyForWork(); err != nil {
+		t.Fatal(err)
+	}
+	discovery := func(flags gosnmp.SnmpV3MsgFlags) []byte {
+		request := &gosnmp.SnmpPacket{
+			Version:            gosnmp.Version3,
+			MsgFlags:           flags,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{},
+			MsgID:              1,
+			RequestID:          1,
+			MsgMaxSize:         65507,
+			PDUType:            gosnmp.GetRequest,
+		}
+		raw, err := request.MarshalMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	out, err := master.ResponseForBuffer(discovery(gosnmp.NoAuthNoPriv | gosnmp.Reportable))
+	if err != nil || len(out) == 0 {
+		t.Fatalf("discovery not answered: %v", err)
+	}
+	decoder := gosnmp.GoSNMP{SecurityParameters: &gosnmp.UsmSecurityParameters{}, Logger: gosnmp.Default.Logger}
+	report, err := decoder.SnmpDecodePacket(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.PDUType != gosnmp.Report || len(report.Variables) != 1 || report.Variables[0].Name != "."+oidUsmStatsUnknownEngineIDs {
+		t.Fatalf("unexpected report %v %+v", report.PDUType, report.Variables)
+	}
+	if out, _ := master.ResponseForBuffer(discovery(gosnmp.NoAuthNoPriv)); len(out) != 0 {
+		t.Error("report sent for a message without reportableFlag")
+	}
+	if master.priv.usmStats.unknownEngineIDs.Load() != 2 {
+		t.Errorf("usmStatsUnknownEngineIDs = %d, expected 2", master.priv.usmStats.unknownEngineIDs.Load())
+	}
+}
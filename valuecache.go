@@ -0,0 +1,124 @@
+package GoSNMPServer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CacheStats counts OnGet calls through the cache of PDUValueControlItem.CacheTTL.
+type CacheStats struct {
+	// Hits are reads answered without calling OnGet, including reads
+	// which waited for a concurrent OnGet of the same item.
+	Hits uint64
+	// Misses are reads which called OnGet.
+	Misses uint64
+}
+
+// valueCache holds the last OnGet value of an item for its CacheTTL,
+// and coalesces concurrent reads into a single OnGet call.
+type valueCache struct {
+	sync.Mutex
+	value   interface{}
+	expires time.Time
+	// generation changes on invalidate, so an OnGet running meanwhile is not cached
+	generation uint64
+	call       *valueCacheCall
+}
+
+// valueCacheCall is an OnGet in progress
+type valueCacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// get returns the cached value, or calls fetch once for all concurrent readers.
+//
+//	hit reports if fetch was not called by this reader. errors are not cached.
+func (c *valueCache) get(ttl time.Duration, fetch FuncPDUControlGet) (value interface{}, hit bool, err error) {
+	c.Lock()
+	if time.Now().Before(c.expires) {
+		value = c.value
+		c.Unlock()
+		return value, true, nil
+	}
+	if call := c.call; call != nil {
+		c.Unlock()
+		<-call.done
+		return call.value, true, call.err
+	}
+	call := &valueCacheCall{done: make(chan struct{})}
+	c.call = call
+	generation := c.generation
+	c.Unlock()
+
+	returned := false
+	defer func() {
+		// a panic is left to the caller. readers waiting get an error instead
+		if !returned {
+			call.err = errors.New("OnGet panicked")
+		}
+		c.Lock()
+		if c.call == call {
+			c.call = nil
+		}
+		if call.err == nil && generation == c.generation {
+			c.value = call.value
+			c.expires = time.Now().Add(ttl)
+		}
+		c.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = fetch()
+	returned = true
+	return call.value, false, call.err
+}
+
+// invalidate drops the cached value, and forgets the OnGet in progress: reads from now on
+// call OnGet again instead of waiting for it, and its value is not cached.
+func (c *valueCache) invalidate() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.expires = time.Time{}
+	c.value = nil
+	c.call = nil
+}
+
+// InvalidateCache drops the value cached for CacheTTL, so the next read calls OnGet.
+func (t *PDUValueControlItem) InvalidateCache() {
+	if t.cache != nil {
+		t.cache.invalidate()
+	}
+}
+
+// syncCache prepares the cache once CacheTTL is set
+func (t *PDUValueControlItem) syncCache() {
+	if t.CacheTTL > 0 && t.cache == nil {
+		t.cache = &valueCache{}
+	}
+}
+
+// onGet calls item.OnGet, through its cache when CacheTTL is set
+func (t *SubAgent) onGet(item *PDUValueControlItem) (interface{}, error) {
+	if item.cache == nil || item.CacheTTL <= 0 {
+		return item.OnGet()
+	}
+	value, hit, err := item.cache.get(item.CacheTTL, item.OnGet)
+	if hit {
+		t.cacheHits.Add(1)
+	} else {
+		t.cacheMisses.Add(1)
+	}
+	return value, err
+}
+
+// CacheStats returns the cache counters of items served by this SubAgent
+func (t *SubAgent) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   t.cacheHits.Load(),
+		Misses: t.cacheMisses.Load(),
+	}
+}
@@ -0,0 +1,124 @@
+package GoSNMPServer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// blockingFetch returns an OnGet which counts its calls and waits for release before returning value
+func blockingFetch(calls *atomic.Int32, release <-chan struct{}, value string) FuncPDUControlGet {
+	return func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return value, nil
+	}
+}
+
+func TestValueCacheCoalesces(t *testing.T) {
+	var cache valueCache
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := blockingFetch(&calls, release, "value")
+
+	var wg sync.WaitGroup
+	var hits atomic.Int32
+	for id := 0; id < 8; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, hit, err := cache.get(time.Minute, fetch)
+			if err != nil || value != "value" {
+				t.Errorf("got %v %v", value, err)
+			}
+			if hit {
+				hits.Add(1)
+			}
+		}()
+	}
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 || hits.Load() != 7 {
+		t.Errorf("%d OnGet calls, %d hits", calls.Load(), hits.Load())
+	}
+	if _, hit, _ := cache.get(time.Minute, fetch); !hit {
+		t.Error("value not cached")
+	}
+}
+
+func TestValueCacheInvalidateInFlight(t *testing.T) {
+	var cache valueCache
+	var calls atomic.Int32
+	stale, fresh := make(chan struct{}), make(chan struct{})
+
+	done := make(chan interface{})
+	go func() {
+		value, _, _ := cache.get(time.Minute, blockingFetch(&calls, stale, "stale"))
+		done <- value
+	}()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cache.invalidate()
+
+	// a read after invalidate does not wait for the OnGet in progress
+	close(fresh)
+	value, hit, err := cache.get(time.Minute, blockingFetch(&calls, fresh, "fresh"))
+	if err != nil || hit || value != "fresh" {
+		t.Fatalf("read after invalidate: %v hit=%v %v", value, hit, err)
+	}
+	close(stale)
+	if value := <-done; value != "stale" {
+		t.Errorf("read before invalidate got %v", value)
+	}
+	if value, hit, _ := cache.get(time.Minute, nil); !hit || value != "fresh" {
+		t.Errorf("cached %v, expected the value read after invalidate", value)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("%d OnGet calls", calls.Load())
+	}
+}
+
+func TestValueCacheErrorsNotCached(t *testing.T) {
+	var cache valueCache
+	failing := func() (interface{}, error) { return nil, errors.New("backend down") }
+	if _, _, err := cache.get(time.Minute, failing); err == nil {
+		t.Fatal("error lost")
+	}
+	value, hit, err := cache.get(time.Minute, func() (interface{}, error) { return "value", nil })
+	if err != nil || hit || value != "value" {
+		t.Errorf("got %v hit=%v %v after an error", value, hit, err)
+	}
+}
+
+func TestValueCacheProviderNotCached(t *testing.T) {
+	var calls atomic.Int32
+	provider := NewFuncBatchValueProvider(func(oids []string) ([]BatchValue, error) {
+		calls.Add(1)
+		values := make([]BatchValue, len(oids))
+		for id := range values {
+			values[id].Value = "value"
+		}
+		return values, nil
+	})
+	items := stringOIDs("1.3.6.1.2.1.1.1.0")
+	items[0].OnGet, items[0].Provider, items[0].CacheTTL = nil, provider, time.Minute
+	_, port := serveUDP(t, MasterAgent{AllowedVersion: SNMPV2c, SubAgents: []*SubAgent{{OIDs: items}}})
+	client := communityClient(t, port, gosnmp.Version2c, "public")
+	for id := 0; id < 2; id++ {
+		if _, err := client.Get([]string{"1.3.6.1.2.1.1.1.0"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("provider called %d times for 2 reads", calls.Load())
+	}
+}
@@ -0,0 +1,95 @@
+package GoSNMPServer
+
+import (
+	"math"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+)
+
+// WalkFunc receives each variable of a walk. Returning an error stops the walk with it.
+type WalkFunc func(pdu gosnmp.SnmpPDU) error
+
+// Walk calls fn with each variable served under root ("" for all), in OID order, as a GetNext walk
+// of a manager would see them, in-process. Each BatchValueProvider is called once for the subtree.
+func (t *SubAgent) Walk(root string, fn WalkFunc) error {
+	return walk(root, fn, func(request *gosnmp.SnmpPacket, subtree []OID) (*gosnmp.SnmpPacket, error) {
+		scope := &requestScope{}
+		scope.restrict(subtree, false)
+		return t.serve(request, scope)
+	})
+}
+
+// Walk calls fn with each variable served under root ("" for all) to a SNMPv2c manager using
+// community, in OID order, in-process. CommunityACLs limited to some networks refuse it, as
+// the source is unknown. The MasterAgent shell be ReadyForWork.
+//
+//	Interceptors see GetBulk requests, each answered up to MaxMessageSize. BatchValueProviders are
+//	called once per response.
+func (t *MasterAgent) Walk(community, root string, fn WalkFunc) error {
+	return walk(root, fn, func(request *gosnmp.SnmpPacket, subtree []OID) (*gosnmp.SnmpPacket, error) {
+		request.Community = community
+		scope, err := t.scopeForCommunity(request, nil)
+		if err != nil {
+			return nil, err
+		}
+		scope.logger, scope.tracer = t.priv.logger, t.Tracer
+		scope.restrict(subtree, false)
+		return t.responseForPkt(request, scope)
+	})
+}
+
+// walk sends GetBulk requests to serve from root until the end of the subtree. serve limits the
+// request to subtree, nil for all OIDs, so the successors of the subtree are not read.
+func walk(root string, fn WalkFunc, serve func(request *gosnmp.SnmpPacket, subtree []OID) (*gosnmp.SnmpPacket, error)) error {
+	var prefix OID
+	var subtree []OID
+	if root != "" {
+		var err error
+		if prefix, err = ParseOID(root); err != nil {
+			return err
+		}
+		subtree = []OID{prefix}
+	}
+	name, last := "."+prefix.String(), prefix
+	if len(prefix) == 0 {
+		name = ".0"
+	}
+	for {
+		request := &gosnmp.SnmpPacket{
+			Version:        gosnmp.Version2c,
+			PDUType:        gosnmp.GetBulkRequest,
+			MaxRepetitions: math.MaxInt32,
+			Variables:      []gosnmp.SnmpPDU{{Name: name, Type: gosnmp.Null}},
+		}
+		response, err := serve(request, subtree)
+		if err != nil {
+			return err
+		}
+		if response.Error != gosnmp.NoError {
+			return errors.Errorf("walk %v: %v", name, response.Error)
+		}
+		if len(response.Variables) == 0 {
+			return errors.Errorf("walk %v: no variables returned", name)
+		}
+		for _, pdu := range response.Variables {
+			if pdu.Type == gosnmp.EndOfMibView {
+				return nil
+			}
+			oid, err := ParseOID(pdu.Name)
+			if err != nil {
+				return err
+			}
+			if !oid.HasPrefix(prefix) {
+				return nil
+			}
+			if oid.Compare(last) <= 0 {
+				return errors.Errorf("walk %v: oid %v not increasing", name, pdu.Name)
+			}
+			if err := fn(pdu); err != nil {
+				return err
+			}
+			name, last = pdu.Name, oid
+		}
+	}
+}